@@ -4,45 +4,114 @@ import (
 	"fmt"
 	"log"
 	"os"
-	"terralink/internal/ignore"
+	"sort"
+	"strings"
 	"terralink/internal/linker"
+	"terralink/internal/report"
 
 	"github.com/spf13/cobra"
 )
 
 // checkCmd represents the check command
 var checkCmd = &cobra.Command{
-	Use:   "check",
+	Use:   "check [selector...]",
 	Short: "Verify that no modules are in dev mode.",
 	Long: `The 'check' command scans for any active 'terralink-state' annotations.
 If any are found, it lists the linked modules and exits with a non-zero status code.
-This is useful in pre-commit hooks to prevent committing dev configurations.`,
+This is useful in pre-commit hooks to prevent committing dev configurations.
+
+With --strict it also reports inconsistent modules: loaded modules whose
+source no longer matches their dev annotation, duplicate 'terralink-state'
+annotations, 'terralink-state' annotations without a dev annotation, and
+modules using a local './' or '../' source without any 'terralink-state'.
+
+With --staged only the staged .tf, .tf.json and .hcl files are checked, as
+they are in the git index: changes that are not staged, e.g. loaded modules
+in other files, do not fail the check. With --rev <commit> the files added or
+modified by that commit are checked, as they are in the commit; a merge commit
+is compared with its first parent. With --rev <base>..<commit> (or
+<base>...<commit>, from their merge base) the files that differ between the
+two commits are checked, as they are in <commit>.
+
+Use --format to emit the findings as json, sarif, junit, github or gitlab
+(Code Quality) output on stdout for CI systems.
+
+Positional arguments restrict the command to matching modules: module names,
+globs such as 'aws_*', or .tf/.tf.json/.hcl files. --local-path selects every
+module whose annotation resolves to the given directory and --profile every
+module annotated with 'profile=<name>'. Selectors of the same kind are OR-ed,
+different kinds are AND-ed.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("Checking for active dev links...")
-		matcher, err := ignore.NewMatcher(ignoreFile)
+		loadConfig(cmd)
+		format, err := report.ParseFormat(cfg.Format)
 		if err != nil {
-			log.Fatalf("Error creating ignore matcher: %v", err)
+			log.Fatalf("Error: %v", err)
 		}
-		l := linker.NewLinker(matcher)
-		activeDevLoadModules, err := l.Check(scanDir)
+
+		if staged && checkRev != "" {
+			log.Fatalf("Error: --staged and --rev cannot be used together")
+		}
+		revision := checkRev
+		if staged {
+			revision = linker.StagedRevision
+		}
+
+		log.Println("Checking for active dev links...")
+		l := linker.NewLinker(newMatcher(),
+			linker.WithSelector(newSelector(args, profiles)),
+			linker.WithModuleRoots(cfg.ModuleRoots),
+			linker.WithLinks(newLinks()),
+			linker.WithRevision(revision),
+		)
+		activeDevLoadModules, err := l.Check(cfg.Dirs...)
 		if err != nil {
 			log.Fatalf("Error during check: %v", err)
 		}
+		findings := loadedModuleFindings(activeDevLoadModules)
+		loadedFindings := len(findings)
+		if strict {
+			diagnostics, err := l.Drift(cfg.Dirs...)
+			if err != nil {
+				log.Fatalf("Error during check: %v", err)
+			}
+			findings = append(findings, driftFindings(diagnostics)...)
+		}
+
+		if format != report.FormatText {
+			if err := report.Write(os.Stdout, format, findings); err != nil {
+				log.Fatalf("Error writing report: %v", err)
+			}
+			if len(findings) > 0 {
+				os.Exit(1)
+			}
+			return
+		}
 
-		if len(activeDevLoadModules) > 0 {
-			_, err = fmt.Fprintln(os.Stderr, "\n❌ Error: Found Loaded Dev modules")
+		if len(findings) > 0 {
+			header := "Found Loaded Dev modules"
+			switch {
+			case loadedFindings == 0:
+				header = "Found inconsistent modules"
+			case loadedFindings < len(findings):
+				header = "Found Loaded Dev modules and inconsistent modules"
+			}
+			_, err = fmt.Fprintf(os.Stderr, "\n❌ Error: %s\n", header)
 			if err != nil {
 				log.Panic(err)
 			}
 
-			for _, loadedModules := range activeDevLoadModules {
-				_, err = fmt.Fprintf(os.Stderr, "  - Module '%s' is loaded.\n", loadedModules)
+			if err := report.Write(os.Stderr, report.FormatText, findings); err != nil {
+				log.Panic(err)
+			}
+
+			if active := activeProfiles(findings); len(active) > 0 {
+				_, err = fmt.Fprintf(os.Stderr, "\nActive profiles: %s\n", strings.Join(active, ", "))
 				if err != nil {
 					log.Panic(err)
 				}
-
 			}
-			_, err = fmt.Fprintln(os.Stderr, "\nRun 'terralink unload' to fix this.")
+
+			_, err = fmt.Fprintln(os.Stderr, "\n"+strings.Join(fixAdvice(findings, staged), "\n"))
 			if err != nil {
 				log.Panic(err)
 			}
@@ -54,7 +123,116 @@ This is useful in pre-commit hooks to prevent committing dev configurations.`,
 	},
 }
 
+// loadedModuleFindings converts the result of Linker.Check into report
+// findings, ordered by file and line.
+func loadedModuleFindings(loadedModulesPerFile map[string]linker.LoadedModules) []report.Finding {
+	var findings []report.Finding
+	for _, loadedModules := range loadedModulesPerFile {
+		for _, module := range loadedModules {
+			message := fmt.Sprintf("Module '%s' is loaded", module.Name)
+			if module.LocalPath != "" {
+				message += fmt.Sprintf(" from local path '%s'", module.LocalPath)
+			}
+			message += fmt.Sprintf(" (original source '%s'", module.Source)
+			if module.Version != "" {
+				message += fmt.Sprintf(", version '%s'", module.Version)
+			}
+			message += ")."
+
+			findings = append(findings, report.Finding{
+				Rule:      report.RuleLoadedModule,
+				Message:   message,
+				File:      module.File,
+				Line:      module.Line,
+				Column:    module.Column,
+				Module:    module.Name,
+				LocalPath: module.LocalPath,
+				Source:    module.Source,
+				Version:   module.Version,
+				Profiles:  module.Profiles,
+			})
+		}
+	}
+	sort.Slice(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+// driftFindings converts the result of Linker.Drift into report findings.
+func driftFindings(diagnostics []linker.DriftDiagnostic) []report.Finding {
+	var findings []report.Finding
+	for _, diagnostic := range diagnostics {
+		findings = append(findings, report.Finding{
+			Rule:    diagnostic.Rule,
+			Message: diagnostic.Message,
+			File:    diagnostic.File,
+			Line:    diagnostic.Line,
+			Column:  diagnostic.Column,
+			Module:  diagnostic.Module,
+			Source:  diagnostic.Source,
+		})
+	}
+	return findings
+}
+
+// fixAdvice returns how to fix the findings. Unload cannot parse a malformed
+// state, which repair fixes, and does nothing for local sources linked by
+// hand, which have no state to restore.
+func fixAdvice(findings []report.Finding, staged bool) []string {
+	unload, repair, unlinked := false, false, false
+	for _, finding := range findings {
+		switch finding.Rule {
+		case report.RuleUnlinkedLocalSource:
+			unlinked = true
+		case report.RuleMalformedState:
+			repair = true
+		default:
+			unload = true
+		}
+	}
+	stage := ""
+	if staged {
+		stage = " and stage the changes"
+	}
+	var advice []string
+	if unload {
+		advice = append(advice, fmt.Sprintf("Run 'terralink unload'%s to fix this.", stage))
+	}
+	if repair {
+		advice = append(advice, fmt.Sprintf("Run 'terralink repair'%s to fix malformed terralink-state annotations.", stage))
+	}
+	if unlinked {
+		advice = append(advice, fmt.Sprintf("Restore the registry source of modules linked by hand%s; add a '# terralink: path=...' annotation to link them with 'terralink load' instead.", stage))
+	}
+	return advice
+}
+
+// activeProfiles returns the sorted profiles that have at least one loaded module.
+func activeProfiles(findings []report.Finding) []string {
+	seen := map[string]bool{}
+	var active []string
+	for _, finding := range findings {
+		for _, profile := range finding.Profiles {
+			if !seen[profile] {
+				seen[profile] = true
+				active = append(active, profile)
+			}
+		}
+	}
+	sort.Strings(active)
+	return active
+}
+
 func init() {
 	commonFlags(checkCmd)
+	selectorFlags(checkCmd)
+	formatFlag(checkCmd)
+	checkCmd.Flags().BoolVar(&strict, "strict", false, "Also report loaded modules whose source drifted and local sources without a terralink-state")
+	checkCmd.Flags().BoolVar(&staged, "staged", false, "Check the staged content of the staged files instead of the working tree")
+	checkCmd.Flags().StringVar(&checkRev, "rev", "", "Check the files added or modified by this commit or range (base..commit), as they are in it")
 	rootCmd.AddCommand(checkCmd)
 }
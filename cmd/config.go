@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"terralink/internal/config"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// configCmd groups the commands inspecting the project configuration.
+var configCmd = &cobra.Command{
+	Use:   "config",
+	Short: "Inspect the terralink configuration.",
+	Long: `terralink reads its configuration from .terralink.hcl files found walking up
+from --dir to the root of the git repository; nearer files override farther
+ones. TERRALINK_* environment variables override the files, and command line
+flags override both.`,
+}
+
+// configShowCmd prints the effective configuration.
+var configShowCmd = &cobra.Command{
+	Use:   "show",
+	Short: "Print the effective configuration and where each value came from.",
+	Long: `The 'show' command prints every setting of the effective configuration, after
+merging the .terralink.hcl files, the TERRALINK_* environment variables and the
+given flags, together with the file and line, variable or flag it came from.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loadConfig(cmd)
+
+		if len(cfg.Files) == 0 {
+			fmt.Println("# No configuration file found.")
+		} else {
+			fmt.Println("# Configuration files:")
+			for _, file := range cfg.Files {
+				fmt.Printf("#   %s\n", file)
+			}
+		}
+		if len(cfg.LinkFiles) > 0 {
+			fmt.Println("# Links files:")
+			for _, file := range cfg.LinkFiles {
+				fmt.Printf("#   %s\n", file)
+			}
+		}
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		for _, setting := range cfg.Settings() {
+			if _, err := fmt.Fprintf(w, "%s = %s\t# %s\n", setting.Key, setting.Value, setting.Source); err != nil {
+				log.Panic(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			log.Panic(err)
+		}
+	},
+}
+
+// flagSettings maps the flags overriding a setting to the setting's name.
+var flagSettings = []struct {
+	flag string
+	key  string
+}{
+	{"dir", config.KeyDirs},
+	{"exclude", config.KeyIgnore},
+	{"profile", config.KeyProfiles},
+	{"format", config.KeyFormat},
+	{"allowed-root", config.KeyAllowedRoots},
+}
+
+// loadConfig builds the effective configuration of the command: the
+// .terralink.hcl files discovered from --dir (or the current directory), then
+// the TERRALINK_* environment variables, then the flags that were set.
+func loadConfig(cmd *cobra.Command) {
+	startDir := "."
+	if cmd.Flags().Changed("dir") {
+		startDir = scanDir
+	}
+
+	loaded, err := config.Load(startDir)
+	if err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+	if err := loaded.ApplyEnv(os.LookupEnv); err != nil {
+		log.Fatalf("Error loading configuration: %v", err)
+	}
+
+	for _, setting := range flagSettings {
+		if !cmd.Flags().Changed(setting.flag) {
+			continue
+		}
+		var values []string
+		base := "."
+		switch setting.flag {
+		case "dir":
+			values = []string{scanDir}
+		case "exclude":
+			values = excludes
+			base = commonDir(loaded.Dirs)
+		case "profile":
+			values = profiles
+		case "format":
+			values = []string{outputFormat}
+		case "allowed-root":
+			values = allowedRoots
+		}
+		if err := loaded.Set(setting.key, values, base, "flag --"+setting.flag); err != nil {
+			log.Fatalf("Error loading configuration: %v", err)
+		}
+	}
+	cfg = loaded
+}
+
+func init() {
+	commonFlags(configShowCmd)
+	selectorFlags(configShowCmd)
+	formatFlag(configShowCmd)
+	configShowCmd.Flags().StringSliceVar(&allowedRoots, "allowed-root", nil, "Refuse local paths outside of this directory (repeatable)")
+	configCmd.AddCommand(configShowCmd)
+	rootCmd.AddCommand(configCmd)
+}
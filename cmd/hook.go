@@ -0,0 +1,183 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"terralink/internal/githook"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// hookCmd groups the commands managing the git hooks of a repository.
+var hookCmd = &cobra.Command{
+	Use:   "hook",
+	Short: "Manage the git hooks running terralink.",
+	Long: `terralink can install git hooks in the repository containing --dir: a
+pre-commit hook running 'terralink check --staged', and optionally
+post-checkout and post-merge hooks running 'terralink load' to re-apply your
+loaded modules after switching branches or pulling.
+
+Hooks are written to the hooks directory of the repository, honouring
+core.hooksPath. An existing hook is kept and run first.`,
+}
+
+// hookInstallCmd installs the hooks.
+var hookInstallCmd = &cobra.Command{
+	Use:   "install [selector...]",
+	Short: "Install the pre-commit hook, and the reload hooks with --reload.",
+	Long: `The 'install' command writes a pre-commit hook running 'terralink check
+--staged' (with --strict if given), so commits staging loaded modules are
+refused.
+
+With --reload it also writes post-checkout and post-merge hooks running
+'terralink load' after a branch switch or a merge. Positional arguments,
+--profile and --local-path are passed on to 'load' to select the modules to
+re-apply; without them the profiles and links files of the configuration
+apply.
+
+A hook that was not installed by terralink is renamed with a
+'.terralink-chained' suffix and run first; 'uninstall' restores it.
+Installing again replaces terralink's hooks.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		root, hooksDir := hookDirs()
+		dirArgs := hookDirArgs(root)
+
+		checkArgs := append([]string{"check", "--staged"}, dirArgs...)
+		if strict {
+			checkArgs = append(checkArgs, "--strict")
+		}
+		installHook(hooksDir, githook.PreCommit, checkArgs)
+
+		if !reloadHooks {
+			return
+		}
+		loadArgs := append(append([]string{"load"}, dirArgs...), args...)
+		for _, profile := range profiles {
+			loadArgs = append(loadArgs, "--profile", profile)
+		}
+		for _, localPath := range localPaths {
+			absPath, err := filepath.Abs(localPath)
+			if err != nil {
+				log.Fatalf("Error resolving %s: %v", localPath, err)
+			}
+			loadArgs = append(loadArgs, "--local-path", absPath)
+		}
+		installHook(hooksDir, githook.PostCheckout, loadArgs)
+		installHook(hooksDir, githook.PostMerge, loadArgs)
+	},
+}
+
+// hookUninstallCmd removes the hooks.
+var hookUninstallCmd = &cobra.Command{
+	Use:   "uninstall",
+	Short: "Remove terralink's hooks and restore the hooks they chained.",
+	Long: `The 'uninstall' command removes every hook installed by terralink and puts
+back the hooks they were chained to. Hooks not installed by terralink are left
+untouched.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		_, hooksDir := hookDirs()
+		for _, name := range githook.Names {
+			removed, err := githook.Uninstall(hooksDir, name)
+			if err != nil {
+				log.Fatalf("Error uninstalling the %s hook: %v", name, err)
+			}
+			if removed {
+				log.Printf("Removed the %s hook from %s", name, hooksDir)
+			}
+		}
+	},
+}
+
+// hookStatusCmd lists the hooks.
+var hookStatusCmd = &cobra.Command{
+	Use:   "status",
+	Short: "Show which of terralink's hooks are installed.",
+	Run: func(cmd *cobra.Command, args []string) {
+		_, hooksDir := hookDirs()
+		fmt.Printf("# Hooks directory: %s\n", hooksDir)
+
+		w := tabwriter.NewWriter(os.Stdout, 0, 0, 2, ' ', 0)
+		if _, err := fmt.Fprintln(w, "HOOK\tSTATE\tCOMMAND"); err != nil {
+			log.Panic(err)
+		}
+		for _, name := range githook.Names {
+			status, err := githook.Stat(hooksDir, name)
+			if err != nil {
+				log.Fatalf("Error reading the %s hook: %v", name, err)
+			}
+			state := "not installed"
+			switch {
+			case status.Installed && status.Chained != "":
+				state = "installed (runs " + filepath.Base(status.Chained) + " first)"
+			case status.Installed:
+				state = "installed"
+			case status.Foreign:
+				state = "other hook"
+			}
+			if _, err := fmt.Fprintf(w, "%s\t%s\t%s\n", name, state, orDash(status.Command)); err != nil {
+				log.Panic(err)
+			}
+		}
+		if err := w.Flush(); err != nil {
+			log.Panic(err)
+		}
+	},
+}
+
+// hookDirs returns the top-level directory and the hooks directory of the
+// git repository containing --dir.
+func hookDirs() (string, string) {
+	root, err := githook.RepoRoot(scanDir)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	hooksDir, err := githook.HooksDir(scanDir)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	return root, hooksDir
+}
+
+// hookDirArgs returns the --dir argument of the hook commands: --dir
+// relative to the top-level directory, where git runs hooks, or nothing if
+// it is the top-level directory itself.
+func hookDirArgs(root string) []string {
+	dir, err := filepath.Abs(scanDir)
+	if err == nil {
+		dir, err = filepath.EvalSymlinks(dir)
+	}
+	if err != nil {
+		log.Fatalf("Error resolving %s: %v", scanDir, err)
+	}
+	rel, err := filepath.Rel(root, dir)
+	if err != nil || rel == "." {
+		return nil
+	}
+	return []string{"--dir", filepath.ToSlash(rel)}
+}
+
+// installHook installs a hook and logs what was done.
+func installHook(hooksDir, name string, args []string) {
+	chained, err := githook.Install(hooksDir, name, args)
+	if err != nil {
+		log.Fatalf("Error installing the %s hook: %v", name, err)
+	}
+	log.Printf("Installed the %s hook in %s", name, hooksDir)
+	if chained != "" {
+		log.Printf("The existing %s hook is kept as %s and runs first", name, chained)
+	}
+}
+
+func init() {
+	for _, cmd := range []*cobra.Command{hookInstallCmd, hookUninstallCmd, hookStatusCmd} {
+		cmd.Flags().StringVar(&scanDir, "dir", ".", "Directory inside the git repository whose hooks are managed")
+		hookCmd.AddCommand(cmd)
+	}
+	selectorFlags(hookInstallCmd)
+	hookInstallCmd.Flags().BoolVar(&strict, "strict", false, "Make the pre-commit hook run 'check --strict'")
+	hookInstallCmd.Flags().BoolVar(&reloadHooks, "reload", false, "Also install post-checkout and post-merge hooks running 'load'")
+	rootCmd.AddCommand(hookCmd)
+}
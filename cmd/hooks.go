@@ -0,0 +1,30 @@
+package cmd
+
+import (
+	"log"
+	"os"
+	"os/exec"
+	"runtime"
+)
+
+// runHooks runs the configured hook commands of a stage with the system
+// shell, in order. Hooks are skipped in dry-run mode and the first failing
+// hook aborts the command.
+func runHooks(stage string, commands []string) {
+	if dryRun {
+		return
+	}
+	for _, command := range commands {
+		log.Printf("Running %s hook: %s", stage, command)
+		hook := exec.Command("sh", "-c", command)
+		if runtime.GOOS == "windows" {
+			hook = exec.Command("cmd", "/C", command)
+		}
+		hook.Stdout = os.Stdout
+		hook.Stderr = os.Stderr
+		hook.Env = append(os.Environ(), "TERRALINK_HOOK="+stage)
+		if err := hook.Run(); err != nil {
+			log.Fatalf("Error running %s hook %q: %v", stage, command, err)
+		}
+	}
+}
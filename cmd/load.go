@@ -2,33 +2,77 @@ package cmd
 
 import (
 	"log"
-	"terralink/internal/ignore"
 	"terralink/internal/linker"
 
 	"github.com/spf13/cobra"
 )
 
 var loadCmd = &cobra.Command{
-	Use:   "load",
+	Use:   "load [selector...]",
 	Short: "Link modules to local paths for development.",
 	Long: `The 'dev' command scans .tf files for modules with a 'terralink:path' annotation.
 It replaces the remote 'source' with the local path and saves the original state
-in a temporary 'terralink-state' comment for later restoration.`,
+in a temporary 'terralink-state' comment for later restoration.
+
+Modules annotated with 'git=<address> ref=<ref>' are pointed at that git address
+instead; --ref overrides the annotated ref.
+
+Local paths are resolved relative to the file's directory and must be existing
+directories containing .tf or .tf.json files. All invalid paths are reported at
+once and nothing is written, unless --skip-missing is set.
+
+With --verify-interface every module is also compared with the variables and
+outputs of its local module, as 'terralink verify' does, and nothing is written
+if they do not match.
+
+With --dry-run no file is written; a unified diff of the pending changes is printed instead.
+
+Positional arguments restrict the command to matching modules: module names,
+globs such as 'aws_*', or .tf/.tf.json/.hcl files. --local-path selects every
+module whose annotation resolves to the given directory and --profile every
+module annotated with 'profile=<name>'. Selectors of the same kind are OR-ed,
+different kinds are AND-ed. The configured profiles only apply when no module
+is selected by name, file or --local-path.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("Linking local modules for DEV mode...")
-		matcher, err := ignore.NewMatcher(ignoreFile)
-		if err != nil {
-			log.Fatalf("Error creating ignore matcher: %v", err)
-		}
-		l := linker.NewLinker(matcher)
-		_, err = l.DevLoad(scanDir)
-		if err != nil {
-			log.Fatalf("Error running in dev mode: %v", err)
-		}
+		runLoad(cmd, args)
 	},
 }
 
+func runLoad(cmd *cobra.Command, args []string) {
+	loadConfig(cmd)
+	if dryRun {
+		log.Println("Planning local module links for DEV mode (dry run)...")
+	} else {
+		log.Println("Linking local modules for DEV mode...")
+	}
+	opts := []linker.Option{
+		linker.WithDryRun(dryRun),
+		linker.WithFormat(formatFiles),
+		linker.WithSelector(newSelector(args, loadProfiles(cmd, args))),
+		linker.WithGitRef(gitRef),
+		linker.WithSkipMissing(skipMissing),
+		linker.WithModuleRoots(cfg.ModuleRoots),
+		linker.WithVerifyInterface(verifyIface),
+		linker.WithLinks(newLinks()),
+	}
+	for _, root := range cfg.AllowedRoots {
+		opts = append(opts, linker.WithAllowedRoot(root))
+	}
+	l := linker.NewLinker(newMatcher(), opts...)
+
+	runHooks("pre_load", cfg.Hooks.PreLoad)
+	changes, err := l.DevLoad(cfg.Dirs...)
+	if err != nil {
+		log.Fatalf("Error running in dev mode: %v", err)
+	}
+	runHooks("post_load", cfg.Hooks.PostLoad)
+	reportChanges(changes)
+}
+
 func init() {
 	commonFlags(loadCmd)
+	selectorFlags(loadCmd)
+	loadFlags(loadCmd)
+	rewriteFlags(loadCmd)
 	rootCmd.AddCommand(loadCmd)
 }
@@ -0,0 +1,51 @@
+package cmd
+
+import (
+	"log"
+	"terralink/internal/linker"
+
+	"github.com/spf13/cobra"
+)
+
+// migrateStateCmd represents the migrate-state command
+var migrateStateCmd = &cobra.Command{
+	Use:   "migrate-state [selector...]",
+	Short: "Upgrade the state annotations of loaded modules to the current format.",
+	Long: `The 'migrate-state' command rewrites the 'terralink-state' annotations written
+by older versions of terralink (v1, 'source="..." version="..."' with unescaped
+values) in the current v2 format, in place. Loaded modules stay loaded.
+
+v1 annotations are still read by every command, so migrating is only needed
+before values with quotes or escape sequences are stored, or to make a
+repository consistent.
+
+With --dry-run no file is written; a unified diff of the pending changes is printed instead.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loadConfig(cmd)
+		if dryRun {
+			log.Println("Planning migration of state annotations (dry run)...")
+		} else {
+			log.Println("Migrating state annotations...")
+		}
+
+		l := linker.NewLinker(newMatcher(),
+			linker.WithDryRun(dryRun),
+			linker.WithFormat(formatFiles),
+			linker.WithSelector(newSelector(args, profiles)),
+			linker.WithModuleRoots(cfg.ModuleRoots),
+			linker.WithLinks(newLinks()),
+		)
+		changes, err := l.MigrateState(cfg.Dirs...)
+		if err != nil {
+			log.Fatalf("Error during migration: %v", err)
+		}
+		reportChanges(changes)
+	},
+}
+
+func init() {
+	commonFlags(migrateStateCmd)
+	selectorFlags(migrateStateCmd)
+	rewriteFlags(migrateStateCmd)
+	rootCmd.AddCommand(migrateStateCmd)
+}
@@ -0,0 +1,109 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"terralink/internal/linker"
+
+	"github.com/spf13/cobra"
+)
+
+// pendingChangesExitCode is returned by load, unload and plan when
+// --exit-code is set and at least one file would be modified.
+const pendingChangesExitCode = 2
+
+// Output formats of the plan command.
+const (
+	planFormatText = "text"
+	planFormatJSON = "json"
+)
+
+var planUnload bool
+
+// planCmd previews the changes of load (or unload) without touching any file.
+var planCmd = &cobra.Command{
+	Use:   "plan [selector...]",
+	Short: "Preview the changes 'load' would make without writing any file.",
+	Long: `The 'plan' command is an alias for 'load --dry-run'. It runs the same rewriting
+in memory and prints a unified diff for every file that would change.
+Use --unload to preview 'unload' instead. Selectors work as for 'load'.
+
+Use --format json to get the changed files, with the number of modules and the
+diff of each, as a JSON array.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		if planFormat != planFormatText && planFormat != planFormatJSON {
+			log.Fatalf("Error: unknown format %q (expected text or json)", planFormat)
+		}
+		dryRun = true
+		if planUnload {
+			runUnload(cmd, args)
+			return
+		}
+		runLoad(cmd, args)
+	},
+}
+
+// reportChanges prints the diff of every changed file in dry-run mode, logs a
+// summary and honours --exit-code.
+func reportChanges(changes map[string]linker.FileChange) {
+	paths := make([]string, 0, len(changes))
+	modules := 0
+	for path, change := range changes {
+		paths = append(paths, path)
+		modules += change.Modules
+	}
+	sort.Strings(paths)
+
+	if dryRun {
+		if planFormat == planFormatJSON {
+			if err := writePlanJSON(os.Stdout, paths, changes); err != nil {
+				log.Panic(err)
+			}
+		} else {
+			for _, path := range paths {
+				if _, err := fmt.Fprint(os.Stdout, changes[path].Diff); err != nil {
+					log.Panic(err)
+				}
+			}
+		}
+		log.Printf("%d module(s) in %d file(s) would be changed.", modules, len(paths))
+	} else {
+		log.Printf("%d module(s) in %d file(s) changed.", modules, len(paths))
+	}
+
+	if exitCode && len(paths) > 0 {
+		os.Exit(pendingChangesExitCode)
+	}
+}
+
+// plannedChange is a file that would be changed, in the JSON output of plan.
+type plannedChange struct {
+	File    string `json:"file"`
+	Modules int    `json:"modules"`
+	Diff    string `json:"diff"`
+}
+
+// writePlanJSON writes the changes of the given files as a JSON array.
+func writePlanJSON(w io.Writer, paths []string, changes map[string]linker.FileChange) error {
+	planned := []plannedChange{}
+	for _, path := range paths {
+		planned = append(planned, plannedChange{File: path, Modules: changes[path].Modules, Diff: changes[path].Diff})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(planned)
+}
+
+func init() {
+	commonFlags(planCmd)
+	selectorFlags(planCmd)
+	loadFlags(planCmd)
+	planCmd.Flags().BoolVar(&planUnload, "unload", false, "Preview 'unload' instead of 'load'")
+	planCmd.Flags().StringVar(&planFormat, "format", planFormatText, "Output format: text (unified diff) or json")
+	planCmd.Flags().BoolVar(&exitCode, "exit-code", false, fmt.Sprintf("Exit with status %d when changes are pending", pendingChangesExitCode))
+	rootCmd.AddCommand(planCmd)
+}
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"bufio"
+	"fmt"
+	"log"
+	"os"
+	"strings"
+	"terralink/internal/linker"
+
+	"github.com/spf13/cobra"
+)
+
+// repairCmd represents the repair command
+var repairCmd = &cobra.Command{
+	Use:   "repair [selector...]",
+	Short: "Fix modules with broken terralink-state annotations.",
+	Long: `The 'repair' command finds modules whose 'terralink-state' annotations are
+malformed (e.g. mangled by a merge conflict), duplicated, or left without a dev
+annotation, and rewrites them to a clean unloaded state.
+
+The original source and version come from a valid 'terralink-state'
+annotation, else from the last committed version of the block in git, else
+from whatever can be salvaged from the malformed annotation. Modules whose
+original cannot be found are skipped with a warning.
+
+With --dry-run no file is written; a unified diff of the pending changes is
+printed instead. With --interactive every repair is confirmed first.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loadConfig(cmd)
+		if dryRun {
+			log.Println("Planning repair of state annotations (dry run)...")
+		} else {
+			log.Println("Repairing state annotations...")
+		}
+
+		var confirm linker.RepairConfirmFunc
+		if interactive {
+			confirm = confirmRepair(bufio.NewReader(os.Stdin))
+		}
+		l := linker.NewLinker(newMatcher(),
+			linker.WithDryRun(dryRun),
+			linker.WithFormat(formatFiles),
+			linker.WithSelector(newSelector(args, profiles)),
+			linker.WithModuleRoots(cfg.ModuleRoots),
+			linker.WithLinks(newLinks()),
+		)
+		changes, err := l.Repair(confirm, cfg.Dirs...)
+		if err != nil {
+			log.Fatalf("Error during repair: %v", err)
+		}
+		reportChanges(changes)
+	},
+}
+
+// confirmRepair returns a RepairConfirmFunc asking on stderr and reading the
+// answer from input. Only "y" and "yes" confirm.
+func confirmRepair(input *bufio.Reader) linker.RepairConfirmFunc {
+	return func(repair linker.ModuleRepair) bool {
+		_, err := fmt.Fprintf(os.Stderr, "\nModule '%s' (%s:%d):\n", repair.Module, repair.File, repair.Line)
+		if err != nil {
+			log.Panic(err)
+		}
+		for _, problem := range repair.Problems {
+			if _, err := fmt.Fprintf(os.Stderr, "  - %s\n", problem); err != nil {
+				log.Panic(err)
+			}
+		}
+		restored := fmt.Sprintf("source '%s'", repair.Source)
+		if repair.Version != "" {
+			restored += fmt.Sprintf(", version '%s'", repair.Version)
+		}
+		if _, err := fmt.Fprintf(os.Stderr, "Restore %s (from %s)? [y/N] ", restored, repair.Origin); err != nil {
+			log.Panic(err)
+		}
+
+		answer, _ := input.ReadString('\n')
+		answer = strings.ToLower(strings.TrimSpace(answer))
+		return answer == "y" || answer == "yes"
+	}
+}
+
+func init() {
+	commonFlags(repairCmd)
+	selectorFlags(repairCmd)
+	rewriteFlags(repairCmd)
+	repairCmd.Flags().BoolVarP(&interactive, "interactive", "i", false, "Confirm the repair of every module")
+	rootCmd.AddCommand(repairCmd)
+}
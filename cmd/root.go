@@ -4,6 +4,12 @@ import (
 	"fmt"
 	"log"
 	"os"
+	"path/filepath"
+	"strings"
+	"terralink/internal/config"
+	"terralink/internal/ignore"
+	"terralink/internal/linker"
+	"terralink/internal/report"
 
 	"github.com/spf13/cobra"
 )
@@ -20,8 +26,32 @@ It uses a simple annotation in your .tf files to manage the state,
 keeping your configuration clean and readable.`,
 	}
 
-	scanDir    string
-	ignoreFile string
+	scanDir      string
+	ignoreFile   string
+	includes     []string
+	excludes     []string
+	gitignore    bool
+	gitTracked   bool
+	dryRun       bool
+	exitCode     bool
+	formatFiles  bool
+	localPaths   []string
+	profiles     []string
+	gitRef       string
+	skipMissing  bool
+	allowedRoots []string
+	verifyIface  bool
+	outputFormat string
+	statusFormat string
+	planFormat   string
+	strict       bool
+	interactive  bool
+	reloadHooks  bool
+	staged       bool
+	checkRev     string
+
+	// cfg is the effective configuration, loaded by loadConfig.
+	cfg = config.Default()
 )
 
 // Execute adds all child commands to the root command and sets flags appropriately.
@@ -38,5 +68,110 @@ func Execute() {
 
 func commonFlags(cmd *cobra.Command) {
 	cmd.Flags().StringVar(&scanDir, "dir", ".", "Directory to scan for .tf files")
-	cmd.Flags().StringVar(&ignoreFile, "terralinkignore", ".", ".terralinkignore dir path")
+	cmd.Flags().StringVar(&ignoreFile, "terralinkignore", "", ".terralinkignore dir path (defaults to --dir)")
+	cmd.Flags().StringSliceVar(&includes, "include", nil, "Only scan files matching this gitignore-style glob, relative to --dir (repeatable)")
+	cmd.Flags().StringSliceVar(&excludes, "exclude", nil, "Skip paths matching this gitignore-style glob, relative to --dir (repeatable)")
+	cmd.Flags().BoolVar(&gitignore, "respect-gitignore", false, "Also skip paths ignored by .gitignore files and .git/info/exclude")
+	cmd.Flags().BoolVar(&gitTracked, "git-tracked-only", false, "Only scan files tracked by git")
+}
+
+// newMatcher builds the ignore matcher from the .terralinkignore files, the
+// configured ignore patterns and the --include flag.
+func newMatcher() *ignore.IgnoreMatcher {
+	rootDir := ignoreFile
+	if rootDir == "" {
+		rootDir = commonDir(cfg.Dirs)
+	}
+	matcher, err := ignore.NewMatcher(rootDir,
+		ignore.WithInclude(rootDir, includes),
+		ignore.WithExclude(cfg.IgnoreBase, cfg.Ignore),
+		ignore.WithGitignore(gitignore),
+		ignore.WithGitTrackedOnly(gitTracked),
+	)
+	if err != nil {
+		log.Fatalf("Error creating ignore matcher: %v", err)
+	}
+	return matcher
+}
+
+// commonDir returns the deepest directory containing every scan path.
+func commonDir(paths []string) string {
+	var common string
+	for _, path := range paths {
+		dir, err := filepath.Abs(path)
+		if err != nil {
+			continue
+		}
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		if common == "" {
+			common = dir
+			continue
+		}
+		for {
+			rel, err := filepath.Rel(common, dir)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			common = filepath.Dir(common)
+		}
+	}
+	if common == "" {
+		return "."
+	}
+	return common
+}
+
+func rewriteFlags(cmd *cobra.Command) {
+	cmd.Flags().BoolVar(&dryRun, "dry-run", false, "Print a unified diff of the changes instead of writing files")
+	cmd.Flags().BoolVar(&exitCode, "exit-code", false, fmt.Sprintf("Exit with status %d when files were (or would be) changed", pendingChangesExitCode))
+	cmd.Flags().BoolVar(&formatFiles, "fmt", false, "Format every rewritten .tf and .hcl file as a whole like 'terraform fmt'")
+}
+
+func loadFlags(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&gitRef, "ref", "", "Override the ref of modules annotated with 'git='")
+	cmd.Flags().BoolVar(&skipMissing, "skip-missing", false, "Skip modules whose local path is invalid with a warning instead of failing")
+	cmd.Flags().StringSliceVar(&allowedRoots, "allowed-root", nil, "Refuse local paths outside of this directory (repeatable)")
+	cmd.Flags().BoolVar(&verifyIface, "verify-interface", false, "Fail if a module's arguments or output references do not match the local module")
+}
+
+func selectorFlags(cmd *cobra.Command) {
+	cmd.Flags().StringSliceVar(&localPaths, "local-path", nil, "Only select modules whose annotation resolves to this local directory (repeatable)")
+	cmd.Flags().StringSliceVar(&profiles, "profile", nil, "Only select modules annotated with this profile (repeatable, comma separated)")
+}
+
+func formatFlag(cmd *cobra.Command) {
+	cmd.Flags().StringVar(&outputFormat, "format", string(report.FormatText), "Output format: text, json, sarif, junit, github or gitlab")
+}
+
+// newLinks reads the links files discovered with the configuration.
+func newLinks() *linker.Links {
+	links, err := linker.LoadLinks(cfg.LinkFiles...)
+	if err != nil {
+		log.Fatalf("Error loading links: %v", err)
+	}
+	return links
+}
+
+// newSelector builds the module selector from positional arguments, the
+// --local-path flag and the given profiles. Only load selects the configured
+// profiles by default (see loadProfiles); the other commands cover every
+// module unless --profile is passed.
+func newSelector(args []string, profiles []string) *linker.Selector {
+	selector, err := linker.NewSelector(args, localPaths, profiles)
+	if err != nil {
+		log.Fatalf("Error: %v", err)
+	}
+	return selector
+}
+
+// loadProfiles returns the profiles selected by load: those of --profile, or
+// else the configured ones unless modules are selected by name, file or
+// --local-path.
+func loadProfiles(cmd *cobra.Command, args []string) []string {
+	if !cmd.Flags().Changed("profile") && (len(args) > 0 || len(localPaths) > 0) {
+		return nil
+	}
+	return cfg.Profiles
 }
@@ -0,0 +1,176 @@
+package cmd
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"strings"
+	"terralink/internal/linker"
+	"text/tabwriter"
+
+	"github.com/spf13/cobra"
+)
+
+// Output formats of the status command.
+const (
+	statusFormatTable    = "table"
+	statusFormatJSON     = "json"
+	statusFormatMarkdown = "markdown"
+)
+
+// statusCmd represents the status command
+var statusCmd = &cobra.Command{
+	Use:   "status [selector...]",
+	Short: "List every module with its dev state.",
+	Long: `The 'status' command lists every module block under --dir with its location,
+its state, the annotated local path and whether it exists, its current source
+and the original source and version recorded while it is loaded.
+
+A module is 'unannotated' without a dev annotation, 'unloaded' when annotated
+and using its original source, 'loaded' when switched to its dev source, and
+'inconsistent' when its annotations and source disagree, e.g. after editing a
+loaded module by hand.
+
+Use --format json or markdown for machine-readable output or to paste the
+inventory into a pull request description. Positional arguments, --local-path
+and --profile select modules like for 'load'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loadConfig(cmd)
+
+		l := linker.NewLinker(newMatcher(), linker.WithSelector(newSelector(args, profiles)), linker.WithModuleRoots(cfg.ModuleRoots), linker.WithLinks(newLinks()))
+		statuses, err := l.Status(cfg.Dirs...)
+		if err != nil {
+			log.Fatalf("Error during status: %v", err)
+		}
+
+		switch statusFormat {
+		case statusFormatTable:
+			err = writeStatusTable(os.Stdout, statuses)
+		case statusFormatJSON:
+			err = writeStatusJSON(os.Stdout, statuses)
+		case statusFormatMarkdown:
+			err = writeStatusMarkdown(os.Stdout, statuses)
+		default:
+			log.Fatalf("Error: unknown format %q (expected table, json or markdown)", statusFormat)
+		}
+		if err != nil {
+			log.Fatalf("Error writing status: %v", err)
+		}
+	},
+}
+
+// statusLocation returns the file:line of a module.
+func statusLocation(status linker.ModuleStatus) string {
+	return fmt.Sprintf("%s:%d", status.File, status.Line)
+}
+
+// statusState returns the state of a module with the reason it is
+// inconsistent, if any.
+func statusState(status linker.ModuleStatus) string {
+	if status.Reason != "" {
+		return fmt.Sprintf("%s (%s)", status.State, status.Reason)
+	}
+	return string(status.State)
+}
+
+// statusLink returns the annotated local path or git address of a module.
+func statusLink(status linker.ModuleStatus) string {
+	if status.Git != "" {
+		return status.Git
+	}
+	return status.LocalPath
+}
+
+// statusExists reports whether the annotated local path of a module exists.
+func statusExists(status linker.ModuleStatus) string {
+	switch {
+	case status.LocalPath == "":
+		return "-"
+	case status.LocalPathExists:
+		return "yes"
+	}
+	return "no"
+}
+
+// statusOriginal returns the original source and version of a loaded module.
+func statusOriginal(status linker.ModuleStatus) string {
+	if status.OriginalVersion != "" {
+		return fmt.Sprintf("%s (%s)", status.OriginalSource, status.OriginalVersion)
+	}
+	return status.OriginalSource
+}
+
+// writeStatusTable writes the statuses as an aligned table.
+func writeStatusTable(w io.Writer, statuses []linker.ModuleStatus) error {
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	if _, err := fmt.Fprintln(tw, "LOCATION\tMODULE\tSTATE\tLOCAL PATH\tEXISTS\tSOURCE\tORIGINAL"); err != nil {
+		return err
+	}
+	for _, status := range statuses {
+		_, err := fmt.Fprintf(tw, "%s\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			statusLocation(status), status.Name, statusState(status), orDash(statusLink(status)),
+			statusExists(status), status.Source, orDash(statusOriginal(status)))
+		if err != nil {
+			return err
+		}
+	}
+	return tw.Flush()
+}
+
+// writeStatusJSON writes the statuses as an indented JSON array.
+func writeStatusJSON(w io.Writer, statuses []linker.ModuleStatus) error {
+	if statuses == nil {
+		statuses = []linker.ModuleStatus{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(statuses)
+}
+
+// writeStatusMarkdown writes the statuses as a Markdown table.
+func writeStatusMarkdown(w io.Writer, statuses []linker.ModuleStatus) error {
+	lines := []string{
+		"| Location | Module | State | Local path | Exists | Source | Original source | Original version |",
+		"| --- | --- | --- | --- | --- | --- | --- | --- |",
+	}
+	for _, status := range statuses {
+		cells := []string{
+			markdownCode(statusLocation(status)), markdownCode(status.Name), markdownText(statusState(status)),
+			markdownCode(statusLink(status)), statusExists(status), markdownCode(status.Source),
+			markdownCode(status.OriginalSource), markdownCode(status.OriginalVersion),
+		}
+		lines = append(lines, "| "+strings.Join(cells, " | ")+" |")
+	}
+	_, err := fmt.Fprintln(w, strings.Join(lines, "\n"))
+	return err
+}
+
+// markdownCode formats a table cell value as inline code.
+func markdownCode(value string) string {
+	if value == "" {
+		return ""
+	}
+	return "`" + markdownText(strings.ReplaceAll(value, "`", "'")) + "`"
+}
+
+// markdownText escapes the characters that would break a table cell.
+func markdownText(value string) string {
+	return strings.ReplaceAll(value, "|", `\|`)
+}
+
+// orDash returns value, or "-" for an empty table cell.
+func orDash(value string) string {
+	if value == "" {
+		return "-"
+	}
+	return value
+}
+
+func init() {
+	commonFlags(statusCmd)
+	selectorFlags(statusCmd)
+	statusCmd.Flags().StringVar(&statusFormat, "format", statusFormatTable, "Output format: table, json or markdown")
+	rootCmd.AddCommand(statusCmd)
+}
@@ -2,7 +2,6 @@ package cmd
 
 import (
 	"log"
-	"terralink/internal/ignore"
 	"terralink/internal/linker"
 
 	"github.com/spf13/cobra"
@@ -10,26 +9,51 @@ import (
 
 // unloadCmd represents the prod command
 var unloadCmd = &cobra.Command{
-	Use:   "unload",
+	Use:   "unload [selector...]",
 	Short: "unload local modules and restore remote sources",
 	Long: `The 'unload' command restores modules to their original remote source.
 It reads the state from the 'terralink-state' comment, reverts the changes,
-and removes the temporary state comment, cleaning the file for production.`,
+and removes the temporary state comment, cleaning the file for production.
+
+With --dry-run no file is written; a unified diff of the pending changes is printed instead.
+
+Positional arguments restrict the command to matching modules: module names,
+globs such as 'aws_*', or .tf/.tf.json/.hcl files. --local-path selects every
+module whose annotation resolves to the given directory and --profile every
+module annotated with 'profile=<name>'. Selectors of the same kind are OR-ed,
+different kinds are AND-ed.`,
 	Run: func(cmd *cobra.Command, args []string) {
-		log.Println("Unloading dev mode...")
-		matcher, err := ignore.NewMatcher(ignoreFile)
-		if err != nil {
-			log.Fatalf("Error creating ignore matcher: %v", err)
-		}
-		l := linker.NewLinker(matcher)
-		_, err = l.DevUnload(scanDir)
-		if err != nil {
-			log.Fatalf("Error running in reset mode: %v", err)
-		}
+		runUnload(cmd, args)
 	},
 }
 
+func runUnload(cmd *cobra.Command, args []string) {
+	loadConfig(cmd)
+	if dryRun {
+		log.Println("Planning unload of dev mode (dry run)...")
+	} else {
+		log.Println("Unloading dev mode...")
+	}
+	l := linker.NewLinker(newMatcher(),
+		linker.WithDryRun(dryRun),
+		linker.WithFormat(formatFiles),
+		linker.WithSelector(newSelector(args, profiles)),
+		linker.WithModuleRoots(cfg.ModuleRoots),
+		linker.WithLinks(newLinks()),
+	)
+
+	runHooks("pre_unload", cfg.Hooks.PreUnload)
+	changes, err := l.DevUnload(cfg.Dirs...)
+	if err != nil {
+		log.Fatalf("Error running in reset mode: %v", err)
+	}
+	runHooks("post_unload", cfg.Hooks.PostUnload)
+	reportChanges(changes)
+}
+
 func init() {
 	commonFlags(unloadCmd)
+	selectorFlags(unloadCmd)
+	rewriteFlags(unloadCmd)
 	rootCmd.AddCommand(unloadCmd)
 }
@@ -0,0 +1,100 @@
+package cmd
+
+import (
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"terralink/internal/linker"
+	"terralink/internal/report"
+
+	"github.com/spf13/cobra"
+)
+
+// verifyCmd represents the verify command
+var verifyCmd = &cobra.Command{
+	Use:   "verify [selector...]",
+	Short: "Check that modules match the interface of their local path.",
+	Long: `The 'verify' command compares every module annotated with a local path with
+the 'variable' and 'output' blocks of that local module. It reports required
+variables the module block does not set, arguments the local module does not
+declare, and 'module.<name>.<output>' references in the root module to outputs
+the local module does not declare. It exits with a non-zero status code if any
+incompatibility is found. No file is changed.
+
+Use --format to emit the findings as json, sarif, junit, github or gitlab
+(Code Quality) output on stdout for CI systems.
+
+Selectors work as for 'load'.`,
+	Run: func(cmd *cobra.Command, args []string) {
+		loadConfig(cmd)
+		format, err := report.ParseFormat(cfg.Format)
+		if err != nil {
+			log.Fatalf("Error: %v", err)
+		}
+
+		log.Println("Verifying module interfaces against local paths...")
+		l := linker.NewLinker(newMatcher(), linker.WithSelector(newSelector(args, profiles)), linker.WithModuleRoots(cfg.ModuleRoots), linker.WithLinks(newLinks()))
+		diagnostics, err := l.Verify(cfg.Dirs...)
+		if err != nil {
+			log.Fatalf("Error during verify: %v", err)
+		}
+		findings := interfaceFindings(diagnostics)
+
+		if format != report.FormatText {
+			if err := report.Write(os.Stdout, format, findings); err != nil {
+				log.Fatalf("Error writing report: %v", err)
+			}
+			if len(findings) > 0 {
+				os.Exit(1)
+			}
+			return
+		}
+
+		if len(findings) > 0 {
+			_, err = fmt.Fprintln(os.Stderr, "\n❌ Error: Found interface incompatibilities")
+			if err != nil {
+				log.Panic(err)
+			}
+
+			if err := report.Write(os.Stderr, report.FormatText, findings); err != nil {
+				log.Panic(err)
+			}
+
+			os.Exit(1)
+		}
+
+		log.Println("✅ Success! All modules match their local paths.")
+	},
+}
+
+// interfaceFindings converts the result of Linker.Verify into report
+// findings, ordered by file and line.
+func interfaceFindings(diagnostics []linker.InterfaceDiagnostic) []report.Finding {
+	var findings []report.Finding
+	for _, diagnostic := range diagnostics {
+		findings = append(findings, report.Finding{
+			Rule:      diagnostic.Rule,
+			Message:   diagnostic.Message,
+			File:      diagnostic.File,
+			Line:      diagnostic.Line,
+			Column:    diagnostic.Column,
+			Module:    diagnostic.Module,
+			LocalPath: diagnostic.LocalPath,
+		})
+	}
+	sort.SliceStable(findings, func(i, j int) bool {
+		if findings[i].File != findings[j].File {
+			return findings[i].File < findings[j].File
+		}
+		return findings[i].Line < findings[j].Line
+	})
+	return findings
+}
+
+func init() {
+	commonFlags(verifyCmd)
+	selectorFlags(verifyCmd)
+	formatFlag(verifyCmd)
+	rootCmd.AddCommand(verifyCmd)
+}
@@ -0,0 +1,341 @@
+// Package config reads the project configuration of terralink from
+// .terralink.hcl files and merges it with environment variables and command
+// line flags, remembering where every value came from.
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// FileName is the name of the configuration files discovered by Load.
+const FileName = ".terralink.hcl"
+
+// LinksFileName is the name of the personal links files discovered by Load.
+// They map module sources to local checkouts and are meant to be git-ignored.
+const LinksFileName = ".terralink.local.hcl"
+
+// Setting names, as written in the configuration file.
+const (
+	KeyDirs         = "dirs"
+	KeyIgnore       = "ignore"
+	KeyModuleRoots  = "module_roots"
+	KeyProfiles     = "profiles"
+	KeyFormat       = "format"
+	KeyAllowedRoots = "allowed_roots"
+	KeyPreLoad      = "hooks.pre_load"
+	KeyPostLoad     = "hooks.post_load"
+	KeyPreUnload    = "hooks.pre_unload"
+	KeyPostUnload   = "hooks.post_unload"
+)
+
+// Keys lists every setting in the order they are shown.
+var Keys = []string{
+	KeyDirs, KeyIgnore, KeyModuleRoots, KeyProfiles, KeyFormat, KeyAllowedRoots,
+	KeyPreLoad, KeyPostLoad, KeyPreUnload, KeyPostUnload,
+}
+
+// SourceDefault is the source of settings that were not configured.
+const SourceDefault = "default"
+
+// Config is the effective configuration of a terralink run. Relative paths
+// are resolved when a value is set: against the directory of the
+// configuration file that sets it, or against the current directory for
+// environment variables and flags.
+type Config struct {
+	// Dirs are the directories scanned by default.
+	Dirs []string
+	// Ignore are gitignore patterns of paths to skip, relative to IgnoreBase.
+	Ignore     []string
+	IgnoreBase string
+	// ModuleRoots maps names to directories that dev annotations can refer
+	// to as "@name/sub/dir".
+	ModuleRoots map[string]string
+	// Profiles are the profiles selected by default.
+	Profiles []string
+	// Format is the default output format of check and verify.
+	Format string
+	// AllowedRoots are the directories annotated local paths must stay in.
+	AllowedRoots []string
+	// Hooks are shell commands run around load and unload.
+	Hooks Hooks
+
+	// Files lists the configuration files that were read, farthest first.
+	Files []string
+	// LinkFiles lists the existing links files: the user's, then the ones
+	// discovered like configuration files, farthest first.
+	LinkFiles []string
+	// Sources maps each setting name to where its value came from.
+	Sources map[string]string
+}
+
+// Hooks are shell commands run before and after load and unload.
+type Hooks struct {
+	PreLoad    []string
+	PostLoad   []string
+	PreUnload  []string
+	PostUnload []string
+}
+
+// Default returns the configuration used when nothing is configured.
+func Default() *Config {
+	c := &Config{
+		Dirs:        []string{"."},
+		IgnoreBase:  ".",
+		ModuleRoots: map[string]string{},
+		Format:      "text",
+		Sources:     map[string]string{},
+	}
+	for _, key := range Keys {
+		c.Sources[key] = SourceDefault
+	}
+	return c
+}
+
+// Discover returns the configuration files found walking up from startDir
+// to the root of the git repository containing it (or to the filesystem
+// root outside of a repository), farthest first.
+func Discover(startDir string) ([]string, error) {
+	return discoverFiles(startDir, FileName)
+}
+
+// DiscoverLinks returns the existing links files: the user's links file
+// first, then the LinksFileName files discovered from startDir like
+// configuration files, farthest first.
+func DiscoverLinks(startDir string) ([]string, error) {
+	var files []string
+	if path := UserLinksFile(); path != "" {
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append(files, path)
+		}
+	}
+	discovered, err := discoverFiles(startDir, LinksFileName)
+	if err != nil {
+		return nil, err
+	}
+	return append(files, discovered...), nil
+}
+
+// UserLinksFile returns the path of the user's links file,
+// "terralink/links.hcl" in the user configuration directory (e.g.
+// ~/.config/terralink/links.hcl), or an empty string if there is none.
+func UserLinksFile() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return ""
+	}
+	return filepath.Join(dir, "terralink", "links.hcl")
+}
+
+// discoverFiles returns the files called name found walking up from
+// startDir to the root of the git repository, farthest first.
+func discoverFiles(startDir, name string) ([]string, error) {
+	dir, err := filepath.Abs(startDir)
+	if err != nil {
+		return nil, err
+	}
+	if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+		dir = filepath.Dir(dir)
+	}
+
+	var files []string
+	for {
+		path := filepath.Join(dir, name)
+		if info, err := os.Stat(path); err == nil && !info.IsDir() {
+			files = append([]string{path}, files...)
+		}
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			break
+		}
+		parent := filepath.Dir(dir)
+		if parent == dir {
+			break
+		}
+		dir = parent
+	}
+	return files, nil
+}
+
+// Load builds the configuration from the defaults and every configuration
+// file discovered from startDir. Nearer files override the settings of
+// farther ones; module roots are merged by name. The links files are only
+// discovered, reading them is up to the linker.
+func Load(startDir string) (*Config, error) {
+	c := Default()
+	files, err := Discover(startDir)
+	if err != nil {
+		return nil, err
+	}
+	for _, path := range files {
+		if err := c.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	if c.LinkFiles, err = DiscoverLinks(startDir); err != nil {
+		return nil, err
+	}
+	return c, nil
+}
+
+// loadFile applies the settings of a single configuration file.
+func (c *Config) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	file, diags := hclsyntax.ParseConfig(content, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse HCL in %s: %w", path, diags)
+	}
+	c.Files = append(c.Files, path)
+
+	base := filepath.Dir(path)
+	body := file.Body.(*hclsyntax.Body)
+	for _, attr := range sortedAttributes(body.Attributes) {
+		if err := c.setAttribute(attr.Name, attr, base); err != nil {
+			return err
+		}
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "hooks" || len(block.Labels) != 0 {
+			return fmt.Errorf("%s: unsupported block %q", block.TypeRange, block.Type)
+		}
+		for _, attr := range sortedAttributes(block.Body.Attributes) {
+			if err := c.setAttribute("hooks."+attr.Name, attr, base); err != nil {
+				return err
+			}
+		}
+		if len(block.Body.Blocks) > 0 {
+			return fmt.Errorf("%s: unsupported block %q", block.Body.Blocks[0].TypeRange, block.Body.Blocks[0].Type)
+		}
+	}
+	return nil
+}
+
+// sortedAttributes returns the attributes of a body in source order.
+func sortedAttributes(attributes hclsyntax.Attributes) []*hclsyntax.Attribute {
+	sorted := make([]*hclsyntax.Attribute, 0, len(attributes))
+	for _, attr := range attributes {
+		sorted = append(sorted, attr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].SrcRange.Start.Byte < sorted[j].SrcRange.Start.Byte
+	})
+	return sorted
+}
+
+// setAttribute decodes a setting from a configuration file attribute.
+func (c *Config) setAttribute(key string, attr *hclsyntax.Attribute, base string) error {
+	source := fmt.Sprintf("%s:%d", attr.SrcRange.Filename, attr.SrcRange.Start.Line)
+	fail := func(expected string) error {
+		return fmt.Errorf("%s: %s must be %s", attr.NameRange, key, expected)
+	}
+
+	value, diags := attr.Expr.Value(nil)
+	if diags.HasErrors() {
+		return fmt.Errorf("%s: %w", attr.NameRange, diags)
+	}
+
+	switch key {
+	case KeyFormat:
+		converted, err := convert.Convert(value, cty.String)
+		if err != nil || converted.IsNull() {
+			return fail("a string")
+		}
+		return c.Set(key, []string{converted.AsString()}, base, source)
+	case KeyModuleRoots:
+		converted, err := convert.Convert(value, cty.Map(cty.String))
+		if err != nil || converted.IsNull() {
+			return fail("a map of strings")
+		}
+		var pairs []string
+		for name, path := range converted.AsValueMap() {
+			pairs = append(pairs, name+"="+path.AsString())
+		}
+		sort.Strings(pairs)
+		return c.Set(key, pairs, base, source)
+	case KeyDirs, KeyIgnore, KeyProfiles, KeyAllowedRoots, KeyPreLoad, KeyPostLoad, KeyPreUnload, KeyPostUnload:
+		converted, err := convert.Convert(value, cty.List(cty.String))
+		if err != nil || converted.IsNull() {
+			return fail("a list of strings")
+		}
+		var values []string
+		for _, element := range converted.AsValueSlice() {
+			values = append(values, element.AsString())
+		}
+		return c.Set(key, values, base, source)
+	}
+	return fmt.Errorf("%s: unsupported setting %q", attr.NameRange, key)
+}
+
+// Set overrides a setting, resolving relative paths against base and
+// recording source as its origin. Module roots are given as "name=path"
+// pairs and are merged with the ones already set.
+func (c *Config) Set(key string, values []string, base, source string) error {
+	switch key {
+	case KeyDirs:
+		// No directory would mean nothing to scan, and check passing silently.
+		if len(values) == 0 {
+			return fmt.Errorf("%s: %s must list at least one directory", source, key)
+		}
+		c.Dirs = resolvePaths(values, base)
+	case KeyIgnore:
+		c.Ignore = values
+		c.IgnoreBase = base
+	case KeyModuleRoots:
+		for _, pair := range values {
+			name, path, found := strings.Cut(pair, "=")
+			if !found || name == "" || path == "" {
+				return fmt.Errorf("%s: invalid module root %q (expected name=path)", source, pair)
+			}
+			c.ModuleRoots[name] = resolvePath(path, base)
+		}
+	case KeyProfiles:
+		c.Profiles = values
+	case KeyFormat:
+		if len(values) != 1 {
+			return fmt.Errorf("%s: %s must be a single value", source, key)
+		}
+		c.Format = values[0]
+	case KeyAllowedRoots:
+		c.AllowedRoots = resolvePaths(values, base)
+	case KeyPreLoad:
+		c.Hooks.PreLoad = values
+	case KeyPostLoad:
+		c.Hooks.PostLoad = values
+	case KeyPreUnload:
+		c.Hooks.PreUnload = values
+	case KeyPostUnload:
+		c.Hooks.PostUnload = values
+	default:
+		return fmt.Errorf("%s: unsupported setting %q", source, key)
+	}
+	c.Sources[key] = source
+	return nil
+}
+
+// resolvePaths resolves every path against base.
+func resolvePaths(paths []string, base string) []string {
+	resolved := make([]string, len(paths))
+	for i, path := range paths {
+		resolved[i] = resolvePath(path, base)
+	}
+	return resolved
+}
+
+// resolvePath resolves a relative path against base. Paths given relative to
+// the current directory are kept relative.
+func resolvePath(path, base string) string {
+	if filepath.IsAbs(path) || base == "." || base == "" {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(base, path)
+}
@@ -0,0 +1,187 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const rootConfigHCL = `
+dirs          = ["live", "modules"]
+ignore        = ["sandbox/"]
+format        = "github"
+allowed_roots = ["../shared"]
+module_roots  = { aws = "../aws-modules", gcp = "../gcp-modules" }
+
+hooks {
+  pre_load  = ["terraform fmt -recursive"]
+  post_load = ["echo loaded"]
+}
+`
+
+const nestedConfigHCL = `
+profiles     = ["networking"]
+format       = "sarif"
+module_roots = { aws = "../../aws-fork" }
+`
+
+// writeConfigTree creates a git repository with a root and a nested
+// configuration file, and returns the repository and the nested directory.
+func writeConfigTree(t *testing.T) (string, string) {
+	t.Helper()
+	parent := t.TempDir()
+	repoDir := filepath.Join(parent, "repo")
+	nestedDir := filepath.Join(repoDir, "live", "dev")
+	require.NoError(t, os.MkdirAll(filepath.Join(repoDir, ".git"), 0755))
+	require.NoError(t, os.MkdirAll(nestedDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(parent, FileName), []byte(`format = "json"`), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, FileName), []byte(rootConfigHCL), 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, "live", FileName), []byte(nestedConfigHCL), 0644))
+	return repoDir, nestedDir
+}
+
+func TestConfig_Load(t *testing.T) {
+	repoDir, nestedDir := writeConfigTree(t)
+	rootFile := filepath.Join(repoDir, FileName)
+	nestedFile := filepath.Join(repoDir, "live", FileName)
+
+	c, err := Load(nestedDir)
+	require.NoError(t, err)
+
+	// The file above the repository root is not read.
+	assert.Equal(t, []string{rootFile, nestedFile}, c.Files)
+
+	assert.Equal(t, []string{filepath.Join(repoDir, "live"), filepath.Join(repoDir, "modules")}, c.Dirs)
+	assert.Equal(t, []string{"sandbox/"}, c.Ignore)
+	assert.Equal(t, repoDir, c.IgnoreBase)
+	assert.Equal(t, []string{"networking"}, c.Profiles)
+	assert.Equal(t, "sarif", c.Format)
+	assert.Equal(t, []string{filepath.Join(filepath.Dir(repoDir), "shared")}, c.AllowedRoots)
+	assert.Equal(t, map[string]string{
+		"aws": filepath.Join(filepath.Dir(repoDir), "aws-fork"),
+		"gcp": filepath.Join(filepath.Dir(repoDir), "gcp-modules"),
+	}, c.ModuleRoots)
+	assert.Equal(t, []string{"terraform fmt -recursive"}, c.Hooks.PreLoad)
+	assert.Equal(t, []string{"echo loaded"}, c.Hooks.PostLoad)
+	assert.Empty(t, c.Hooks.PreUnload)
+
+	assert.Equal(t, rootFile+":2", c.Sources[KeyDirs])
+	assert.Equal(t, nestedFile+":3", c.Sources[KeyFormat])
+	assert.Equal(t, nestedFile+":4", c.Sources[KeyModuleRoots])
+	assert.Equal(t, rootFile+":9", c.Sources[KeyPreLoad])
+	assert.Equal(t, SourceDefault, c.Sources[KeyPreUnload])
+}
+
+func TestConfig_LoadWithoutFile(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	dir := t.TempDir()
+	require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+
+	c, err := Load(dir)
+	require.NoError(t, err)
+	assert.Empty(t, c.Files)
+	assert.Equal(t, Default(), c)
+}
+
+func TestConfig_DiscoverLinks(t *testing.T) {
+	t.Setenv("HOME", t.TempDir())
+	t.Setenv("XDG_CONFIG_HOME", t.TempDir())
+	repoDir, nestedDir := writeConfigTree(t)
+
+	files, err := DiscoverLinks(nestedDir)
+	require.NoError(t, err)
+	assert.Empty(t, files)
+
+	userFile := UserLinksFile()
+	require.NoError(t, os.MkdirAll(filepath.Dir(userFile), 0755))
+	require.NoError(t, os.WriteFile(userFile, nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(repoDir, LinksFileName), nil, 0644))
+	require.NoError(t, os.WriteFile(filepath.Join(nestedDir, LinksFileName), nil, 0644))
+
+	c, err := Load(nestedDir)
+	require.NoError(t, err)
+	assert.Equal(t, []string{
+		userFile,
+		filepath.Join(repoDir, LinksFileName),
+		filepath.Join(nestedDir, LinksFileName),
+	}, c.LinkFiles)
+}
+
+func TestConfig_LoadErrors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{"Unknown setting", `colour = "red"`, `unsupported setting "colour"`},
+		{"Wrong type", `dirs = "live"`, "dirs must be a list of strings"},
+		{"Empty dirs", `dirs = []`, "dirs must list at least one directory"},
+		{"Unknown block", `profile "x" {}`, `unsupported block "profile"`},
+		{"Unknown hook", "hooks {\n  on_load = []\n}", `unsupported setting "hooks.on_load"`},
+		{"Invalid HCL", `dirs = [`, "failed to parse HCL"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			require.NoError(t, os.MkdirAll(filepath.Join(dir, ".git"), 0755))
+			require.NoError(t, os.WriteFile(filepath.Join(dir, FileName), []byte(tc.content), 0644))
+
+			_, err := Load(dir)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestConfig_ApplyEnv(t *testing.T) {
+	_, nestedDir := writeConfigTree(t)
+	c, err := Load(nestedDir)
+	require.NoError(t, err)
+
+	env := map[string]string{
+		"TERRALINK_FORMAT":          "json",
+		"TERRALINK_PROFILES":        "platform, gcp",
+		"TERRALINK_MODULE_ROOTS":    "azure=/src/azure-modules",
+		"TERRALINK_HOOKS_POST_LOAD": "echo one, two\necho three",
+	}
+	require.NoError(t, c.ApplyEnv(func(name string) (string, bool) {
+		value, found := env[name]
+		return value, found
+	}))
+
+	assert.Equal(t, "json", c.Format)
+	assert.Equal(t, "env TERRALINK_FORMAT", c.Sources[KeyFormat])
+	assert.Equal(t, []string{"platform", "gcp"}, c.Profiles)
+	assert.Equal(t, filepath.Clean("/src/azure-modules"), c.ModuleRoots["azure"])
+	assert.Contains(t, c.ModuleRoots, "gcp")
+	assert.Equal(t, []string{"echo one, two", "echo three"}, c.Hooks.PostLoad)
+
+	err = c.ApplyEnv(func(name string) (string, bool) {
+		return "invalid", name == "TERRALINK_MODULE_ROOTS"
+	})
+	assert.ErrorContains(t, err, `invalid module root "invalid"`)
+
+	// An empty list of directories would make check scan nothing and pass.
+	err = c.ApplyEnv(func(name string) (string, bool) {
+		return "", name == "TERRALINK_DIRS"
+	})
+	assert.ErrorContains(t, err, "env TERRALINK_DIRS: dirs must list at least one directory")
+	assert.NotEmpty(t, c.Dirs)
+}
+
+func TestConfig_Settings(t *testing.T) {
+	c := Default()
+	require.NoError(t, c.Set(KeyDirs, []string{"live"}, ".", "flag --dir"))
+	require.NoError(t, c.Set(KeyModuleRoots, []string{"b=/b", "a=/a"}, ".", "flag"))
+
+	settings := c.Settings()
+	require.Len(t, settings, len(Keys))
+	assert.Equal(t, Setting{Key: KeyDirs, Value: `["live"]`, Source: "flag --dir"}, settings[0])
+	assert.Equal(t, Setting{Key: KeyIgnore, Value: `[]`, Source: SourceDefault}, settings[1])
+	assert.Equal(t, `{ a = "/a", b = "/b" }`, settings[2].Value)
+	assert.Equal(t, `"text"`, settings[4].Value)
+}
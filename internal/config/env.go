@@ -0,0 +1,107 @@
+package config
+
+import (
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// EnvPrefix is the prefix of the environment variables overriding settings.
+const EnvPrefix = "TERRALINK_"
+
+// EnvName returns the environment variable overriding a setting, e.g.
+// TERRALINK_ALLOWED_ROOTS or TERRALINK_HOOKS_PRE_LOAD.
+func EnvName(key string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(key, ".", "_"))
+}
+
+// ApplyEnv overrides the settings that have an environment variable set.
+// Lists are comma separated, except hook commands which are one per line;
+// module roots are given as "name=path" pairs. Relative paths are resolved
+// against the current directory.
+func (c *Config) ApplyEnv(lookup func(string) (string, bool)) error {
+	for _, key := range Keys {
+		name := EnvName(key)
+		value, found := lookup(name)
+		if !found {
+			continue
+		}
+		separator := ","
+		if strings.HasPrefix(key, "hooks.") {
+			separator = "\n"
+		}
+		var values []string
+		for _, element := range strings.Split(value, separator) {
+			if element = strings.TrimSpace(element); element != "" {
+				values = append(values, element)
+			}
+		}
+		if err := c.Set(key, values, ".", "env "+name); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// Setting is a single setting of the effective configuration.
+type Setting struct {
+	Key string
+	// Value is the setting rendered in configuration file syntax.
+	Value  string
+	Source string
+}
+
+// Settings returns every setting of the configuration with its source.
+func (c *Config) Settings() []Setting {
+	settings := make([]Setting, 0, len(Keys))
+	for _, key := range Keys {
+		settings = append(settings, Setting{Key: key, Value: c.render(key), Source: c.Sources[key]})
+	}
+	return settings
+}
+
+// render returns the value of a setting in configuration file syntax.
+func (c *Config) render(key string) string {
+	switch key {
+	case KeyDirs:
+		return renderList(c.Dirs)
+	case KeyIgnore:
+		return renderList(c.Ignore)
+	case KeyModuleRoots:
+		names := make([]string, 0, len(c.ModuleRoots))
+		for name := range c.ModuleRoots {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		pairs := make([]string, len(names))
+		for i, name := range names {
+			pairs[i] = fmt.Sprintf("%s = %s", name, strconv.Quote(c.ModuleRoots[name]))
+		}
+		return "{ " + strings.Join(pairs, ", ") + " }"
+	case KeyProfiles:
+		return renderList(c.Profiles)
+	case KeyFormat:
+		return strconv.Quote(c.Format)
+	case KeyAllowedRoots:
+		return renderList(c.AllowedRoots)
+	case KeyPreLoad:
+		return renderList(c.Hooks.PreLoad)
+	case KeyPostLoad:
+		return renderList(c.Hooks.PostLoad)
+	case KeyPreUnload:
+		return renderList(c.Hooks.PreUnload)
+	case KeyPostUnload:
+		return renderList(c.Hooks.PostUnload)
+	}
+	return ""
+}
+
+// renderList renders a list of strings in configuration file syntax.
+func renderList(values []string) string {
+	quoted := make([]string, len(values))
+	for i, value := range values {
+		quoted[i] = strconv.Quote(value)
+	}
+	return "[" + strings.Join(quoted, ", ") + "]"
+}
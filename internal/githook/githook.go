@@ -0,0 +1,205 @@
+// Package githook installs terralink into the hooks of a git repository,
+// chaining with the hooks that are already there.
+package githook
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// Hooks managed by terralink.
+const (
+	PreCommit    = "pre-commit"
+	PostCheckout = "post-checkout"
+	PostMerge    = "post-merge"
+)
+
+// Names lists every hook managed by terralink.
+var Names = []string{PreCommit, PostCheckout, PostMerge}
+
+// marker identifies the hooks written by terralink.
+const marker = "# Installed by terralink; manage it with 'terralink hook'."
+
+// ChainedSuffix is appended to the name of a hook that existed before
+// terralink's was installed. terralink's hook runs it first and restores it
+// when uninstalled.
+const ChainedSuffix = ".terralink-chained"
+
+// safeArgRegex matches the arguments that need no quoting in a shell script.
+var safeArgRegex = regexp.MustCompile(`^[A-Za-z0-9_@%+=:,./-]+$`)
+
+// Status describes a hook of a repository.
+type Status struct {
+	Name string
+	Path string
+	// Installed is true if the hook was written by terralink, and Command is
+	// then the terralink command it runs.
+	Installed bool
+	Command   string
+	// Foreign is true if another hook is installed in place of terralink's.
+	Foreign bool
+	// Chained is the path of the previous hook terralink's hook runs first,
+	// if any.
+	Chained string
+}
+
+// RepoRoot returns the top-level directory of the git repository containing
+// dir, where git runs hooks.
+func RepoRoot(dir string) (string, error) {
+	return git(dir, "rev-parse", "--show-toplevel")
+}
+
+// HooksDir returns the hooks directory of the git repository containing
+// dir, honouring core.hooksPath.
+func HooksDir(dir string) (string, error) {
+	hooksDir, err := git(dir, "rev-parse", "--git-path", "hooks")
+	if err != nil {
+		return "", err
+	}
+	if !filepath.IsAbs(hooksDir) {
+		hooksDir = filepath.Join(dir, hooksDir)
+	}
+	return filepath.Abs(hooksDir)
+}
+
+// git runs a git command in dir and returns its trimmed output.
+func git(dir string, args ...string) (string, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return "", fmt.Errorf("git %s failed in %s: %w: %s", strings.Join(args, " "), dir, err, strings.TrimSpace(stderr.String()))
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// Install writes the hook called name to hooksDir, running terralink with
+// the given arguments. A hook that was not written by terralink is renamed
+// with ChainedSuffix and run first; a hook written by terralink is replaced.
+// It returns the path of the chained hook, if any.
+func Install(hooksDir, name string, args []string) (string, error) {
+	path := filepath.Join(hooksDir, name)
+	chained := path + ChainedSuffix
+
+	status, err := Stat(hooksDir, name)
+	if err != nil {
+		return "", err
+	}
+	if status.Foreign {
+		if _, err := os.Stat(chained); err == nil {
+			return "", fmt.Errorf("cannot chain %s: %s already exists", path, chained)
+		}
+		if err := os.Rename(path, chained); err != nil {
+			return "", fmt.Errorf("failed to chain %s: %w", path, err)
+		}
+		status.Chained = chained
+	}
+
+	if err := os.MkdirAll(hooksDir, 0755); err != nil {
+		return "", fmt.Errorf("failed to create %s: %w", hooksDir, err)
+	}
+	if err := os.WriteFile(path, []byte(script(name, args)), 0755); err != nil {
+		return "", fmt.Errorf("failed to write %s: %w", path, err)
+	}
+	// WriteFile keeps the mode of an existing file.
+	if err := os.Chmod(path, 0755); err != nil {
+		return "", fmt.Errorf("failed to make %s executable: %w", path, err)
+	}
+	return status.Chained, nil
+}
+
+// Uninstall removes the hook called name from hooksDir if it was written by
+// terralink, and restores the hook it chained. It returns false if
+// terralink's hook was not installed.
+func Uninstall(hooksDir, name string) (bool, error) {
+	status, err := Stat(hooksDir, name)
+	if err != nil || !status.Installed {
+		return false, err
+	}
+	if err := os.Remove(status.Path); err != nil {
+		return false, fmt.Errorf("failed to remove %s: %w", status.Path, err)
+	}
+	if status.Chained != "" {
+		if err := os.Rename(status.Chained, status.Path); err != nil {
+			return true, fmt.Errorf("failed to restore %s: %w", status.Chained, err)
+		}
+	}
+	return true, nil
+}
+
+// Stat returns the status of the hook called name in hooksDir.
+func Stat(hooksDir, name string) (Status, error) {
+	status := Status{Name: name, Path: filepath.Join(hooksDir, name)}
+	content, err := os.ReadFile(status.Path)
+	if errors.Is(err, os.ErrNotExist) {
+		return status, nil
+	}
+	if err != nil {
+		return status, fmt.Errorf("failed to read %s: %w", status.Path, err)
+	}
+
+	if !bytes.Contains(content, []byte(marker)) {
+		status.Foreign = true
+		return status, nil
+	}
+	status.Installed = true
+	for _, line := range strings.Split(string(content), "\n") {
+		if strings.HasPrefix(line, "terralink ") {
+			status.Command = line
+		}
+	}
+	if _, err := os.Stat(status.Path + ChainedSuffix); err == nil {
+		status.Chained = status.Path + ChainedSuffix
+	}
+	return status, nil
+}
+
+// script returns the content of terralink's hook called name.
+func script(name string, args []string) string {
+	lines := []string{
+		"#!/bin/sh",
+		marker,
+		"",
+		`if [ -x "$0` + ChainedSuffix + `" ]; then`,
+		`  "$0` + ChainedSuffix + `" "$@" || exit $?`,
+		"fi",
+	}
+	if name == PostCheckout {
+		lines = append(lines,
+			"",
+			"# Only after switching branches, not after checking out files.",
+			`[ "$3" = "1" ] || exit 0`,
+		)
+	}
+	lines = append(lines,
+		"",
+		"if ! command -v terralink >/dev/null 2>&1; then",
+		`  echo "terralink `+name+` hook: terralink is not installed or not in PATH" >&2`,
+		"  exit 1",
+		"fi",
+		"terralink "+quoteArgs(args),
+		"",
+	)
+	return strings.Join(lines, "\n")
+}
+
+// quoteArgs joins arguments for a shell script, quoting them as needed.
+func quoteArgs(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		if safeArgRegex.MatchString(arg) {
+			quoted[i] = arg
+			continue
+		}
+		quoted[i] = "'" + strings.ReplaceAll(arg, "'", `'\''`) + "'"
+	}
+	return strings.Join(quoted, " ")
+}
@@ -0,0 +1,159 @@
+package githook
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"runtime"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHooksDir(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repoDir := t.TempDir()
+	runGit(t, repoDir, "init", "-q")
+	subDir := filepath.Join(repoDir, "live")
+	require.NoError(t, os.MkdirAll(subDir, 0755))
+
+	root, err := RepoRoot(subDir)
+	require.NoError(t, err)
+	expectedRoot, err := filepath.EvalSymlinks(repoDir)
+	require.NoError(t, err)
+	assert.Equal(t, expectedRoot, root)
+
+	hooksDir, err := HooksDir(subDir)
+	require.NoError(t, err)
+	assert.Equal(t, filepath.Join(repoDir, ".git", "hooks"), hooksDir)
+
+	t.Run("core.hooksPath", func(t *testing.T) {
+		runGit(t, repoDir, "config", "core.hooksPath", ".githooks")
+		hooksDir, err := HooksDir(subDir)
+		require.NoError(t, err)
+		assert.Equal(t, filepath.Join(repoDir, ".githooks"), hooksDir)
+	})
+
+	t.Run("Outside of a repository", func(t *testing.T) {
+		_, err := HooksDir(filepath.Join(string(filepath.Separator), "nonexistent-dir"))
+		assert.Error(t, err)
+	})
+}
+
+func TestInstallUninstall(t *testing.T) {
+	hooksDir := filepath.Join(t.TempDir(), "hooks")
+
+	chained, err := Install(hooksDir, PreCommit, []string{"check", "--dir", "live"})
+	require.NoError(t, err)
+	assert.Empty(t, chained)
+
+	status, err := Stat(hooksDir, PreCommit)
+	require.NoError(t, err)
+	assert.Equal(t, Status{
+		Name: PreCommit, Path: filepath.Join(hooksDir, PreCommit), Installed: true, Command: "terralink check --dir live",
+	}, status)
+
+	t.Run("Reinstall replaces the hook", func(t *testing.T) {
+		chained, err := Install(hooksDir, PreCommit, []string{"check", "--strict"})
+		require.NoError(t, err)
+		assert.Empty(t, chained)
+		status, err := Stat(hooksDir, PreCommit)
+		require.NoError(t, err)
+		assert.Equal(t, "terralink check --strict", status.Command)
+	})
+
+	removed, err := Uninstall(hooksDir, PreCommit)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	assert.NoFileExists(t, filepath.Join(hooksDir, PreCommit))
+
+	removed, err = Uninstall(hooksDir, PreCommit)
+	require.NoError(t, err)
+	assert.False(t, removed)
+}
+
+func TestInstallChainsExistingHook(t *testing.T) {
+	hooksDir := t.TempDir()
+	path := filepath.Join(hooksDir, PreCommit)
+	existing := "#!/bin/sh\necho existing\n"
+	require.NoError(t, os.WriteFile(path, []byte(existing), 0755))
+
+	status, err := Stat(hooksDir, PreCommit)
+	require.NoError(t, err)
+	assert.True(t, status.Foreign)
+	assert.False(t, status.Installed)
+
+	chained, err := Install(hooksDir, PreCommit, []string{"check"})
+	require.NoError(t, err)
+	assert.Equal(t, path+ChainedSuffix, chained)
+
+	status, err = Stat(hooksDir, PreCommit)
+	require.NoError(t, err)
+	assert.True(t, status.Installed)
+	assert.Equal(t, path+ChainedSuffix, status.Chained)
+
+	removed, err := Uninstall(hooksDir, PreCommit)
+	require.NoError(t, err)
+	assert.True(t, removed)
+	content, err := os.ReadFile(path)
+	require.NoError(t, err)
+	assert.Equal(t, existing, string(content))
+	assert.NoFileExists(t, path+ChainedSuffix)
+
+	t.Run("Leftover chained hook", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(path+ChainedSuffix, []byte(existing), 0755))
+		_, err := Install(hooksDir, PreCommit, []string{"check"})
+		assert.ErrorContains(t, err, "already exists")
+	})
+}
+
+func TestHookScript(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("hooks are shell scripts")
+	}
+
+	binDir := t.TempDir()
+	hooksDir := t.TempDir()
+	callsFile := filepath.Join(t.TempDir(), "calls")
+	// A fake terralink and an existing hook recording their arguments.
+	fake := "#!/bin/sh\necho \"$(basename \"$0\") $*\" >> " + callsFile + "\n"
+	require.NoError(t, os.WriteFile(filepath.Join(binDir, "terralink"), []byte(fake), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(hooksDir, PostCheckout), []byte(fake), 0755))
+
+	_, err := Install(hooksDir, PostCheckout, []string{"load", "--profile", "my apps"})
+	require.NoError(t, err)
+
+	runHook := func(args ...string) {
+		hook := exec.Command(filepath.Join(hooksDir, PostCheckout), args...)
+		hook.Env = append(os.Environ(), "PATH="+binDir+string(os.PathListSeparator)+os.Getenv("PATH"))
+		output, err := hook.CombinedOutput()
+		require.NoError(t, err, string(output))
+	}
+	// A file checkout runs the chained hook only.
+	runHook("HEAD", "HEAD", "0")
+	runHook("HEAD~1", "HEAD", "1")
+
+	calls, err := os.ReadFile(callsFile)
+	require.NoError(t, err)
+	assert.Equal(t, "post-checkout.terralink-chained HEAD HEAD 0\n"+
+		"post-checkout.terralink-chained HEAD~1 HEAD 1\n"+
+		"terralink load --profile my apps\n", string(calls))
+}
+
+func TestQuoteArgs(t *testing.T) {
+	assert.Equal(t, `load --dir live/eu --profile 'my apps' 'it'\''s'`,
+		quoteArgs([]string{"load", "--dir", "live/eu", "--profile", "my apps", "it's"}))
+}
+
+func runGit(t *testing.T, dir string, args ...string) {
+	t.Helper()
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	if output, err := cmd.CombinedOutput(); err != nil {
+		t.Fatalf("git %v failed: %v: %s", args, err, output)
+	}
+}
@@ -2,42 +2,254 @@ package ignore
 
 import (
 	"bufio"
+	"bytes"
+	"fmt"
+	"io/fs"
 	"log"
 	"os"
+	"os/exec"
 	"path/filepath"
 	"strings"
 )
 
+// ignoreFileName is the name of the ignore files read from the root
+// directory and from every directory below it.
+const ignoreFileName = ".terralinkignore"
+
+// gitignoreFileName is the name of git's ignore files, read from the git
+// work tree root and from every directory below it when gitignore is
+// respected.
+const gitignoreFileName = ".gitignore"
+
 // Default patterns to ignore
 var defaultPatterns = []string{
 	".terraform",
+	".terragrunt-cache",
 }
 
-// IgnoreMatcher handles path matching against ignore patterns
+// IgnoreMatcher handles path matching against ignore patterns. Patterns
+// follow gitignore semantics: globs, "**", "!" negation, anchored "/patterns"
+// and directory-only "patterns/". Every directory can hold its own
+// .terralinkignore, whose patterns are relative to it and take precedence
+// over the ones of its parents.
 type IgnoreMatcher struct {
-	patterns []string
+	rootDir  string
+	patterns []pattern
+	excludes []pattern
+	includes []pattern
+	loaded   map[string]bool
+
+	respectGitignore bool
+	gitTrackedOnly   bool
+	// gitRoot is the git work tree containing rootDir, if any.
+	gitRoot string
+	// trackedFiles and trackedDirs list the paths tracked by git when
+	// gitTrackedOnly is set.
+	trackedFiles map[string]bool
+	trackedDirs  map[string]bool
+}
+
+// Option configures optional behaviour of an IgnoreMatcher.
+type Option func(*IgnoreMatcher)
+
+// WithExclude ignores the paths matching the given gitignore patterns,
+// relative to dir. They take precedence over every .terralinkignore file.
+func WithExclude(dir string, globs []string) Option {
+	return func(m *IgnoreMatcher) {
+		m.excludes = append(m.excludes, parsePatterns(globs, absPath(dir))...)
+	}
+}
+
+// WithInclude restricts matching to the files matching at least one of the
+// given gitignore patterns, relative to dir. Directories are not affected.
+func WithInclude(dir string, globs []string) Option {
+	return func(m *IgnoreMatcher) {
+		m.includes = append(m.includes, parsePatterns(globs, absPath(dir))...)
+	}
+}
+
+// WithGitignore makes the matcher also honour .gitignore files, from the git
+// work tree root down, and .git/info/exclude. A .terralinkignore takes
+// precedence over the .gitignore of the same directory.
+func WithGitignore(respect bool) Option {
+	return func(m *IgnoreMatcher) {
+		m.respectGitignore = respect
+	}
+}
+
+// WithGitTrackedOnly makes the matcher ignore every file that git does not
+// track, as listed by "git ls-files".
+func WithGitTrackedOnly(trackedOnly bool) Option {
+	return func(m *IgnoreMatcher) {
+		m.gitTrackedOnly = trackedOnly
+	}
 }
 
 // NewMatcher creates a new IgnoreMatcher with default patterns and
 // loads additional patterns from .terralinkignore if it exists
-func NewMatcher(rootDir string) (*IgnoreMatcher, error) {
+func NewMatcher(rootDir string, opts ...Option) (*IgnoreMatcher, error) {
 	matcher := &IgnoreMatcher{
-		patterns: append([]string{}, defaultPatterns...),
+		rootDir:  absPath(rootDir),
+		patterns: parsePatterns(defaultPatterns, ""),
+		loaded:   map[string]bool{},
+	}
+	for _, opt := range opts {
+		opt(matcher)
 	}
 
-	// Try to load .terralinkignore file
-	ignoreFile := filepath.Join(rootDir, ".terralinkignore")
-	if _, err := os.Stat(ignoreFile); err == nil {
-		if err := matcher.loadIgnoreFile(ignoreFile); err != nil {
+	if matcher.respectGitignore || matcher.gitTrackedOnly {
+		// git never looks into its own directory.
+		matcher.patterns = append(matcher.patterns, parsePatterns([]string{".git"}, "")...)
+	}
+
+	if matcher.respectGitignore {
+		matcher.gitRoot = findGitRoot(matcher.rootDir)
+		if matcher.gitRoot != "" {
+			excludeFile := filepath.Join(matcher.gitRoot, ".git", "info", "exclude")
+			if _, err := os.Stat(excludeFile); err == nil {
+				if err := matcher.loadIgnoreFile(excludeFile, matcher.gitRoot); err != nil {
+					return nil, err
+				}
+			}
+		}
+	}
+
+	if matcher.gitTrackedOnly {
+		if err := matcher.loadTrackedFiles(); err != nil {
 			return nil, err
 		}
 	}
 
+	if err := matcher.loadAncestors(filepath.Join(matcher.rootDir, ignoreFileName)); err != nil {
+		return nil, err
+	}
+
 	return matcher, nil
 }
 
-// loadIgnoreFile loads patterns from a .terralinkignore file
-func (m *IgnoreMatcher) loadIgnoreFile(path string) error {
+// findGitRoot returns the closest directory at or above dir that contains a
+// .git entry, or an empty string if there is none.
+func findGitRoot(dir string) string {
+	for ; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir
+		}
+		if dir == filepath.Dir(dir) {
+			return ""
+		}
+	}
+}
+
+// loadTrackedFiles lists the files tracked by git below the root directory.
+func (m *IgnoreMatcher) loadTrackedFiles() error {
+	cmd := exec.Command("git", "-C", m.rootDir, "ls-files", "-z", "--cached")
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return fmt.Errorf("failed to list files tracked by git in %s: %w: %s", m.rootDir, err, strings.TrimSpace(stderr.String()))
+	}
+
+	m.trackedFiles = map[string]bool{}
+	m.trackedDirs = map[string]bool{m.rootDir: true}
+	for _, name := range strings.Split(string(output), "\x00") {
+		if name == "" {
+			continue
+		}
+		path := filepath.Join(m.rootDir, filepath.FromSlash(name))
+		m.trackedFiles[path] = true
+		for dir := filepath.Dir(path); !m.trackedDirs[dir]; dir = filepath.Dir(dir) {
+			m.trackedDirs[dir] = true
+		}
+	}
+	return nil
+}
+
+// parsePatterns compiles every non-empty pattern relative to base.
+func parsePatterns(lines []string, base string) []pattern {
+	var patterns []pattern
+	for _, line := range lines {
+		if p, ok := parsePattern(line, base); ok {
+			patterns = append(patterns, p)
+		}
+	}
+	return patterns
+}
+
+// absPath returns the absolute form of path, or path itself if it cannot be
+// resolved.
+func absPath(path string) string {
+	abs, err := filepath.Abs(path)
+	if err != nil {
+		return path
+	}
+	return abs
+}
+
+// loadDir loads the ignore files of dir, if any and not loaded yet: the
+// .gitignore when gitignore is respected, then the .terralinkignore unless
+// dir is above the root directory.
+func (m *IgnoreMatcher) loadDir(dir string) error {
+	if m.loaded[dir] {
+		return nil
+	}
+	m.loaded[dir] = true
+
+	var names []string
+	if m.gitRoot != "" && isWithin(m.gitRoot, dir) {
+		names = append(names, gitignoreFileName)
+	}
+	if isWithin(m.rootDir, dir) || !isWithin(dir, m.rootDir) {
+		names = append(names, ignoreFileName)
+	}
+	for _, name := range names {
+		ignoreFile := filepath.Join(dir, name)
+		if _, err := os.Stat(ignoreFile); err != nil {
+			continue
+		}
+		if err := m.loadIgnoreFile(ignoreFile, dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// isWithin reports whether path is dir or is below it.
+func isWithin(dir, path string) bool {
+	rel, err := filepath.Rel(dir, path)
+	return err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator))
+}
+
+// loadAncestors loads the ignore files of the directories between the top
+// directory (the git work tree root when gitignore is respected, otherwise
+// the root directory) and path.
+func (m *IgnoreMatcher) loadAncestors(path string) error {
+	top := m.rootDir
+	if m.gitRoot != "" && isWithin(m.gitRoot, m.rootDir) {
+		top = m.gitRoot
+	}
+	if !isWithin(top, filepath.Dir(path)) {
+		return nil
+	}
+	if err := m.loadDir(top); err != nil {
+		return err
+	}
+	rel, _ := filepath.Rel(top, filepath.Dir(path))
+	dir := top
+	for _, name := range strings.Split(rel, string(filepath.Separator)) {
+		if name == "." {
+			continue
+		}
+		dir = filepath.Join(dir, name)
+		if err := m.loadDir(dir); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// loadIgnoreFile loads patterns from an ignore file, relative to base
+func (m *IgnoreMatcher) loadIgnoreFile(path, base string) error {
 	file, err := os.Open(path)
 	if err != nil {
 		return err
@@ -51,38 +263,102 @@ func (m *IgnoreMatcher) loadIgnoreFile(path string) error {
 
 	scanner := bufio.NewScanner(file)
 	for scanner.Scan() {
-		pattern := strings.TrimSpace(scanner.Text())
-		// Skip empty lines and comments
-		if pattern != "" && !strings.HasPrefix(pattern, "#") {
-			m.patterns = append(m.patterns, pattern)
+		// Blank lines and comments are skipped by parsePattern
+		if p, ok := parsePattern(scanner.Text(), base); ok {
+			m.patterns = append(m.patterns, p)
 		}
 	}
 
 	return scanner.Err()
 }
 
-// ShouldIgnore checks if a path should be ignored based on the patterns
+// ShouldIgnore checks if a path should be ignored based on the patterns.
+// A path is ignored when it, or any directory containing it, is ignored, or
+// when it is a file that does not match the include patterns.
 func (m *IgnoreMatcher) ShouldIgnore(path string) bool {
-	// Normalize path for consistent matching
-	cleanPath := filepath.ToSlash(path)
-	base := filepath.Base(cleanPath)
-
-	for _, pattern := range m.patterns {
+	path = absPath(path)
+	if err := m.loadAncestors(path); err != nil {
+		log.Printf("Warning: %v", err)
+	}
 
-		if base == pattern {
+	for dir := filepath.Dir(path); dir != filepath.Dir(dir); dir = filepath.Dir(dir) {
+		if m.ignored(dir, true) {
 			return true
 		}
+	}
 
-		if strings.Contains(cleanPath, "/"+pattern+"/") {
-			return true
+	info, err := os.Stat(path)
+	isDir := err == nil && info.IsDir()
+	return m.ignored(path, isDir) || (!isDir && !m.included(path)) || m.untracked(path, isDir)
+}
+
+// Walk walks the file tree rooted at root like filepath.WalkDir, loading the
+// .terralinkignore file of every directory it enters. Ignored directories are
+// pruned and fn is only called for the paths that are not ignored.
+func (m *IgnoreMatcher) Walk(root string, fn fs.WalkDirFunc) error {
+	if err := m.loadAncestors(absPath(root)); err != nil {
+		return err
+	}
+	return filepath.WalkDir(root, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return fn(path, d, err)
 		}
 
-		if strings.HasSuffix(cleanPath, "/"+pattern) {
-			return true
+		abs := absPath(path)
+		if d.IsDir() {
+			if path != root && (m.ignored(abs, true) || m.untracked(abs, true)) {
+				return filepath.SkipDir
+			}
+			if err := m.loadDir(abs); err != nil {
+				return err
+			}
+			return fn(path, d, nil)
 		}
-		if !strings.HasSuffix(base, ".tf") && !strings.HasSuffix(base, ".hcl") {
-			return true
+
+		if m.ignored(abs, false) || !m.included(abs) || m.untracked(abs, false) {
+			return nil
+		}
+		return fn(path, d, nil)
+	})
+}
+
+// ignored evaluates the patterns for a single path, ignoring its parent
+// directories. As in gitignore, the last matching pattern wins.
+func (m *IgnoreMatcher) ignored(path string, isDir bool) bool {
+	ignored := false
+	for _, patterns := range [][]pattern{m.patterns, m.excludes} {
+		for _, p := range patterns {
+			if p.matches(path, isDir) {
+				ignored = !p.negate
+			}
 		}
 	}
-	return false
+	return ignored
+}
+
+// included reports whether a file matches the include patterns. Every file
+// is included when there are none.
+func (m *IgnoreMatcher) included(path string) bool {
+	if len(m.includes) == 0 {
+		return true
+	}
+	included := false
+	for _, p := range m.includes {
+		if p.matches(path, false) {
+			included = !p.negate
+		}
+	}
+	return included
+}
+
+// untracked reports whether git-tracked-only mode excludes a path: a file
+// git does not track, or a directory without any tracked file.
+func (m *IgnoreMatcher) untracked(path string, isDir bool) bool {
+	if !m.gitTrackedOnly {
+		return false
+	}
+	if isDir {
+		return !m.trackedDirs[path]
+	}
+	return !m.trackedFiles[path]
 }
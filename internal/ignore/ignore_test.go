@@ -1,8 +1,11 @@
 package ignore
 
 import (
+	"io/fs"
 	"os"
+	"os/exec"
 	"path/filepath"
+	"strings"
 	"testing"
 )
 
@@ -31,16 +34,17 @@ dist
 		path     string
 		expected bool
 	}{
-		{filepath.Join(tempDir, ".terraform", "file.tf"), true},           // Default pattern
-		{filepath.Join(tempDir, "subdir", ".terraform", "file.tf"), true}, // Default pattern in subdir
-		{filepath.Join(tempDir, "node_modules"), true},                    // Pattern from file
-		{filepath.Join(tempDir, "app", "node_modules"), true},             // Pattern from file in subdir
-		{filepath.Join(tempDir, ".git"), true},                            // Pattern from file
-		{filepath.Join(tempDir, "dist", "file.tf"), true},                 // Pattern from file
-		{filepath.Join(tempDir, "app", "file.tf"), false},                 // *.tf files not ignored
-		{filepath.Join(tempDir, "app", "mo2", "file4.hcl"), false},        // *.hcl files not ignored
-		{filepath.Join(tempDir, "src", "file.tf"), false},                 // Not in ignore list
-		{filepath.Join(tempDir, "app", "src", "file.hcl"), false},         // Not in ignore list
+		{filepath.Join(tempDir, ".terraform", "file.tf"), true},              // Default pattern
+		{filepath.Join(tempDir, "subdir", ".terraform", "file.tf"), true},    // Default pattern in subdir
+		{filepath.Join(tempDir, "unit", ".terragrunt-cache", "x.hcl"), true}, // Terragrunt cache
+		{filepath.Join(tempDir, "node_modules"), true},                       // Pattern from file
+		{filepath.Join(tempDir, "app", "node_modules"), true},                // Pattern from file in subdir
+		{filepath.Join(tempDir, ".git"), true},                               // Pattern from file
+		{filepath.Join(tempDir, "dist", "file.tf"), true},                    // Pattern from file
+		{filepath.Join(tempDir, "app", "file.tf"), false},                    // *.tf files not ignored
+		{filepath.Join(tempDir, "app", "mo2", "file4.hcl"), false},           // *.hcl files not ignored
+		{filepath.Join(tempDir, "src", "file.tf"), false},                    // Not in ignore list
+		{filepath.Join(tempDir, "app", "src", "file.hcl"), false},            // Not in ignore list
 	}
 
 	for _, tc := range tests {
@@ -69,3 +73,280 @@ func TestEmptyIgnoreFile(t *testing.T) {
 		t.Error("Did not expect src to be ignored")
 	}
 }
+
+func TestGitignoreSemantics(t *testing.T) {
+	tempDir := t.TempDir()
+
+	ignoreContent := `
+# comment
+*.bak
+/build
+logs/
+envs/**/secrets
+!envs/dev/secrets
+modules/**
+!modules/keep.tf
+file?.tf
+[ab]cd.tf
+\#literal.tf
+`
+	if err := os.WriteFile(filepath.Join(tempDir, ".terralinkignore"), []byte(ignoreContent), 0644); err != nil {
+		t.Fatalf("Failed to write test .terralinkignore file: %v", err)
+	}
+	if err := os.MkdirAll(filepath.Join(tempDir, "app", "logs"), 0755); err != nil {
+		t.Fatalf("Failed to create directory: %v", err)
+	}
+
+	matcher, err := NewMatcher(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{filepath.Join(tempDir, "main.tf.bak"), true},                       // Glob at root
+		{filepath.Join(tempDir, "app", "main.tf.bak"), true},                // Glob at any depth
+		{filepath.Join(tempDir, "build", "main.tf"), true},                  // Anchored pattern
+		{filepath.Join(tempDir, "app", "build", "main.tf"), false},          // Anchored pattern only at root
+		{filepath.Join(tempDir, "app", "logs", "main.tf"), true},            // Directory-only pattern
+		{filepath.Join(tempDir, "logs"), false},                             // Directory-only pattern on a file
+		{filepath.Join(tempDir, "envs", "prod", "eu", "secrets"), true},     // "**" in the middle
+		{filepath.Join(tempDir, "envs", "dev", "secrets"), false},           // Negation
+		{filepath.Join(tempDir, "modules", "vpc", "main.tf"), true},         // Trailing "**"
+		{filepath.Join(tempDir, "modules", "keep.tf"), false},               // Negation after "**"
+		{filepath.Join(tempDir, "file1.tf"), true},                          // "?" wildcard
+		{filepath.Join(tempDir, "file10.tf"), false},                        // "?" matches a single character
+		{filepath.Join(tempDir, "bcd.tf"), true},                            // Character class
+		{filepath.Join(tempDir, "ccd.tf"), false},                           // Character class
+		{filepath.Join(tempDir, "#literal.tf"), true},                       // Escaped "#"
+		{filepath.Join(tempDir, "app", "main.tf"), false},                   // Not in ignore list
+		{filepath.Join(filepath.Dir(tempDir), "elsewhere", "build"), false}, // Outside of the root
+	}
+
+	for _, tc := range tests {
+		if got := matcher.ShouldIgnore(tc.path); got != tc.expected {
+			t.Errorf("ShouldIgnore(%q) = %v; want %v", tc.path, got, tc.expected)
+		}
+	}
+}
+
+func TestNestedIgnoreFiles(t *testing.T) {
+	tempDir := t.TempDir()
+
+	files := map[string]string{
+		".terralinkignore":            "*.generated.tf\n",
+		"app/.terralinkignore":        "!keep.generated.tf\n/local.tf\n",
+		"app/keep.generated.tf":       "",
+		"app/other.generated.tf":      "",
+		"app/local.tf":                "",
+		"app/sub/local.tf":            "",
+		"other/local.tf":              "",
+		"other/keep.generated.tf":     "",
+		"node_modules/pkg/main.tf":    "",
+		"app/.terraform/modules/m.tf": "",
+		"app/main.tf":                 "",
+	}
+	for name, content := range files {
+		path := filepath.Join(tempDir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+
+	matcher, err := NewMatcher(tempDir, WithExclude(tempDir, []string{"node_modules/"}))
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+
+	var visited []string
+	var walkedDirs []string
+	err = matcher.Walk(tempDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(tempDir, path)
+		if d.IsDir() {
+			walkedDirs = append(walkedDirs, filepath.ToSlash(rel))
+		} else if filepath.Ext(path) == ".tf" {
+			visited = append(visited, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	expected := []string{"app/keep.generated.tf", "app/main.tf", "app/sub/local.tf", "other/local.tf"}
+	if strings.Join(visited, ",") != strings.Join(expected, ",") {
+		t.Errorf("Walk visited %v; want %v", visited, expected)
+	}
+	for _, dir := range walkedDirs {
+		if strings.Contains(dir, "node_modules") || strings.Contains(dir, ".terraform") {
+			t.Errorf("Walk descended into ignored directory %q", dir)
+		}
+	}
+
+	// ShouldIgnore discovers nested files on its own.
+	freshMatcher, err := NewMatcher(tempDir)
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+	if freshMatcher.ShouldIgnore(filepath.Join(tempDir, "app", "keep.generated.tf")) {
+		t.Error("Expected app/keep.generated.tf to be re-included by app/.terralinkignore")
+	}
+	if !freshMatcher.ShouldIgnore(filepath.Join(tempDir, "app", "local.tf")) {
+		t.Error("Expected app/local.tf to be ignored by app/.terralinkignore")
+	}
+}
+
+func TestIncludePatterns(t *testing.T) {
+	tempDir := t.TempDir()
+
+	matcher, err := NewMatcher(tempDir, WithInclude(tempDir, []string{"live/**/*.tf", "terragrunt.hcl"}))
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{filepath.Join(tempDir, "live", "prod", "main.tf"), false},
+		{filepath.Join(tempDir, "live", "main.tf"), false},
+		{filepath.Join(tempDir, "units", "vpc", "terragrunt.hcl"), false},
+		{filepath.Join(tempDir, "modules", "vpc", "main.tf"), true},
+	}
+
+	for _, tc := range tests {
+		if got := matcher.ShouldIgnore(tc.path); got != tc.expected {
+			t.Errorf("ShouldIgnore(%q) = %v; want %v", tc.path, got, tc.expected)
+		}
+	}
+}
+
+// writeFiles creates every file of the map below dir.
+func writeFiles(t *testing.T, dir string, files map[string]string) {
+	t.Helper()
+	for name, content := range files {
+		path := filepath.Join(dir, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatalf("Failed to create directory: %v", err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+			t.Fatalf("Failed to write file: %v", err)
+		}
+	}
+}
+
+func TestRespectGitignore(t *testing.T) {
+	repoDir := t.TempDir()
+	writeFiles(t, repoDir, map[string]string{
+		".git/info/exclude":          "scratch/\n",
+		".gitignore":                 "build/\n*.generated.tf\n",
+		"infra/.gitignore":           "/vendored/\n",
+		"infra/.terralinkignore":     "!keep.generated.tf\n",
+		"infra/main.tf":              "",
+		"infra/keep.generated.tf":    "",
+		"infra/other.generated.tf":   "",
+		"infra/build/main.tf":        "",
+		"infra/vendored/main.tf":     "",
+		"infra/scratch/main.tf":      "",
+		"infra/modules/vpc/main.tf":  "",
+		"infra/modules/vpc/.gitkeep": "",
+	})
+	rootDir := filepath.Join(repoDir, "infra")
+
+	tests := []struct {
+		path     string
+		expected bool
+	}{
+		{filepath.Join(rootDir, "main.tf"), false},
+		{filepath.Join(rootDir, "keep.generated.tf"), false},  // .terralinkignore overrides .gitignore
+		{filepath.Join(rootDir, "other.generated.tf"), true},  // .gitignore above --dir
+		{filepath.Join(rootDir, "build", "main.tf"), true},    // .gitignore above --dir
+		{filepath.Join(rootDir, "vendored", "main.tf"), true}, // Nested .gitignore
+		{filepath.Join(rootDir, "scratch", "main.tf"), true},  // .git/info/exclude
+		{filepath.Join(rootDir, "modules", "vpc", "main.tf"), false},
+	}
+
+	matcher, err := NewMatcher(rootDir, WithGitignore(true))
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+	for _, tc := range tests {
+		if got := matcher.ShouldIgnore(tc.path); got != tc.expected {
+			t.Errorf("ShouldIgnore(%q) = %v; want %v", tc.path, got, tc.expected)
+		}
+	}
+
+	// Without the option .gitignore files have no effect.
+	matcher, err = NewMatcher(rootDir)
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+	if matcher.ShouldIgnore(filepath.Join(rootDir, "build", "main.tf")) {
+		t.Error("Did not expect .gitignore to be honoured by default")
+	}
+}
+
+func TestGitTrackedOnly(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+
+	repoDir := t.TempDir()
+	writeFiles(t, repoDir, map[string]string{
+		"main.tf":              "",
+		"modules/vpc/main.tf":  "",
+		"untracked.tf":         "",
+		"generated/main.tf":    "",
+		"modules/vpc/extra.tf": "",
+	})
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.tf", "modules/vpc/main.tf"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, output)
+		}
+	}
+
+	matcher, err := NewMatcher(repoDir, WithGitTrackedOnly(true))
+	if err != nil {
+		t.Fatalf("Failed to create matcher: %v", err)
+	}
+
+	var visited []string
+	err = matcher.Walk(repoDir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		rel, _ := filepath.Rel(repoDir, path)
+		if d.IsDir() && (d.Name() == ".git" || d.Name() == "generated") {
+			t.Errorf("Walk descended into %q", rel)
+		}
+		if !d.IsDir() {
+			visited = append(visited, filepath.ToSlash(rel))
+		}
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("Walk failed: %v", err)
+	}
+
+	expected := []string{"main.tf", "modules/vpc/main.tf"}
+	if strings.Join(visited, ",") != strings.Join(expected, ",") {
+		t.Errorf("Walk visited %v; want %v", visited, expected)
+	}
+
+	if _, err := NewMatcher(t.TempDir(), WithGitTrackedOnly(true)); err == nil {
+		t.Error("Expected an error outside of a git repository")
+	}
+}
@@ -0,0 +1,134 @@
+package ignore
+
+import (
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// pattern is a single compiled gitignore pattern.
+type pattern struct {
+	// base is the directory the pattern is relative to. An empty base makes
+	// the pattern apply to paths anywhere.
+	base    string
+	regex   *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// parsePattern compiles a line of an ignore file following gitignore rules.
+// It returns false for blank lines and comments.
+func parsePattern(line, base string) (pattern, bool) {
+	line = trimTrailingSpaces(strings.TrimPrefix(line, "\ufeff"))
+	if line == "" || strings.HasPrefix(line, "#") {
+		return pattern{}, false
+	}
+
+	p := pattern{base: base}
+	if strings.HasPrefix(line, "!") {
+		p.negate = true
+		line = line[1:]
+	} else if strings.HasPrefix(line, `\!`) || strings.HasPrefix(line, `\#`) {
+		line = line[1:]
+	}
+	if strings.HasSuffix(line, "/") && !strings.HasSuffix(line, `\/`) {
+		p.dirOnly = true
+		line = strings.TrimSuffix(line, "/")
+	}
+	if line == "" {
+		return pattern{}, false
+	}
+
+	// A slash at the beginning or in the middle anchors the pattern to its
+	// base directory; otherwise it matches a name at any depth.
+	anchored := strings.Contains(line, "/")
+	line = strings.TrimPrefix(line, "/")
+
+	prefix := "^(?:.*/)?"
+	if anchored {
+		prefix = "^"
+	}
+	regex, err := regexp.Compile(prefix + globToRegex(line) + "$")
+	if err != nil {
+		return pattern{}, false
+	}
+	p.regex = regex
+	return p, true
+}
+
+// trimTrailingSpaces removes trailing spaces unless they are escaped.
+func trimTrailingSpaces(line string) string {
+	line = strings.TrimRight(line, "\r\n\t")
+	for strings.HasSuffix(line, " ") && !strings.HasSuffix(line, `\ `) {
+		line = line[:len(line)-1]
+	}
+	return line
+}
+
+// globToRegex translates a gitignore glob into a regular expression body.
+// "*" and "?" do not cross directory separators, "**" does when it is a
+// whole path segment, and "[...]" is a character class.
+func globToRegex(glob string) string {
+	var sb strings.Builder
+	for i := 0; i < len(glob); i++ {
+		atSegmentStart := i == 0 || glob[i-1] == '/'
+		switch {
+		case atSegmentStart && strings.HasPrefix(glob[i:], "**/"):
+			sb.WriteString("(?:.*/)?")
+			i += 2
+		case atSegmentStart && glob[i:] == "**":
+			sb.WriteString(".*")
+			i++
+		case glob[i] == '*':
+			sb.WriteString("[^/]*")
+		case glob[i] == '?':
+			sb.WriteString("[^/]")
+		case glob[i] == '[':
+			end := strings.IndexByte(glob[i+1:], ']')
+			if end < 0 {
+				sb.WriteString(`\[`)
+				continue
+			}
+			class := glob[i+1 : i+1+end]
+			sb.WriteString("[")
+			if strings.HasPrefix(class, "!") || strings.HasPrefix(class, "^") {
+				sb.WriteString("^")
+				class = class[1:]
+			}
+			sb.WriteString(strings.NewReplacer(`\`, `\\`, "[", `\[`).Replace(class))
+			sb.WriteString("]")
+			i += end + 1
+		case glob[i] == '\\' && i+1 < len(glob):
+			i++
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		default:
+			sb.WriteString(regexp.QuoteMeta(glob[i : i+1]))
+		}
+	}
+	return sb.String()
+}
+
+// relPath returns path relative to the pattern's base using forward
+// slashes, or false if the path is not below the base.
+func (p pattern) relPath(path string) (string, bool) {
+	if p.base == "" {
+		return strings.TrimPrefix(filepath.ToSlash(path), "/"), true
+	}
+	rel, err := filepath.Rel(p.base, path)
+	if err != nil || rel == "." || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return "", false
+	}
+	return filepath.ToSlash(rel), true
+}
+
+// matches reports whether the pattern applies to the absolute path.
+func (p pattern) matches(path string, isDir bool) bool {
+	if p.dirOnly && !isDir {
+		return false
+	}
+	rel, ok := p.relPath(path)
+	if !ok {
+		return false
+	}
+	return p.regex.MatchString(rel)
+}
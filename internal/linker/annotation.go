@@ -1,17 +1,35 @@
 package linker
 
 import (
-	"fmt"
 	"regexp"
+	"sort"
 	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/zclconf/go-cty/cty"
 )
 
 // Constants and regex for annotation parsing.
 const (
 	stateAnnotationPrefix = "# terralink-state:"
+	// stateFormatV2 opens the attributes of a v2 state annotation. v1 state
+	// annotations have no format marker.
+	stateFormatV2 = "v2"
+	// stateSourceExprKey and stateVersionExprKey are the attributes of a v2
+	// state annotation recording the exact text of a source or version that
+	// is not a plain string literal.
+	stateSourceExprKey  = "source_expr"
+	stateVersionExprKey = "version_expr"
+	// stateVersionLineKey records the exact version line, and
+	// stateVersionOffsetKey its position in lines from the source line, when
+	// they differ from where and how Unload writes it by default.
+	stateVersionLineKey   = "version_line"
+	stateVersionOffsetKey = "version_offset"
+	// stateUnformattedKey marks a block that was not formatted like
+	// 'terraform fmt' before loading, although it is once loaded.
+	stateUnformattedKey = "unformatted"
 )
 
 var (
@@ -19,64 +37,179 @@ var (
 	devAnnotationLineRegex = regexp.MustCompile(`^#\s*terralink:\s*(.*)$`)
 	devAnnotationPairRegex = regexp.MustCompile(`(\w+)\s*=\s*([^\s]+)`)
 
-	// Regex to parse key-value pairs from state annotations.
+	// Regex to parse key-value pairs from v1 state annotations.
 	stateAttrRegex = regexp.MustCompile(`(\w+)\s*=\s*"([^"]*)"`)
+
+	// stateFormatRegex matches the format marker of a versioned state
+	// annotation, and stateKeyRegex an attribute name of a v2 one.
+	stateFormatRegex = regexp.MustCompile(`^v\d+(\s|$)`)
+	stateKeyRegex    = regexp.MustCompile(`^[A-Za-z_][\w-]*`)
 )
 
+// DevAnnotation holds the attributes of a "# terralink:" dev annotation.
+type DevAnnotation struct {
+	// Path is the local path the module is linked to while loaded.
+	Path string
+	// Git is a git address the module is linked to instead of a local path.
+	Git string
+	// Ref is the git ref used together with Git.
+	Ref string
+	// Profiles are the named profiles the module belongs to, if any.
+	Profiles []string
+}
+
+// devSource returns the source a module is switched to when loaded. Git
+// annotations keep the "//subdir" of the original source and get the ref as
+// a "?ref=" argument. Terragrunt local paths keep the "//subdir" too.
+// filePath is the file declaring the module, used to resolve module roots.
+func (a DevAnnotation) devSource(originalSource string, terragrunt bool, filePath string, opts LoadOptions) string {
+	if a.Git != "" {
+		ref := a.Ref
+		if opts.Ref != "" {
+			ref = opts.Ref
+		}
+		return gitSource(a.Git, sourceSubdir(originalSource), ref)
+	}
+	path := a.localPath(filePath, opts)
+	if terragrunt {
+		return withSourceSubdir(path, sourceSubdir(originalSource))
+	}
+	return path
+}
+
+// devSources returns every source devSource may return: one per alternative
+// of an annotated path that can be expanded.
+func (a DevAnnotation) devSources(originalSource string, terragrunt bool, filePath string, opts LoadOptions) []string {
+	if a.Git != "" {
+		return []string{a.devSource(originalSource, terragrunt, filePath, opts)}
+	}
+	var sources []string
+	for _, candidate := range a.pathCandidates(filePath, opts) {
+		if candidate.source == "" {
+			continue
+		}
+		if terragrunt {
+			sources = append(sources, withSourceSubdir(candidate.source, sourceSubdir(originalSource)))
+		} else {
+			sources = append(sources, candidate.source)
+		}
+	}
+	return sources
+}
+
+// HasProfile reports whether the annotation lists the given profile.
+func (a DevAnnotation) HasProfile(profile string) bool {
+	for _, p := range a.Profiles {
+		if p == profile {
+			return true
+		}
+	}
+	return false
+}
+
 // StateAnnotation holds the original source and version of a module.
 type StateAnnotation struct {
 	Source  string
 	Version string
+	// Attributes holds the other attributes of a v2 state annotation, which
+	// are written back unchanged.
+	Attributes map[string]string
 }
 
 // findDevAnnotation searches through a block's comments to find a dev annotation.
-func findDevAnnotation(block *hclwrite.Block) (path string, found bool) {
+func findDevAnnotation(block *hclwrite.Block) (DevAnnotation, bool) {
 	for _, token := range block.Body().BuildTokens(nil) {
 		if token.Type == hclsyntax.TokenComment {
-			if path, isDev := parseDevAnnotation(string(token.Bytes)); isDev {
-				return path, true
+			if annotation, isDev := parseDevAnnotation(string(token.Bytes)); isDev {
+				return annotation, true
 			}
 		}
 	}
-	return "", false
+	return DevAnnotation{}, false
 }
 
 // findStateAnnotation searches for a state annotation comment in a block and parses it.
 func findStateAnnotation(block *hclwrite.Block) (StateAnnotation, bool) {
+	state, token := findStateAnnotationToken(block)
+	return state, token != nil
+}
+
+// findStateAnnotationToken returns the parsed state annotation of a block
+// together with the comment token holding it, or a nil token if none exists.
+func findStateAnnotationToken(block *hclwrite.Block) (StateAnnotation, *hclwrite.Token) {
 	for _, token := range block.Body().BuildTokens(nil) {
 		if token.Type == hclsyntax.TokenComment {
 			if state, isState := parseStateAnnotation(string(token.Bytes)); isState {
-				return state, true
+				return state, token
 			}
 		}
 	}
-	return StateAnnotation{}, false
+	return StateAnnotation{}, nil
 }
 
-// parseDevAnnotation checks if a comment is a dev annotation and extracts the path.
-func parseDevAnnotation(comment string) (path string, isDev bool) {
+// parseDevAnnotation checks if a comment is a dev annotation and extracts its attributes.
+func parseDevAnnotation(comment string) (DevAnnotation, bool) {
 	lineMatch := devAnnotationLineRegex.FindStringSubmatch(strings.TrimSpace(comment))
 	if len(lineMatch) != 2 {
-		return "", false
+		return DevAnnotation{}, false
 	}
-	attrsStr := lineMatch[1]
+	return parseDevAnnotationAttrs(lineMatch[1])
+}
+
+// parseDevAnnotationAttrs extracts the attributes from the key-value pairs of
+// a dev annotation, e.g. "path=../local profile=networking,platform" or
+// "git=git::ssh://git@host/org/mod.git ref=feature/x".
+// An annotation is only valid if it has a path or a git address.
+func parseDevAnnotationAttrs(attrsStr string) (DevAnnotation, bool) {
+	annotation := DevAnnotation{}
+	found := false
 	pairMatches := devAnnotationPairRegex.FindAllStringSubmatch(attrsStr, -1)
 	for _, pair := range pairMatches {
-		if len(pair) == 3 && pair[1] == "path" {
-			return pair[2], true
+		if len(pair) != 3 {
+			continue
+		}
+		switch pair[1] {
+		case "path":
+			annotation.Path = pair[2]
+			found = true
+		case "git":
+			annotation.Git = pair[2]
+			found = true
+		case "ref":
+			annotation.Ref = pair[2]
+		case "profile":
+			for _, profile := range strings.Split(pair[2], ",") {
+				if profile = strings.TrimSpace(profile); profile != "" {
+					annotation.Profiles = append(annotation.Profiles, profile)
+				}
+			}
 		}
 	}
-	return "", false
+	if !found {
+		return DevAnnotation{}, false
+	}
+	return annotation, true
 }
 
-// parseStateAnnotation extracts the source and version from a state line.
+// parseStateAnnotation extracts the source and version from a state line,
+// either in the v1 format, `source="..." version="..."` with unescaped
+// values, or in the v2 format, "v2" followed by attributes whose values are
+// quoted and escaped like HCL strings. Lines in an unknown format are not
+// state annotations.
 func parseStateAnnotation(line string) (StateAnnotation, bool) {
 	state := StateAnnotation{}
 	if !strings.HasPrefix(strings.TrimSpace(line), stateAnnotationPrefix) {
 		return state, false
 	}
 
-	data := strings.TrimSpace(strings.TrimPrefix(line, stateAnnotationPrefix))
+	data := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(line), stateAnnotationPrefix))
+	if marker := stateFormatRegex.FindString(data); marker != "" {
+		if strings.TrimSpace(marker) != stateFormatV2 {
+			return state, false
+		}
+		return parseStateAttributesV2(data[len(marker):])
+	}
+
 	matches := stateAttrRegex.FindAllStringSubmatch(data, -1)
 	if matches == nil {
 		return state, false
@@ -96,27 +229,126 @@ func parseStateAnnotation(line string) (StateAnnotation, bool) {
 	return state, found
 }
 
-// buildStateAnnotation constructs the string for a state annotation comment.
-func buildStateAnnotation(source, version string) string {
-	versionPart := ""
-	if version != "" {
-		versionPart = fmt.Sprintf(` version="%s"`, version)
+// parseStateAttributesV2 parses the attributes of a v2 state annotation,
+// e.g. `source="my-registry/vpc/aws" version=">= 1.0, \"< 2.0\""`. Every
+// value must be a quoted HCL string without interpolation.
+func parseStateAttributesV2(attrs string) (StateAnnotation, bool) {
+	state := StateAnnotation{}
+	found := false
+	for rest := strings.TrimSpace(attrs); rest != ""; rest = strings.TrimSpace(rest) {
+		key := stateKeyRegex.FindString(rest)
+		if key == "" {
+			return StateAnnotation{}, false
+		}
+		rest = strings.TrimSpace(rest[len(key):])
+		if !strings.HasPrefix(rest, "=") {
+			return StateAnnotation{}, false
+		}
+		rest = strings.TrimSpace(rest[1:])
+
+		end := quotedStringEnd(rest)
+		if end < 0 {
+			return StateAnnotation{}, false
+		}
+		value, ok := staticString(rest[:end])
+		if !ok {
+			return StateAnnotation{}, false
+		}
+		rest = rest[end:]
+
+		switch key {
+		case "source":
+			state.Source = value
+			found = true
+		case "version":
+			state.Version = value
+		default:
+			if state.Attributes == nil {
+				state.Attributes = map[string]string{}
+			}
+			state.Attributes[key] = value
+		}
+	}
+	return state, found
+}
+
+// quotedStringEnd returns the length of the quoted string s starts with,
+// skipping escaped characters, or -1 if s does not start with one.
+func quotedStringEnd(s string) int {
+	if !strings.HasPrefix(s, `"`) {
+		return -1
+	}
+	for i := 1; i < len(s); i++ {
+		switch s[i] {
+		case '\\':
+			i++
+		case '"':
+			return i + 1
+		}
 	}
-	return fmt.Sprintf(`%s source="%s"%s`, stateAnnotationPrefix, source, versionPart)
+	return -1
+}
+
+// staticString returns the value of an HCL expression that is a string
+// without interpolation, e.g. a quoted string literal.
+func staticString(expr string) (string, bool) {
+	parsed, diags := hclsyntax.ParseExpression([]byte(expr), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return "", false
+	}
+	value, diags := parsed.Value(nil)
+	if diags.HasErrors() || value.IsNull() || !value.IsKnown() || value.Type() != cty.String {
+		return "", false
+	}
+	return value.AsString(), true
+}
+
+// isStateAnnotationV1 reports whether a comment is a state annotation in the
+// v1 format.
+func isStateAnnotationV1(comment string) bool {
+	if _, isState := parseStateAnnotation(comment); !isState {
+		return false
+	}
+	data := strings.TrimSpace(strings.TrimPrefix(strings.TrimSpace(comment), stateAnnotationPrefix))
+	return !stateFormatRegex.MatchString(data)
+}
+
+// buildStateAnnotation constructs the string for a v2 state annotation
+// comment: the source, the version if any, then the other attributes in
+// alphabetical order, quoted and escaped like HCL strings.
+func buildStateAnnotation(state StateAnnotation) string {
+	parts := []string{stateAnnotationPrefix, stateFormatV2, stateAttribute("source", state.Source)}
+	if state.Version != "" {
+		parts = append(parts, stateAttribute("version", state.Version))
+	}
+	keys := make([]string, 0, len(state.Attributes))
+	for key := range state.Attributes {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		parts = append(parts, stateAttribute(key, state.Attributes[key]))
+	}
+	return strings.Join(parts, " ")
+}
+
+// stateAttribute formats an attribute of a v2 state annotation.
+func stateAttribute(key, value string) string {
+	return key + "=" + string(hclwrite.TokensForValue(cty.StringVal(value)).Bytes())
 }
 
 // getAttrValueAsString safely extracts the string value from an HCL attribute.
+// An expression that is not a static string, such as an interpolation or a
+// variable reference, is returned as written.
 func getAttrValueAsString(attr *hclwrite.Attribute) string {
 	if attr == nil {
 		return ""
 	}
-	// Iterate through the expression tokens to find the literal string.
-	// This is more robust than building a raw string and trimming it.
-	for _, token := range attr.Expr().BuildTokens(nil) {
-		if token.Type == hclsyntax.TokenQuotedLit {
-			// The Bytes of a quoted literal include the quotes, so we must trim them.
-			return strings.Trim(string(token.Bytes), `"`)
-		}
+	expr := string(attr.Expr().BuildTokens(nil).Bytes())
+	// Escape sequences of plain strings are decoded. The newline ends the
+	// closing marker of a heredoc.
+	if value, ok := staticString(expr + "\n"); ok {
+		return value
 	}
-	return "" // Return empty if no string literal is found
+	return strings.TrimSpace(expr)
 }
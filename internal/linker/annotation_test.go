@@ -1,6 +1,7 @@
 package linker
 
 import (
+	"path/filepath"
 	"testing"
 
 	"github.com/hashicorp/hcl/v2"
@@ -21,17 +22,54 @@ func TestAnnotation_ParseDevAnnotation(t *testing.T) {
 		{"Invalid Format", "# terralink: ../local/module", "", false},
 		{"Not a terralink comment", "# some other comment", "", false},
 		{"Empty Comment", "", "", false},
+		{"Profile without path", "# terralink: profile=networking", "", false},
 	}
 
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
-			path, isDev := parseDevAnnotation(tc.comment)
-			assert.Equal(t, tc.expectedPath, path)
+			annotation, isDev := parseDevAnnotation(tc.comment)
+			assert.Equal(t, tc.expectedPath, annotation.Path)
 			assert.Equal(t, tc.expectedBool, isDev)
 		})
 	}
 }
 
+func TestAnnotation_ParseDevAnnotationGit(t *testing.T) {
+	annotation, isDev := parseDevAnnotation("# terralink: git=git::ssh://git@host/org/mod.git ref=feature/x profile=net")
+	assert.True(t, isDev)
+	assert.Equal(t, DevAnnotation{
+		Git:      "git::ssh://git@host/org/mod.git",
+		Ref:      "feature/x",
+		Profiles: []string{"net"},
+	}, annotation)
+
+	_, isDev = parseDevAnnotation("# terralink: ref=feature/x")
+	assert.False(t, isDev)
+}
+
+func TestAnnotation_ParseDevAnnotationProfiles(t *testing.T) {
+	testCases := []struct {
+		name             string
+		comment          string
+		expectedProfiles []string
+	}{
+		{"No profile", "# terralink: path=../net", nil},
+		{"Single profile", "# terralink: path=../net profile=networking", []string{"networking"}},
+		{"Multiple profiles", "# terralink: path=../net profile=networking,platform", []string{"networking", "platform"}},
+		{"Profile before path", "# terralink: profile=platform path=../net", []string{"platform"}},
+		{"Empty entries", "# terralink: path=../net profile=networking,,platform,", []string{"networking", "platform"}},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			annotation, isDev := parseDevAnnotation(tc.comment)
+			assert.True(t, isDev)
+			assert.Equal(t, "../net", annotation.Path)
+			assert.Equal(t, tc.expectedProfiles, annotation.Profiles)
+		})
+	}
+}
+
 func TestAnnotation_ParseStateAnnotation(t *testing.T) {
 	testCases := []struct {
 		name          string
@@ -75,6 +113,41 @@ func TestAnnotation_ParseStateAnnotation(t *testing.T) {
 			comment:      "",
 			expectedBool: false,
 		},
+		{
+			name:    "V2 with escaped values",
+			comment: `# terralink-state: v2 source="a \"quoted\" # source" version="1.2.3" owner="net"`,
+			expectedState: StateAnnotation{
+				Source:     `a "quoted" # source`,
+				Version:    "1.2.3",
+				Attributes: map[string]string{"owner": "net"},
+			},
+			expectedBool: true,
+		},
+		{
+			name:         "V2 without source",
+			comment:      `# terralink-state: v2 version="1.2.3"`,
+			expectedBool: false,
+		},
+		{
+			name:         "V2 with an unquoted value",
+			comment:      `# terralink-state: v2 source=remote/source`,
+			expectedBool: false,
+		},
+		{
+			name:         "V2 with an unterminated value",
+			comment:      `# terralink-state: v2 source="remote/source`,
+			expectedBool: false,
+		},
+		{
+			name:         "V2 with interpolation",
+			comment:      `# terralink-state: v2 source="${var.source}"`,
+			expectedBool: false,
+		},
+		{
+			name:         "Unknown format",
+			comment:      `# terralink-state: v3 source="remote/source"`,
+			expectedBool: false,
+		},
 	}
 
 	for _, tc := range testCases {
@@ -90,16 +163,39 @@ func TestAnnotation_ParseStateAnnotation(t *testing.T) {
 
 func TestAnnotation_BuildStateAnnotation(t *testing.T) {
 	t.Run("With source and version", func(t *testing.T) {
-		expected := `# terralink-state: source="remote/source" version="1.0.0"`
-		actual := buildStateAnnotation("remote/source", "1.0.0")
+		expected := `# terralink-state: v2 source="remote/source" version="1.0.0"`
+		actual := buildStateAnnotation(StateAnnotation{Source: "remote/source", Version: "1.0.0"})
 		assert.Equal(t, expected, actual)
 	})
 
 	t.Run("With source only", func(t *testing.T) {
-		expected := `# terralink-state: source="remote/source"`
-		actual := buildStateAnnotation("remote/source", "")
+		expected := `# terralink-state: v2 source="remote/source"`
+		actual := buildStateAnnotation(StateAnnotation{Source: "remote/source"})
+		assert.Equal(t, expected, actual)
+	})
+
+	t.Run("Escaped values and other attributes", func(t *testing.T) {
+		expected := `# terralink-state: v2 source="git::https://host/mod.git?ref=v1#x" version=">= 1.0, \"< 2\"" kind="x" note="$${a}\\b"`
+		actual := buildStateAnnotation(StateAnnotation{
+			Source:     "git::https://host/mod.git?ref=v1#x",
+			Version:    `>= 1.0, "< 2"`,
+			Attributes: map[string]string{"note": `${a}\b`, "kind": "x"},
+		})
 		assert.Equal(t, expected, actual)
 	})
+
+	t.Run("Round trip", func(t *testing.T) {
+		states := []StateAnnotation{
+			{Source: "remote/source"},
+			{Source: `odd "source" # with\tescapes`, Version: "~> 1.0\n"},
+			{Source: "remote/source", Attributes: map[string]string{"owner": "team ${x} %{y}"}},
+		}
+		for _, state := range states {
+			parsed, isState := parseStateAnnotation(buildStateAnnotation(state))
+			assert.True(t, isState)
+			assert.Equal(t, state, parsed)
+		}
+	})
 }
 
 func TestAnnotation_GetAttrValueAsString(t *testing.T) {
@@ -111,7 +207,49 @@ func TestAnnotation_GetAttrValueAsString(t *testing.T) {
 		assert.Equal(t, "value", getAttrValueAsString(attr))
 	})
 
+	t.Run("Escaped value", func(t *testing.T) {
+		hclFile, diags := hclwrite.ParseConfig([]byte(`attr = "a \"b\" $${c}"`), "", hcl.InitialPos)
+		assert.False(t, diags.HasErrors())
+		assert.Equal(t, `a "b" ${c}`, getAttrValueAsString(hclFile.Body().GetAttribute("attr")))
+	})
+
+	t.Run("Interpolated value", func(t *testing.T) {
+		hclFile, diags := hclwrite.ParseConfig([]byte(`attr = "registry/${var.x}"`), "", hcl.InitialPos)
+		assert.False(t, diags.HasErrors())
+		assert.Equal(t, `"registry/${var.x}"`, getAttrValueAsString(hclFile.Body().GetAttribute("attr")))
+	})
+
 	t.Run("Nil attribute", func(t *testing.T) {
 		assert.Equal(t, "", getAttrValueAsString(nil))
 	})
 }
+
+func TestAnnotation_LocalPathModuleRoots(t *testing.T) {
+	root := t.TempDir()
+	opts := LoadOptions{ModuleRoots: map[string]string{"mods": filepath.Join(root, "modules")}}
+	filePath := filepath.Join(root, "live", "dev", "main.tf")
+
+	testCases := []struct {
+		name     string
+		path     string
+		expected string
+	}{
+		{"Plain path", "../modules/vpc", "../modules/vpc"},
+		{"Module root", "@mods/vpc", "../../modules/vpc"},
+		{"Module root with subdir", "@mods/repo//vpc", "../../modules/repo//vpc"},
+		{"Unknown module root", "@other/vpc", "@other/vpc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			annotation := DevAnnotation{Path: tc.path}
+			assert.Equal(t, tc.expected, annotation.localPath(filePath, opts))
+		})
+	}
+
+	t.Run("Below the file", func(t *testing.T) {
+		annotation := DevAnnotation{Path: "@local/vpc"}
+		local := LoadOptions{ModuleRoots: map[string]string{"local": filepath.Join(root, "live", "dev", "modules")}}
+		assert.Equal(t, "./modules/vpc", annotation.localPath(filePath, local))
+	})
+}
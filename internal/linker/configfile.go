@@ -0,0 +1,160 @@
+package linker
+
+import (
+	"bytes"
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/apparentlymart/go-textseg/v15/textseg"
+	"github.com/hashicorp/hcl/v2"
+	"github.com/pmezard/go-difflib/difflib"
+)
+
+// jsonFileSuffix is the file name suffix of Terraform JSON configuration files.
+const jsonFileSuffix = ".tf.json"
+
+// advancePos returns the position following text, starting at pos. Like
+// hcl.Pos, columns count grapheme clusters rather than bytes.
+func advancePos(pos hcl.Pos, text []byte) hcl.Pos {
+	pos.Byte += len(text)
+	for {
+		i := bytes.IndexByte(text, '\n')
+		if i < 0 {
+			break
+		}
+		pos.Line++
+		pos.Column = 1
+		text = text[i+1:]
+	}
+	columns, _ := textseg.TokenCount(text, textseg.ScanGraphemeClusters)
+	pos.Column += columns
+	return pos
+}
+
+// ConfigFile is a Terraform configuration file that terralink can inspect and
+// rewrite. HCLFile handles the native syntax and JSONFile the JSON syntax.
+type ConfigFile interface {
+	// Path returns the path the file was read from.
+	Path() string
+	// Modules returns the linkable modules declared in the file.
+	Modules() []LinkableModule
+	// Bytes returns the current in-memory content of the file.
+	Bytes() []byte
+	// Changed reports whether the in-memory content differs from the disk content.
+	Changed() bool
+	// Diff returns a unified diff of the pending in-memory changes.
+	Diff() (string, error)
+	// Write saves the in-memory content back to disk.
+	Write() error
+	// Restore writes the content read from disk back, undoing a Write.
+	Restore() error
+}
+
+// LinkableModule is a module declaration within a ConfigFile that can be
+// switched between its original source and a local development path.
+type LinkableModule interface {
+	// Name returns the name of the module.
+	Name() string
+	// Source returns the current value of the module's source.
+	Source() string
+	// DevAnnotation returns the module's dev annotation.
+	DevAnnotation() (DevAnnotation, bool)
+	// DevSource returns the source the module is switched to when loaded.
+	DevSource(opts LoadOptions) (string, bool)
+	// State returns the original source and version recorded while loaded.
+	State() (StateAnnotation, bool)
+	// Pos returns the position of the module's declaration within the file.
+	Pos() hcl.Pos
+	// StatePos returns the position of the state annotation within the file,
+	// or the zero position if the module is not loaded.
+	StatePos() hcl.Pos
+	// IsLoaded reports whether the module is in a "loaded" (dev) state.
+	IsLoaded() bool
+	// Load switches the module to its dev source. It returns true on change.
+	Load(opts LoadOptions) (bool, error)
+	// Unload restores the module's original source. It returns true on change.
+	Unload() (bool, error)
+
+	// callSite returns the arguments passed to the module, or false if the
+	// module has no call site to verify.
+	callSite() (moduleCallSite, bool)
+	// stateCount returns the number of state annotations of the module.
+	stateCount() int
+	// malformedStates returns the state annotations of the module that
+	// cannot be parsed.
+	malformedStates() []string
+	// devSources returns every source the module may have been switched to
+	// when loaded: one per alternative of its annotated path.
+	devSources(opts LoadOptions) []string
+	// link gives the module the dev annotation linked to it in links, used
+	// when it has no dev annotation of its own.
+	link(links *Links)
+}
+
+// LoadOptions tunes how a module's dev annotation is turned into a source
+// when loading.
+type LoadOptions struct {
+	// Ref overrides the ref of git dev annotations when not empty.
+	Ref string
+	// ModuleRoots maps the names of module roots that annotated paths can
+	// refer to as "@name/sub/dir" to their directory.
+	ModuleRoots map[string]string
+}
+
+// NewConfigFile reads and parses the configuration file at path, choosing
+// the backend from the file name.
+func NewConfigFile(path string) (ConfigFile, error) {
+	if strings.HasSuffix(path, jsonFileSuffix) {
+		return NewJSONFile(path)
+	}
+	return NewHCLFile(path)
+}
+
+// ParseConfigFile parses the content of the configuration file at path,
+// choosing the backend from the file name, without reading path.
+func ParseConfigFile(path string, content []byte) (ConfigFile, error) {
+	if strings.HasSuffix(path, jsonFileSuffix) {
+		return ParseJSONFile(path, content)
+	}
+	return ParseHCLFile(path, content)
+}
+
+// unifiedDiff returns a unified diff between two versions of a file's content.
+func unifiedDiff(path string, before, after []byte) (string, error) {
+	diff, err := difflib.GetUnifiedDiffString(difflib.UnifiedDiff{
+		A:        splitLines(before),
+		B:        splitLines(after),
+		FromFile: "a/" + diffPath(path),
+		ToFile:   "b/" + diffPath(path),
+		Context:  3,
+	})
+	if err != nil {
+		return "", fmt.Errorf("failed to diff file %s: %w", path, err)
+	}
+	return diff, nil
+}
+
+// noNewlineMarker follows the last line of a diff side that does not end
+// with a newline, as in the output of diff and git.
+const noNewlineMarker = "\\ No newline at end of file\n"
+
+// splitLines splits content into lines that keep their line terminator.
+// Unlike difflib.SplitLines it does not invent an empty trailing line when
+// the content already ends with a newline, and a last line without one is
+// followed by the "\ No newline at end of file" marker, so that adding or
+// removing the final newline shows in the diff.
+func splitLines(content []byte) []string {
+	lines := strings.SplitAfter(string(content), "\n")
+	if lines[len(lines)-1] == "" {
+		return lines[:len(lines)-1]
+	}
+	lines[len(lines)-1] += "\n" + noNewlineMarker
+	return lines
+}
+
+// diffPath returns the path used in diff headers, using forward slashes and
+// no leading slash so that "a/" and "b/" prefixes read naturally.
+func diffPath(path string) string {
+	return strings.TrimPrefix(filepath.ToSlash(path), "/")
+}
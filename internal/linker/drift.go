@@ -0,0 +1,146 @@
+package linker
+
+import (
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+	"terralink/internal/report"
+)
+
+// Rules reported by drift detection, defined with the other rules in package
+// report.
+const (
+	RuleSourceDrift         = report.RuleSourceDrift
+	RuleDuplicateState      = report.RuleDuplicateState
+	RuleOrphanState         = report.RuleOrphanState
+	RuleUnlinkedLocalSource = report.RuleUnlinkedLocalSource
+	RuleMalformedState      = report.RuleMalformedState
+)
+
+// DriftDiagnostic reports a module whose annotations and source disagree.
+type DriftDiagnostic struct {
+	Rule    string
+	Message string
+	File    string
+	Line    int
+	Column  int
+	Module  string
+	// Reason is the message without the module name, e.g. "has 2
+	// terralink-state annotations".
+	Reason string
+	// Source is the current value of the module's source.
+	Source string
+}
+
+// Drift scans the given paths for selected modules that are inconsistent:
+// loaded modules whose source no longer is their dev source, modules with
+// malformed or several state annotations or a state annotation but no dev
+// annotation, and modules using a local "./" or "../" source without a state
+// annotation.
+// The diagnostics are ordered by file and line. With WithRevision the files
+// are read from git instead.
+func (l *Linker) Drift(scanPaths ...string) ([]DriftDiagnostic, error) {
+	diagnosticsPerFile, err := readFiles(l, scanPaths, func(configFile ConfigFile) ([]DriftDiagnostic, error) {
+		var diagnostics []DriftDiagnostic
+		for _, module := range configFile.Modules() {
+			if l.selector.Matches(configFile, module) {
+				diagnostics = append(diagnostics, l.moduleDrift(configFile, module)...)
+			}
+		}
+		return diagnostics, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var diagnostics []DriftDiagnostic
+	for _, fileDiagnostics := range diagnosticsPerFile {
+		diagnostics = append(diagnostics, fileDiagnostics...)
+	}
+	sort.SliceStable(diagnostics, func(i, j int) bool {
+		if diagnostics[i].File != diagnostics[j].File {
+			return diagnostics[i].File < diagnostics[j].File
+		}
+		return diagnostics[i].Line < diagnostics[j].Line
+	})
+	return diagnostics, nil
+}
+
+// moduleDrift returns the inconsistencies of a single module.
+func (l *Linker) moduleDrift(configFile ConfigFile, module LinkableModule) []DriftDiagnostic {
+	source := module.Source()
+	var diagnostics []DriftDiagnostic
+	report := func(rule, format string, args ...any) {
+		pos := module.StatePos()
+		if pos.Line == 0 {
+			pos = module.Pos()
+		}
+		reason := fmt.Sprintf(format, args...)
+		diagnostics = append(diagnostics, DriftDiagnostic{
+			Rule:    rule,
+			Message: fmt.Sprintf("Module '%s' %s.", module.Name(), reason),
+			Reason:  reason,
+			File:    configFile.Path(),
+			Line:    pos.Line,
+			Column:  pos.Column,
+			Module:  module.Name(),
+			Source:  source,
+		})
+	}
+
+	malformed := module.malformedStates()
+	for _, comment := range malformed {
+		report(RuleMalformedState, "has a malformed terralink-state annotation '%s'; run 'terralink repair'", comment)
+	}
+
+	state, loaded := module.State()
+	if !loaded {
+		// A malformed state still shows the module was loaded by terralink.
+		if isLocalSource(source) && len(malformed) == 0 {
+			report(RuleUnlinkedLocalSource, "uses the local source '%s' without a terralink-state annotation; it was probably linked by hand", source)
+		}
+		return diagnostics
+	}
+
+	if count := module.stateCount(); count > 1 {
+		report(RuleDuplicateState, "has %d terralink-state annotations", count)
+	}
+	if _, annotated := module.DevAnnotation(); !annotated {
+		report(RuleOrphanState, "has a terralink-state annotation but no dev annotation")
+		return diagnostics
+	}
+
+	devSources := module.devSources(l.loadOptions)
+	for _, devSource := range devSources {
+		if sameSource(source, devSource) {
+			return diagnostics
+		}
+	}
+	switch {
+	case sameSource(source, state.Source):
+		report(RuleSourceDrift, "is loaded but its source was restored to the original '%s' by hand", state.Source)
+	case len(devSources) == 0:
+		report(RuleSourceDrift, "is loaded from '%s' but its dev annotation cannot be resolved", source)
+	default:
+		report(RuleSourceDrift, "is loaded from '%s' but its dev annotation resolves to '%s'; the source was edited by hand", source, devSources[0])
+	}
+	return diagnostics
+}
+
+// sameSource reports whether two module sources are the same, ignoring
+// their "?" query string (so that a git source loaded with another ref still
+// matches) and differences in how local paths are written.
+func sameSource(a, b string) bool {
+	a, _, _ = strings.Cut(a, "?")
+	b, _, _ = strings.Cut(b, "?")
+	if a == b {
+		return true
+	}
+	if !isLocalSource(a) || !isLocalSource(b) {
+		return false
+	}
+	aBase, aSubdir := splitSourceSubdir(a)
+	bBase, bSubdir := splitSourceSubdir(b)
+	return path.Clean(aBase) == path.Clean(bBase) && aSubdir == bSubdir
+}
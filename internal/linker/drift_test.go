@@ -0,0 +1,189 @@
+package linker
+
+import (
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinker_Drift(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name          string
+		hcl           string
+		expectedRules []string
+		expectedText  string
+	}{
+		{
+			name: "Consistent loaded module",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+`,
+		},
+		{
+			name: "Loaded from another alternative",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc|../other/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../other/vpc/"
+}
+`,
+		},
+		{
+			name: "Git module loaded with another ref",
+			hcl: `
+module "vpc" {
+  # terralink: git=git::ssh://git@host/org/vpc.git ref=main
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "git::ssh://git@host/org/vpc.git?ref=feature/x"
+}
+`,
+		},
+		{
+			name: "Source edited by hand",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc-fork"
+}
+`,
+			expectedRules: []string{RuleSourceDrift},
+			expectedText:  "is loaded from '../modules/vpc-fork' but its dev annotation resolves to '../modules/vpc'",
+		},
+		{
+			name: "Source restored by hand",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "my-registry/vpc/aws"
+}
+`,
+			expectedRules: []string{RuleSourceDrift},
+			expectedText:  "restored to the original 'my-registry/vpc/aws' by hand",
+		},
+		{
+			name: "Duplicate state",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+`,
+			expectedRules: []string{RuleDuplicateState},
+			expectedText:  "has 2 terralink-state annotations",
+		},
+		{
+			name: "State without dev annotation",
+			hcl: `
+module "vpc" {
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+`,
+			expectedRules: []string{RuleOrphanState},
+			expectedText:  "has a terralink-state annotation but no dev annotation",
+		},
+		{
+			name: "Malformed state",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state source=my-registry/vpc/aws
+  source = "my-registry/vpc/aws"
+}
+`,
+			expectedRules: []string{RuleMalformedState},
+			expectedText:  "has a malformed terralink-state annotation",
+		},
+		{
+			name: "Malformed state of a loaded module",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state source=my-registry/vpc/aws
+  source = "../modules/vpc"
+}
+`,
+			expectedRules: []string{RuleMalformedState},
+			expectedText:  "has a malformed terralink-state annotation",
+		},
+		{
+			name: "Linked by hand",
+			hcl: `
+module "vpc" {
+  source = "../modules/vpc"
+}
+`,
+			expectedRules: []string{RuleUnlinkedLocalSource},
+			expectedText:  "uses the local source '../modules/vpc' without a terralink-state annotation",
+		},
+		{
+			name: "Remote source",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source = "my-registry/vpc/aws"
+}
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "main.tf")
+			require.NoError(t, os.WriteFile(filePath, []byte(tc.hcl), 0644))
+
+			diagnostics, err := NewLinker(matcher).Drift(dir)
+			require.NoError(t, err)
+
+			var rules []string
+			for _, diagnostic := range diagnostics {
+				rules = append(rules, diagnostic.Rule)
+				assert.Equal(t, "vpc", diagnostic.Module)
+				assert.Equal(t, filePath, diagnostic.File)
+				assert.Contains(t, diagnostic.Message, tc.expectedText)
+			}
+			assert.Equal(t, tc.expectedRules, rules)
+		})
+	}
+}
+
+func TestLinker_DriftPositions(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), []byte(`
+module "loaded" {
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+
+module "linked" {
+  source = "./modules/vpc"
+}
+`), 0644))
+
+	diagnostics, err := NewLinker(matcher).Drift(dir)
+	require.NoError(t, err)
+	require.Len(t, diagnostics, 2)
+	// State diagnostics point at the state annotation, others at the block.
+	assert.Equal(t, [2]int{3, 3}, [2]int{diagnostics[0].Line, diagnostics[0].Column})
+	assert.Equal(t, [2]int{7, 1}, [2]int{diagnostics[1].Line, diagnostics[1].Column})
+}
@@ -0,0 +1,195 @@
+package linker
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"terralink/internal/ignore"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// StagedRevision is the revision of WithRevision naming the git index, i.e.
+// the content about to be committed.
+const StagedRevision = ":"
+
+// WithRevision makes Check and Drift read the configuration files from git
+// instead of the working tree: the files staged in the index with
+// StagedRevision, the files added or modified by a commit, or the files that
+// differ between the two ends of a range such as "base..rev" or
+// "base...rev". Files are parsed from their content in git, at the commit or
+// at the end of the range, and reported at their path in the working tree.
+func WithRevision(rev string) Option {
+	return func(l *Linker) {
+		l.revision = rev
+	}
+}
+
+// readFiles applies processor to the configuration files under scanPaths,
+// read from git if the linker has a revision or else from the working tree.
+func readFiles[T any](l *Linker, scanPaths []string, processor fileProcessor[T]) (map[string]T, error) {
+	if l.revision == "" {
+		return processFiles(scanPaths, l.matcher, l.links, processor)
+	}
+	return processGitFiles(l.revision, scanPaths, l.matcher, l.links, processor)
+}
+
+// processGitFiles is like processFiles for the configuration files under
+// scanPaths that are staged (rev is StagedRevision) or that revision rev adds
+// or modifies, parsed from their content in git.
+func processGitFiles[T any](rev string, scanPaths []string, matcher *ignore.IgnoreMatcher, links *Links, processor fileProcessor[T]) (map[string]T, error) {
+	results := make(map[string]T)
+	seen := make(map[string]bool)
+
+	for _, scanPath := range scanPaths {
+		dir, pathspec := scanPath, "."
+		if info, err := os.Stat(scanPath); err == nil && !info.IsDir() {
+			dir, pathspec = filepath.Dir(scanPath), filepath.Base(scanPath)
+		}
+
+		base, head, err := gitResolveRevision(dir, rev)
+		if err != nil {
+			return nil, err
+		}
+		names, err := gitChangedFiles(dir, base, head, pathspec)
+		if err != nil {
+			return nil, err
+		}
+		for _, name := range names {
+			path := filepath.Join(dir, filepath.FromSlash(name))
+			if !isConfigFileName(path) || matcher.ShouldIgnore(path) {
+				continue
+			}
+			if absPath, err := filepath.Abs(path); err == nil {
+				if seen[absPath] {
+					continue
+				}
+				seen[absPath] = true
+			}
+
+			object := head + ":./" + name
+			if head == StagedRevision {
+				object = ":./" + name
+			}
+			content, err := gitOutput(dir, "show", object)
+			if err != nil {
+				return nil, fmt.Errorf("failed to read %s: %w", object, err)
+			}
+			configFile, err := ParseConfigFile(path, content)
+			if err != nil {
+				log.Errorf("Warning: skipping file due to parsing error: %v\n", err)
+				continue
+			}
+			if links != nil {
+				for _, module := range configFile.Modules() {
+					module.link(links)
+				}
+			}
+
+			result, err := processor(configFile)
+			if err != nil {
+				return nil, fmt.Errorf("error processing file %s: %w", path, err)
+			}
+			if !reflect.ValueOf(result).IsZero() {
+				results[path] = result
+			}
+		}
+	}
+	return results, nil
+}
+
+// gitResolveRevision resolves rev to the commit hashes of the base and head
+// of the changes to check. For a single commit the base is empty; for a range
+// "base..head" it is the base commit, and for "base...head" the merge base of
+// both ends. StagedRevision resolves to itself.
+func gitResolveRevision(dir, rev string) (string, string, error) {
+	if rev == StagedRevision {
+		return "", StagedRevision, nil
+	}
+	from, to, isRange := strings.Cut(rev, "...")
+	symmetric := isRange
+	if !isRange {
+		from, to, isRange = strings.Cut(rev, "..")
+	}
+	if !isRange {
+		head, err := gitCommit(dir, rev)
+		return "", head, err
+	}
+
+	base, err := gitCommit(dir, from)
+	if err != nil {
+		return "", "", err
+	}
+	head, err := gitCommit(dir, to)
+	if err != nil {
+		return "", "", err
+	}
+	if symmetric {
+		output, err := gitOutput(dir, "merge-base", base, head)
+		if err != nil {
+			return "", "", err
+		}
+		base = strings.TrimSpace(string(output))
+	}
+	return base, head, nil
+}
+
+// gitCommit resolves a revision to a commit hash, defaulting to HEAD. The
+// revision is never parsed as an option, even if it starts with a dash.
+func gitCommit(dir, rev string) (string, error) {
+	if rev == "" {
+		rev = "HEAD"
+	}
+	output, err := gitOutput(dir, "rev-parse", "--verify", "--quiet", "--end-of-options", rev+"^{commit}")
+	if err != nil {
+		return "", fmt.Errorf("unknown commit %q: %w", rev, err)
+	}
+	return strings.TrimSpace(string(output)), nil
+}
+
+// gitChangedFiles returns the paths, relative to dir, of the files matching
+// pathspec that are staged (head is StagedRevision), that differ between the
+// commits base and head, or, without a base, that commit head adds or
+// modifies. A merge commit is compared with its first parent, so the files it
+// brings in are included. Deleted files are left out.
+func gitChangedFiles(dir, base, head, pathspec string) ([]string, error) {
+	var args []string
+	switch {
+	case head == StagedRevision:
+		args = []string{"diff", "--cached"}
+	case base != "":
+		args = []string{"diff", base, head}
+	default:
+		args = []string{"log", "-1", "-m", "--first-parent", "--format=", head}
+	}
+	args = append(args, "--name-only", "--relative", "-z", "--diff-filter=ACMR", "--", pathspec)
+	output, err := gitOutput(dir, args...)
+	if err != nil {
+		return nil, err
+	}
+
+	var names []string
+	for _, name := range strings.Split(string(output), "\x00") {
+		if name != "" {
+			names = append(names, name)
+		}
+	}
+	return names, nil
+}
+
+// gitOutput runs a git command in dir and returns its output.
+func gitOutput(dir string, args ...string) ([]byte, error) {
+	cmd := exec.Command("git", args...)
+	cmd.Dir = dir
+	var stderr bytes.Buffer
+	cmd.Stderr = &stderr
+	output, err := cmd.Output()
+	if err != nil {
+		return nil, fmt.Errorf("git %s failed in %s: %w: %s", strings.Join(args, " "), dir, err, strings.TrimSpace(stderr.String()))
+	}
+	return output, nil
+}
@@ -0,0 +1,132 @@
+package linker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinker_CheckRevision(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	const loaded = `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+`
+	const unloaded = `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source = "my-registry/vpc/aws"
+}
+`
+	repoDir := t.TempDir()
+	git := func(args ...string) {
+		t.Helper()
+		cmd := exec.Command("git", append([]string{"-c", "user.name=test", "-c", "user.email=test@example.com"}, args...)...)
+		cmd.Dir = repoDir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, output)
+		}
+	}
+	write := func(name, content string) {
+		t.Helper()
+		path := filepath.Join(repoDir, name)
+		require.NoError(t, os.MkdirAll(filepath.Dir(path), 0755))
+		require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+	}
+
+	git("init", "-q")
+	write("live/main.tf", unloaded)
+	write("live/other.tf", unloaded)
+	git("add", ".")
+	git("commit", "-q", "-m", "initial")
+
+	// other.tf is loaded in the working tree but not staged; main.tf is
+	// staged loaded, then unloaded in the working tree.
+	write("live/other.tf", loaded)
+	write("live/main.tf", loaded)
+	git("add", "live/main.tf")
+	write("live/main.tf", unloaded)
+
+	liveDir := filepath.Join(repoDir, "live")
+	mainPath := filepath.Join(liveDir, "main.tf")
+
+	t.Run("Working tree", func(t *testing.T) {
+		modules, err := NewLinker(matcher).Check(liveDir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(liveDir, "other.tf")}, sortedKeys(modules))
+	})
+
+	t.Run("Staged", func(t *testing.T) {
+		modules, err := NewLinker(matcher, WithRevision(StagedRevision)).Check(liveDir)
+		require.NoError(t, err)
+		require.Equal(t, []string{mainPath}, sortedKeys(modules))
+		assert.Equal(t, 4, modules[mainPath][0].Line)
+
+		diagnostics, err := NewLinker(matcher, WithRevision(StagedRevision)).Drift(liveDir)
+		require.NoError(t, err)
+		assert.Empty(t, diagnostics)
+	})
+
+	git("commit", "-q", "-m", "load vpc")
+
+	t.Run("Revision", func(t *testing.T) {
+		modules, err := NewLinker(matcher, WithRevision("HEAD")).Check(liveDir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{mainPath}, sortedKeys(modules))
+
+		modules, err = NewLinker(matcher, WithRevision("HEAD~1")).Check(liveDir)
+		require.NoError(t, err)
+		assert.Empty(t, modules)
+	})
+
+	t.Run("Unknown revision", func(t *testing.T) {
+		_, err := NewLinker(matcher, WithRevision("does-not-exist")).Check(liveDir)
+		assert.Error(t, err)
+	})
+
+	// A merge commit bringing in a loaded module from a branch.
+	git("reset", "-q", "--hard")
+	git("checkout", "-q", "-b", "feature", "HEAD~1")
+	write("live/feature.tf", loaded)
+	git("add", ".")
+	git("commit", "-q", "-m", "load feature")
+	git("checkout", "-q", "-")
+	git("merge", "-q", "--no-ff", "-m", "merge feature", "feature")
+
+	t.Run("Merge commit", func(t *testing.T) {
+		modules, err := NewLinker(matcher, WithRevision("HEAD")).Check(liveDir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(liveDir, "feature.tf")}, sortedKeys(modules))
+	})
+
+	t.Run("Range", func(t *testing.T) {
+		// The module loaded by the first commit after the base is checked too.
+		modules, err := NewLinker(matcher, WithRevision("HEAD~2..HEAD")).Check(liveDir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{filepath.Join(liveDir, "feature.tf"), mainPath}, sortedKeys(modules))
+
+		modules, err = NewLinker(matcher, WithRevision("feature...HEAD")).Check(liveDir)
+		require.NoError(t, err)
+		assert.Equal(t, []string{mainPath}, sortedKeys(modules))
+	})
+
+	t.Run("Option-like revision", func(t *testing.T) {
+		output := filepath.Join(t.TempDir(), "output")
+		_, err := NewLinker(matcher, WithRevision("--output="+output)).Check(liveDir)
+		assert.ErrorContains(t, err, "unknown commit")
+		assert.NoFileExists(t, output)
+	})
+}
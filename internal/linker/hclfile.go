@@ -1,18 +1,32 @@
 package linker
 
 import (
+	"bytes"
 	"fmt"
 	"os"
+	"strings"
 
 	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 )
 
+// utf8BOM is the byte order mark some editors write at the start of UTF-8
+// files.
+const utf8BOM = "\xEF\xBB\xBF"
+
 // HCLFile represents a single Terraform (.tf) file. It encapsulates the file path,
 // the parsed HCL content, and the modules defined within it.
 type HCLFile struct {
-	path    string
-	hclFile *hclwrite.File
+	path     string
+	original []byte
+	hclFile  *hclwrite.File
+	// spacing keeps the whitespace of the content that is not only spaces.
+	spacing spacing
+	// format makes Bytes format the whole content like 'terraform fmt'.
+	format bool
+	// bom reports whether the content starts with a byte order mark.
+	bom     bool
 	modules []*Module
 }
 
@@ -24,29 +38,68 @@ func NewHCLFile(path string) (*HCLFile, error) {
 	if err != nil {
 		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
 	}
+	return ParseHCLFile(path, content)
+}
 
-	hclFile, diags := hclwrite.ParseConfig(content, path, hcl.InitialPos)
+// ParseHCLFile parses the content of a Terraform file, e.g. read from git,
+// without reading path.
+func ParseHCLFile(path string, content []byte) (*HCLFile, error) {
+	body, bom := bytes.CutPrefix(content, []byte(utf8BOM))
+	hclFile, diags := hclwrite.ParseConfig(body, path, hcl.InitialPos)
 	if diags.HasErrors() {
 		return nil, fmt.Errorf("failed to parse HCL in %s: %w", path, diags)
 	}
 
-	return &HCLFile{path: path, hclFile: hclFile}, nil
+	spacing := spacing{}
+	spacing.record(body, hclFile.BuildTokens(nil))
+	return &HCLFile{
+		path:     path,
+		original: content,
+		hclFile:  hclFile,
+		spacing:  spacing,
+		bom:      bom,
+	}, nil
+}
+
+// Path returns the path the file was read from.
+func (f *HCLFile) Path() string {
+	return f.path
 }
 
-// Modules returns a slice of all "module" blocks found in the HCL file.
+// Modules returns a slice of all "module" blocks found in the HCL file,
+// together with any Terragrunt "terraform" block that declares a source.
 // It parses the blocks on the first call and caches the result.
-func (f *HCLFile) Modules() []*Module {
+func (f *HCLFile) Modules() []LinkableModule {
+	modules := make([]LinkableModule, len(f.hclModules()))
+	for i, module := range f.hclModules() {
+		modules[i] = module
+	}
+	return modules
+}
+
+// hclModules returns the modules of the file with their concrete type.
+func (f *HCLFile) hclModules() []*Module {
 	if f.modules != nil {
 		return f.modules
 	}
 
 	f.modules = []*Module{}
 	for _, block := range f.hclFile.Body().Blocks() {
-		if block.Type() == "module" {
+		switch block.Type() {
+		case "module":
 			// We expect module blocks to have exactly one label (the module name).
 			if len(block.Labels()) == 1 {
 				moduleName := block.Labels()[0]
-				f.modules = append(f.modules, NewModule(moduleName, block))
+				module := NewModule(moduleName, block)
+				module.file = f
+				f.modules = append(f.modules, module)
+			}
+		case "terraform":
+			// Terraform's own settings block has no source; only Terragrunt's does.
+			if len(block.Labels()) == 0 && block.Body().GetAttribute("source") != nil {
+				module := NewTerragruntModule(block)
+				module.file = f
+				f.modules = append(f.modules, module)
 			}
 		}
 	}
@@ -54,13 +107,133 @@ func (f *HCLFile) Modules() []*Module {
 }
 
 // Write saves the current in-memory representation of the HCL file
-// back to disk, overwriting the original file.
+// back to disk, atomically replacing the original file.
 func (f *HCLFile) Write() error {
-	// Format the file before writing
-	f.hclFile.Body().BuildTokens(nil)
-	err := os.WriteFile(f.path, f.hclFile.Bytes(), 0644)
-	if err != nil {
+	if err := writeFileAtomic(f.path, f.Bytes()); err != nil {
 		return fmt.Errorf("failed to write file %s: %w", f.path, err)
 	}
 	return nil
 }
+
+// Restore writes the content that was read from disk back to the file.
+func (f *HCLFile) Restore() error {
+	if err := writeFileAtomic(f.path, f.original); err != nil {
+		return fmt.Errorf("failed to restore file %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// position returns the start position of the given token within the file's
+// current content. It returns the zero position if the token does not belong
+// to the file.
+func (f *HCLFile) position(target *hclwrite.Token) hcl.Pos {
+	pos := hcl.InitialPos
+	if f.bom {
+		pos.Byte += len(utf8BOM)
+	}
+	for _, token := range f.hclFile.BuildTokens(nil) {
+		pos.Column += token.SpacesBefore
+		pos.Byte += token.SpacesBefore
+		if token == target {
+			return pos
+		}
+		pos = advancePos(pos, token.Bytes)
+	}
+	return hcl.Pos{}
+}
+
+// Bytes returns the current in-memory content of the file. Unless the file
+// is to be formatted, the parts of the file that were not changed are
+// written back byte for byte.
+func (f *HCLFile) Bytes() []byte {
+	content := f.spacing.bytes(f.hclFile.BuildTokens(nil))
+	if f.format {
+		content = hclwrite.Format(content)
+	}
+	if f.bom {
+		content = append([]byte(utf8BOM), content...)
+	}
+	return content
+}
+
+// spacing holds the whitespace before tokens that is not only made of
+// spaces, e.g. tabs, which hclwrite counts in SpacesBefore and writes back
+// as spaces.
+type spacing map[*hclwrite.Token]string
+
+// record adds the whitespace before the tokens hclwrite parsed from content.
+// It does nothing if the tokens do not match the content.
+func (s spacing) record(content []byte, tokens hclwrite.Tokens) {
+	if s == nil {
+		return
+	}
+	lexed, _ := hclsyntax.LexConfig(content, "", hcl.InitialPos)
+	if len(lexed) != len(tokens) {
+		return
+	}
+	last := 0
+	for i, token := range lexed {
+		if whitespace := string(content[last:token.Range.Start.Byte]); strings.Trim(whitespace, " ") != "" {
+			s[tokens[i]] = whitespace
+		}
+		last = token.Range.End.Byte
+	}
+}
+
+// before returns the whitespace written before a token.
+func (s spacing) before(token *hclwrite.Token) string {
+	if whitespace, found := s[token]; found && len(whitespace) == token.SpacesBefore {
+		return whitespace
+	}
+	return strings.Repeat(" ", token.SpacesBefore)
+}
+
+// copy gives a token the whitespace before another one.
+func (s spacing) copy(from, to *hclwrite.Token) {
+	to.SpacesBefore = from.SpacesBefore
+	if whitespace, found := s[from]; found {
+		s[to] = whitespace
+	}
+}
+
+// expr returns the text of the tokens of an attribute after its equals sign,
+// up to the token ending its line: the expression, followed by its trailing
+// comment unless it is a dev annotation.
+func (s spacing) expr(tokens hclwrite.Tokens) string {
+	end := tokens[len(tokens)-1]
+	tokens = append(hclwrite.Tokens{}, tokens[:len(tokens)-1]...)
+	if end.Type == hclsyntax.TokenComment && !isDevComment(end) {
+		comment := &hclwrite.Token{Type: end.Type, Bytes: []byte(strings.TrimSuffix(string(end.Bytes), lineEnding(end)))}
+		s.copy(end, comment)
+		tokens = append(tokens, comment)
+	}
+	if len(tokens) == 0 {
+		return ""
+	}
+	return strings.TrimPrefix(string(s.bytes(tokens)), s.before(tokens[0]))
+}
+
+// bytes writes tokens together with the whitespace before them.
+func (s spacing) bytes(tokens hclwrite.Tokens) []byte {
+	var buf bytes.Buffer
+	for _, token := range tokens {
+		buf.WriteString(s.before(token))
+		buf.Write(token.Bytes)
+	}
+	return buf.Bytes()
+}
+
+// Changed reports whether the in-memory content differs from the content
+// that was read from disk.
+func (f *HCLFile) Changed() bool {
+	return !bytes.Equal(f.original, f.Bytes())
+}
+
+// Diff returns a unified diff between the content read from disk and the
+// current in-memory content. It returns an empty string if nothing changed.
+func (f *HCLFile) Diff() (string, error) {
+	if !f.Changed() {
+		return "", nil
+	}
+	return unifiedDiff(f.path, f.original, f.Bytes())
+}
@@ -0,0 +1,95 @@
+package linker
+
+import (
+	"regexp"
+	"testing"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestHCLFile_LineEndings(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		wantNewline string
+		wantBOM     bool
+	}{
+		{
+			name:        "LF",
+			content:     "module \"vpc\" {\n  # terralink: path=../vpc\n  source  = \"my-registry/vpc/aws\"\n  version = \"1.0.0\"\n}\n",
+			wantNewline: "\n",
+		},
+		{
+			name:        "CRLF",
+			content:     "module \"vpc\" {\r\n  # terralink: path=../vpc\r\n  source  = \"my-registry/vpc/aws\"\r\n  version = \"1.0.0\"\r\n}\r\n",
+			wantNewline: "\r\n",
+		},
+		{
+			name:        "Mostly CRLF",
+			content:     "module \"vpc\" {\r\n  # terralink: path=../vpc\n  source  = \"my-registry/vpc/aws\"\r\n  version = \"1.0.0\"\n}\r\n",
+			wantNewline: "\r\n",
+		},
+		{
+			name:        "Mostly LF",
+			content:     "module \"vpc\" {\n  # terralink: path=../vpc\r\n  source  = \"my-registry/vpc/aws\"\n  version = \"1.0.0\"\r\n}\n",
+			wantNewline: "\n",
+		},
+		{
+			name:        "BOM",
+			content:     utf8BOM + "module \"vpc\" {\r\n  # terralink: path=../vpc\r\n  source = \"my-registry/vpc/aws\"\r\n}\r\n",
+			wantNewline: "\r\n",
+			wantBOM:     true,
+		},
+	}
+	stateLine := regexp.MustCompile(`# terralink-state:[^\r\n]*(\r?\n)`)
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			file, err := ParseHCLFile("main.tf", []byte(tc.content))
+			require.NoError(t, err)
+			assert.Equal(t, tc.wantBOM, file.bom)
+			assert.Equal(t, tc.content, string(file.Bytes()))
+			assert.Equal(t, 1, file.position(file.hclModules()[0].block.BuildTokens(nil)[0]).Line)
+
+			for _, module := range file.hclModules() {
+				_, err := module.Load(LoadOptions{})
+				require.NoError(t, err)
+			}
+			loaded := string(file.Bytes())
+			match := stateLine.FindStringSubmatch(loaded)
+			require.NotNil(t, match, "no state annotation in\n%q", loaded)
+			assert.Equal(t, tc.wantNewline, match[1])
+			assert.Equal(t, tc.wantBOM, loaded[:len(utf8BOM)] == utf8BOM)
+
+			file.format = true
+			assert.Equal(t, tc.wantBOM, string(file.Bytes()[:len(utf8BOM)]) == utf8BOM)
+		})
+	}
+}
+
+func TestHCLFile_Position(t *testing.T) {
+	content := "module \"vpc\" {\n  name = \"日本🇫🇷\" # note\n}\n"
+	file, err := ParseHCLFile("main.tf", []byte(content))
+	require.NoError(t, err)
+
+	var comment *hclwrite.Token
+	for _, token := range file.hclModules()[0].block.BuildTokens(nil) {
+		if token.Type == hclsyntax.TokenComment {
+			comment = token
+		}
+	}
+	require.NotNil(t, comment)
+
+	tokens, diags := hclsyntax.LexConfig([]byte(content), "main.tf", hcl.InitialPos)
+	require.False(t, diags.HasErrors())
+	for _, token := range tokens {
+		if token.Type == hclsyntax.TokenComment {
+			assert.Equal(t, token.Range.Start, file.position(comment))
+		}
+	}
+	assert.Equal(t, hcl.Pos{Line: 2, Column: 16, Byte: 41}, file.position(comment))
+}
@@ -0,0 +1,630 @@
+package linker
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/sirupsen/logrus"
+)
+
+// Keys used by terralink inside the "//" comment property of JSON modules.
+const (
+	jsonCommentKey = "//"
+	jsonDevKey     = "terralink"
+	jsonStateKey   = "terralink-state"
+	jsonSourceKey  = "source"
+	jsonVersionKey = "version"
+	jsonModuleKey  = "module"
+)
+
+// jsonDevAnnotationRegex matches a dev annotation written as a JSON comment
+// string, e.g. "terralink: path=../local".
+var jsonDevAnnotationRegex = regexp.MustCompile(`^\s*terralink:\s*(.*)$`)
+
+// jsonState is the state recorded in the "//" property of a loaded JSON
+// module. Besides the original source and version it keeps the raw JSON text
+// that was replaced, so that unloading restores the file byte for byte.
+type jsonState struct {
+	Source  string       `json:"source"`
+	Version string       `json:"version,omitempty"`
+	Raw     jsonRawState `json:"raw"`
+}
+
+// jsonRawState holds the original JSON text replaced by a load.
+type jsonRawState struct {
+	// Comment is the original value of the "//" property, or empty if the
+	// load added the property.
+	Comment string `json:"comment"`
+	// Source is the original value of the "source" property.
+	Source string `json:"source"`
+	// Version is the removed "version" property including its separator.
+	Version string `json:"version,omitempty"`
+	// After and Before name the property the version was removed next to.
+	After  string `json:"after,omitempty"`
+	Before string `json:"before,omitempty"`
+}
+
+// JSONFile represents a single Terraform JSON configuration (.tf.json) file.
+// Edits are applied directly to the raw content so that everything outside
+// the rewritten properties keeps its original formatting.
+type JSONFile struct {
+	path     string
+	original []byte
+	content  []byte
+	modules  []*JSONModule
+}
+
+// NewJSONFile reads and parses a Terraform JSON file from the given path.
+func NewJSONFile(path string) (*JSONFile, error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	return ParseJSONFile(path, content)
+}
+
+// ParseJSONFile parses the content of a Terraform JSON file, e.g. read from
+// git, without reading path.
+func ParseJSONFile(path string, content []byte) (*JSONFile, error) {
+	if _, err := parseJSONSpans(content); err != nil {
+		return nil, fmt.Errorf("failed to parse JSON in %s: %w", path, err)
+	}
+	return &JSONFile{path: path, original: content, content: content}, nil
+}
+
+// Path returns the path the file was read from.
+func (f *JSONFile) Path() string {
+	return f.path
+}
+
+// Modules returns the module blocks declared in the file.
+func (f *JSONFile) Modules() []LinkableModule {
+	if f.modules == nil {
+		f.modules = []*JSONModule{}
+		for i, name := range f.moduleNames() {
+			f.modules = append(f.modules, &JSONModule{file: f, name: name, index: i})
+		}
+	}
+	modules := make([]LinkableModule, len(f.modules))
+	for i, module := range f.modules {
+		modules[i] = module
+	}
+	return modules
+}
+
+// Bytes returns the current in-memory content of the file.
+func (f *JSONFile) Bytes() []byte {
+	return f.content
+}
+
+// Changed reports whether the in-memory content differs from the content
+// that was read from disk.
+func (f *JSONFile) Changed() bool {
+	return !bytes.Equal(f.original, f.content)
+}
+
+// Diff returns a unified diff between the content read from disk and the
+// current in-memory content. It returns an empty string if nothing changed.
+func (f *JSONFile) Diff() (string, error) {
+	if !f.Changed() {
+		return "", nil
+	}
+	return unifiedDiff(f.path, f.original, f.content)
+}
+
+// Write saves the current in-memory content back to disk, atomically
+// replacing the original file.
+func (f *JSONFile) Write() error {
+	if err := writeFileAtomic(f.path, f.content); err != nil {
+		return fmt.Errorf("failed to write file %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Restore writes the content that was read from disk back to the file.
+func (f *JSONFile) Restore() error {
+	if err := writeFileAtomic(f.path, f.original); err != nil {
+		return fmt.Errorf("failed to restore file %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// namedJSONModule is a module object found in the document.
+type namedJSONModule struct {
+	name string
+	node *jsonNode
+}
+
+// moduleNodes returns every module object of the current content in document
+// order. Terraform accepts both objects and arrays of objects at each level.
+func (f *JSONFile) moduleNodes() []namedJSONModule {
+	root, err := parseJSONSpans(f.content)
+	if err != nil || root.kind != jsonObject {
+		return nil
+	}
+
+	var modules []namedJSONModule
+	var collectModules func(node *jsonNode)
+	collectModules = func(node *jsonNode) {
+		switch node.kind {
+		case jsonArray:
+			for _, elem := range node.elems {
+				collectModules(elem)
+			}
+		case jsonObject:
+			for _, member := range node.members {
+				if member.value.kind == jsonObject {
+					modules = append(modules, namedJSONModule{name: member.key, node: member.value})
+				}
+				if member.value.kind == jsonArray {
+					for _, elem := range member.value.elems {
+						if elem.kind == jsonObject {
+							modules = append(modules, namedJSONModule{name: member.key, node: elem})
+						}
+					}
+				}
+			}
+		}
+	}
+	for _, member := range root.members {
+		if member.key == jsonModuleKey {
+			collectModules(member.value)
+		}
+	}
+	return modules
+}
+
+// moduleNames returns the names of every module object in document order.
+func (f *JSONFile) moduleNames() []string {
+	var names []string
+	for _, module := range f.moduleNodes() {
+		names = append(names, module.name)
+	}
+	return names
+}
+
+// position converts a byte offset of the current content into a position.
+func (f *JSONFile) position(offset int) hcl.Pos {
+	return advancePos(hcl.InitialPos, f.content[:offset])
+}
+
+// JSONModule represents a single module object within a Terraform JSON file.
+// The dev annotation lives in the module's "//" comment property, either as a
+// "terralink: path=..." string (or array element), or as a "terralink" key of
+// a "//" object. The state is added next to it when the module is loaded.
+type JSONModule struct {
+	file  *JSONFile
+	name  string
+	index int
+	// linked is the dev annotation given by a links file, if any.
+	linked *DevAnnotation
+}
+
+// Name returns the name of the module.
+func (m *JSONModule) Name() string {
+	return m.name
+}
+
+// node returns the module's object within the file's current content.
+func (m *JSONModule) node() *jsonNode {
+	modules := m.file.moduleNodes()
+	if m.index >= len(modules) {
+		return &jsonNode{kind: jsonObject}
+	}
+	return modules[m.index].node
+}
+
+// comment returns the module's "//" property, or nil.
+func (m *JSONModule) comment() *jsonMember {
+	return m.node().member(jsonCommentKey)
+}
+
+// Source returns the current value of the module's source property.
+func (m *JSONModule) Source() string {
+	source := m.node().member(jsonSourceKey)
+	if source == nil || source.value.kind != jsonString {
+		return ""
+	}
+	return m.decodeString(source.value)
+}
+
+// DevSource returns the source the module is switched to when loaded.
+func (m *JSONModule) DevSource(opts LoadOptions) (string, bool) {
+	devAnnotation, found := m.DevAnnotation()
+	if !found {
+		return "", false
+	}
+	return devAnnotation.devSource(m.Source(), false, m.file.path, opts), true
+}
+
+// DevAnnotation returns the module's dev annotation: the one in its "//"
+// property, or else the annotation given by a links file.
+func (m *JSONModule) DevAnnotation() (DevAnnotation, bool) {
+	if annotation, found := m.commentAnnotation(); found {
+		return annotation, true
+	}
+	if m.linked != nil {
+		return *m.linked, true
+	}
+	return DevAnnotation{}, false
+}
+
+// link looks the module up in links, to be used when it has no dev
+// annotation in its "//" property.
+func (m *JSONModule) link(links *Links) {
+	if annotation, found := links.annotation(m.file.path, m.name, linkSource(m), false); found {
+		m.linked = &annotation
+	}
+}
+
+// commentAnnotation returns the dev annotation of the module's "//" property.
+func (m *JSONModule) commentAnnotation() (DevAnnotation, bool) {
+	comment := m.comment()
+	if comment == nil {
+		return DevAnnotation{}, false
+	}
+
+	var candidates []*jsonNode
+	switch comment.value.kind {
+	case jsonString:
+		candidates = append(candidates, comment.value)
+	case jsonArray:
+		candidates = append(candidates, comment.value.elems...)
+	case jsonObject:
+		if member := comment.value.member(jsonDevKey); member != nil && member.value.kind == jsonString {
+			return parseDevAnnotationAttrs(m.decodeString(member.value))
+		}
+	}
+
+	for _, candidate := range candidates {
+		if candidate.kind != jsonString {
+			continue
+		}
+		match := jsonDevAnnotationRegex.FindStringSubmatch(m.decodeString(candidate))
+		if len(match) == 2 {
+			if annotation, isDev := parseDevAnnotationAttrs(match[1]); isDev {
+				return annotation, true
+			}
+		}
+	}
+	return DevAnnotation{}, false
+}
+
+// stateNode returns the node holding the state and the decoded state.
+func (m *JSONModule) stateNode() (*jsonNode, jsonState, bool) {
+	nodes, states := m.stateNodes()
+	if len(nodes) == 0 {
+		return nil, jsonState{}, false
+	}
+	return nodes[0], states[0], true
+}
+
+// stateNodes returns every node holding a state in the module's "//"
+// property, together with the decoded states.
+func (m *JSONModule) stateNodes() ([]*jsonNode, []jsonState) {
+	comment := m.comment()
+	if comment == nil {
+		return nil, nil
+	}
+
+	var holders []*jsonNode
+	switch comment.value.kind {
+	case jsonArray:
+		holders = comment.value.elems
+	case jsonObject:
+		holders = []*jsonNode{comment.value}
+	}
+
+	var nodes []*jsonNode
+	var states []jsonState
+	for _, holder := range holders {
+		if holder.kind != jsonObject {
+			continue
+		}
+		member := holder.member(jsonStateKey)
+		if member == nil {
+			continue
+		}
+		var state jsonState
+		if err := json.Unmarshal([]byte(member.value.raw(m.file.content)), &state); err != nil || state.Source == "" {
+			continue
+		}
+		if holder == comment.value {
+			nodes = append(nodes, &jsonNode{start: member.start, end: member.value.end})
+		} else {
+			nodes = append(nodes, holder)
+		}
+		states = append(states, state)
+	}
+	return nodes, states
+}
+
+// stateCount returns the number of states recorded in the module's "//"
+// property.
+func (m *JSONModule) stateCount() int {
+	nodes, _ := m.stateNodes()
+	return len(nodes)
+}
+
+// malformedStates returns the raw "terralink-state" properties of the
+// module's "//" property that cannot be decoded.
+func (m *JSONModule) malformedStates() []string {
+	comment := m.comment()
+	if comment == nil {
+		return nil
+	}
+	holders := []*jsonNode{comment.value}
+	if comment.value.kind == jsonArray {
+		holders = comment.value.elems
+	}
+
+	var malformed []string
+	for _, holder := range holders {
+		if holder.kind != jsonObject {
+			continue
+		}
+		member := holder.member(jsonStateKey)
+		if member == nil {
+			continue
+		}
+		var state jsonState
+		raw := member.value.raw(m.file.content)
+		if err := json.Unmarshal([]byte(raw), &state); err != nil || state.Source == "" {
+			malformed = append(malformed, raw)
+		}
+	}
+	return malformed
+}
+
+// devSources returns every source the module may have been switched to.
+func (m *JSONModule) devSources(opts LoadOptions) []string {
+	devAnnotation, found := m.DevAnnotation()
+	if !found {
+		return nil
+	}
+	return devAnnotation.devSources(linkSource(m), false, m.file.path, opts)
+}
+
+// State returns the original source and version recorded in the module's state.
+func (m *JSONModule) State() (StateAnnotation, bool) {
+	_, state, found := m.stateNode()
+	return StateAnnotation{Source: state.Source, Version: state.Version}, found
+}
+
+// Pos returns the position of the module's object within the file.
+func (m *JSONModule) Pos() hcl.Pos {
+	return m.file.position(m.node().start)
+}
+
+// StatePos returns the position of the module's state within the file.
+func (m *JSONModule) StatePos() hcl.Pos {
+	node, _, found := m.stateNode()
+	if !found {
+		return hcl.Pos{}
+	}
+	return m.file.position(node.start)
+}
+
+// callSite returns the properties passed to the module by its object.
+func (m *JSONModule) callSite() (moduleCallSite, bool) {
+	module := m.node()
+	callSite := moduleCallSite{Pos: m.file.position(module.start), Arguments: map[string]hcl.Pos{}}
+	for _, member := range module.members {
+		if member.key != jsonCommentKey {
+			callSite.Arguments[member.key] = m.file.position(member.start)
+		}
+	}
+	return callSite, true
+}
+
+// IsLoaded checks if the module is currently in a "loaded" (dev) state.
+func (m *JSONModule) IsLoaded() bool {
+	_, _, found := m.stateNode()
+	return found
+}
+
+// Load replaces the module's source with the local path (or git address)
+// from its dev annotation, removes its version and records the original in the "//"
+// property. It returns true if a change was made.
+func (m *JSONModule) Load(opts LoadOptions) (bool, error) {
+	if m.IsLoaded() {
+		return false, nil
+	}
+
+	devAnnotation, devAnnotationFound := m.DevAnnotation()
+	if !devAnnotationFound {
+		return false, nil
+	}
+
+	module := m.node()
+	source := module.member(jsonSourceKey)
+	if source == nil || source.value.kind != jsonString {
+		return false, fmt.Errorf("module has no source attribute")
+	}
+	comment := module.member(jsonCommentKey)
+
+	state := jsonState{
+		Source: m.decodeString(source.value),
+		Raw:    jsonRawState{Source: source.value.raw(m.file.content)},
+	}
+	if comment != nil {
+		state.Raw.Comment = comment.value.raw(m.file.content)
+	}
+
+	devSource := devAnnotation.devSource(state.Source, false, m.file.path, opts)
+	edits := []jsonEdit{{start: source.value.start, end: source.value.end, text: encodeJSONString(devSource)}}
+
+	for i, member := range module.members {
+		if member.key != jsonVersionKey {
+			continue
+		}
+		if member.value.kind == jsonString {
+			state.Version = m.decodeString(member.value)
+		} else {
+			state.Version = member.value.raw(m.file.content)
+		}
+		// Remove the property together with the separator in front of it, or
+		// after it when it is the first property of the object.
+		removal := jsonEdit{start: member.start, end: member.value.end}
+		if i > 0 {
+			removal.start = module.members[i-1].value.end
+			state.Raw.After = module.members[i-1].key
+		} else {
+			removal.end = module.members[i+1].start
+			state.Raw.Before = module.members[i+1].key
+		}
+		state.Raw.Version = string(m.file.content[removal.start:removal.end])
+		edits = append(edits, removal)
+		break
+	}
+
+	if comment == nil {
+		// Linked modules may have no "//" property; one holding just the
+		// state is added after the source.
+		stateJSON, err := encodeJSON(state)
+		if err != nil {
+			return false, err
+		}
+		text := ", " + encodeJSONString(jsonCommentKey) + ": {" + encodeJSONString(jsonStateKey) + ": " + stateJSON + "}"
+		edits = append(edits, jsonEdit{start: source.value.end, end: source.value.end, text: text})
+	} else {
+		commentWithState, err := m.withState(comment.value, state)
+		if err != nil {
+			return false, err
+		}
+		edits = append(edits, jsonEdit{start: comment.value.start, end: comment.value.end, text: commentWithState})
+	}
+
+	m.file.content = applyJSONEdits(m.file.content, edits)
+	logrus.Infof("loading module '%s' with dev source '%s'\n", m.name, devSource)
+	return true, nil
+}
+
+// Unload restores the original source and version from the module's state
+// and removes the state. It returns true if a change was made.
+func (m *JSONModule) Unload() (bool, error) {
+	_, state, found := m.stateNode()
+	if !found {
+		return false, nil
+	}
+
+	module := m.node()
+	source := module.member(jsonSourceKey)
+	if source == nil {
+		return false, fmt.Errorf("module has no source attribute")
+	}
+	comment := module.member(jsonCommentKey)
+
+	edits := []jsonEdit{{start: source.value.start, end: source.value.end, text: state.Raw.Source}}
+	if state.Raw.Comment == "" {
+		// The "//" property was added by the load; remove it together with
+		// the separator in front of it.
+		edits = append(edits, m.memberRemoval(module, jsonCommentKey))
+	} else {
+		edits = append(edits, jsonEdit{start: comment.value.start, end: comment.value.end, text: state.Raw.Comment})
+	}
+
+	// The removed text records that a version property existed, even an
+	// empty one.
+	if state.Raw.Version != "" || state.Version != "" {
+		edits = append(edits, m.versionRestore(module, source, state))
+	}
+
+	m.file.content = applyJSONEdits(m.file.content, edits)
+	logrus.Infof("unloading module '%s' to original source '%s'\n", m.name, state.Source)
+	return true, nil
+}
+
+// memberRemoval returns the edit removing a property of module together with
+// the separator in front of it, or after it when it is the first property.
+func (m *JSONModule) memberRemoval(module *jsonNode, key string) jsonEdit {
+	for i, member := range module.members {
+		if member.key != key {
+			continue
+		}
+		if i > 0 {
+			return jsonEdit{start: module.members[i-1].value.end, end: member.value.end}
+		}
+		if len(module.members) > 1 {
+			return jsonEdit{start: member.start, end: module.members[1].start}
+		}
+		return jsonEdit{start: member.start, end: member.value.end}
+	}
+	return jsonEdit{}
+}
+
+// versionRestore returns the edit re-inserting the version property at the
+// place it was removed from, falling back to right after the source.
+func (m *JSONModule) versionRestore(module *jsonNode, source *jsonMember, state jsonState) jsonEdit {
+	if state.Raw.After != "" {
+		if anchor := module.member(state.Raw.After); anchor != nil {
+			return jsonEdit{start: anchor.value.end, end: anchor.value.end, text: state.Raw.Version}
+		}
+	}
+	if state.Raw.Before != "" {
+		if anchor := module.member(state.Raw.Before); anchor != nil {
+			return jsonEdit{start: anchor.start, end: anchor.start, text: state.Raw.Version}
+		}
+	}
+	text := ", " + encodeJSONString(jsonVersionKey) + ": " + encodeJSONString(state.Version)
+	return jsonEdit{start: source.value.end, end: source.value.end, text: text}
+}
+
+// withState returns the text of the "//" property value extended with the state.
+func (m *JSONModule) withState(comment *jsonNode, state jsonState) (string, error) {
+	stateJSON, err := encodeJSON(state)
+	if err != nil {
+		return "", err
+	}
+	stateMember := encodeJSONString(jsonStateKey) + ": " + stateJSON
+	raw := comment.raw(m.file.content)
+
+	switch comment.kind {
+	case jsonString:
+		return "[" + raw + ", {" + stateMember + "}]", nil
+	case jsonArray:
+		if len(comment.elems) == 0 {
+			return "[{" + stateMember + "}]", nil
+		}
+		last := comment.elems[len(comment.elems)-1].end - comment.start
+		return raw[:last] + ", {" + stateMember + "}" + raw[last:], nil
+	case jsonObject:
+		if len(comment.members) == 0 {
+			return "{" + stateMember + "}", nil
+		}
+		last := comment.members[len(comment.members)-1].value.end - comment.start
+		return raw[:last] + ", " + stateMember + raw[last:], nil
+	}
+	return "", fmt.Errorf("unsupported %q property", jsonCommentKey)
+}
+
+// decodeString decodes a JSON string node.
+func (m *JSONModule) decodeString(node *jsonNode) string {
+	var value string
+	if err := json.Unmarshal([]byte(node.raw(m.file.content)), &value); err != nil {
+		return ""
+	}
+	return value
+}
+
+// encodeJSON encodes a value as compact JSON without HTML escaping.
+func encodeJSON(value any) (string, error) {
+	buf := &bytes.Buffer{}
+	encoder := json.NewEncoder(buf)
+	encoder.SetEscapeHTML(false)
+	if err := encoder.Encode(value); err != nil {
+		return "", err
+	}
+	return strings.TrimSuffix(buf.String(), "\n"), nil
+}
+
+// encodeJSONString encodes a string as a JSON string literal.
+func encodeJSONString(value string) string {
+	encoded, _ := encodeJSON(value)
+	return encoded
+}
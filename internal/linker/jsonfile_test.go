@@ -0,0 +1,149 @@
+package linker
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var jsonTestCases = []struct {
+	name            string
+	initialJSON     string
+	expectedSource  string
+	expectedVersion string
+}{
+	{
+		name: "Comment string with version in the middle",
+		initialJSON: `{
+  "module": {
+    "vpc": {
+      "//": "terralink: path=../local/vpc",
+      "cidr": "10.0.0.0/16",
+      "source": "terraform-aws-modules/vpc/aws",
+      "tags": {"env": "dev"},
+      "version": "3.0.0"
+    }
+  }
+}
+`,
+		expectedSource:  "terraform-aws-modules/vpc/aws",
+		expectedVersion: "3.0.0",
+	},
+	{
+		name:            "Comment array with version first",
+		initialJSON:     `{"module": [{"vpc": {"version": "~> 3.0", "//": ["generated", "terralink: path=../local/vpc"], "source": "terraform-aws-modules/vpc/aws"}}]}`,
+		expectedSource:  "terraform-aws-modules/vpc/aws",
+		expectedVersion: "~> 3.0",
+	},
+	{
+		name: "Comment object without version",
+		initialJSON: `{
+	"module": {
+		"vpc": {
+			"//": {
+				"metadata": {"path": "stack/vpc"},
+				"terralink": "path=../local/vpc"
+			},
+			"source": "git::https://example.com/vpc.git?ref=v1.0.0"
+		}
+	}
+}`,
+		expectedSource: "git::https://example.com/vpc.git?ref=v1.0.0",
+	},
+	{
+		name:           "Empty version",
+		initialJSON:    `{"module": {"vpc": {"//": "terralink: path=../local/vpc", "source": "terraform-aws-modules/vpc/aws", "version": ""}}}`,
+		expectedSource: "terraform-aws-modules/vpc/aws",
+	},
+}
+
+func TestJSONFile_RoundTrip(t *testing.T) {
+	for _, tc := range jsonTestCases {
+		t.Run(tc.name, func(t *testing.T) {
+			filePath := writeTempFile(t, "main.tf.json", tc.initialJSON)
+			file, err := NewJSONFile(filePath)
+			require.NoError(t, err)
+			require.Len(t, file.Modules(), 1)
+			module := file.Modules()[0]
+			assert.Equal(t, "vpc", module.Name())
+
+			devAnnotation, found := module.DevAnnotation()
+			assert.True(t, found)
+			assert.Equal(t, "../local/vpc", devAnnotation.Path)
+
+			changed, err := module.Load(LoadOptions{})
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.True(t, json.Valid(file.Bytes()), "loaded file must stay valid JSON:\n%s", file.Bytes())
+
+			loaded := file.moduleNodes()[0].node
+			assert.Nil(t, loaded.member("version"))
+			assert.Equal(t, `"../local/vpc"`, loaded.member("source").value.raw(file.Bytes()))
+
+			state, loadedState := module.State()
+			require.True(t, loadedState)
+			assert.Equal(t, StateAnnotation{Source: tc.expectedSource, Version: tc.expectedVersion}, state)
+			assert.NotEqual(t, 0, module.StatePos().Line)
+
+			changed, err = module.Load(LoadOptions{})
+			require.NoError(t, err)
+			assert.False(t, changed, "loading twice must be a no-op")
+
+			changed, err = module.Unload()
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.Equal(t, tc.initialJSON, string(file.Bytes()))
+			assert.False(t, module.IsLoaded())
+		})
+	}
+}
+
+func TestJSONFile_NoAnnotation(t *testing.T) {
+	content := `{"module": {"vpc": {"source": "terraform-aws-modules/vpc/aws", "version": "3.0.0"}}}`
+	file, err := NewJSONFile(writeTempFile(t, "main.tf.json", content))
+	require.NoError(t, err)
+	require.Len(t, file.Modules(), 1)
+
+	changed, err := file.Modules()[0].Load(LoadOptions{})
+	require.NoError(t, err)
+	assert.False(t, changed)
+	assert.False(t, file.Changed())
+}
+
+func TestJSONFile_InvalidJSON(t *testing.T) {
+	_, err := NewJSONFile(writeTempFile(t, "main.tf.json", `{"module": `))
+	assert.Error(t, err)
+}
+
+func TestLinker_JSON(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+	linker := NewLinker(matcher)
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "main.tf.json")
+	initial := jsonTestCases[0].initialJSON
+	require.NoError(t, os.WriteFile(filePath, []byte(initial), 0644))
+	createDevSourceDirs(t, filePath)
+
+	changes, err := linker.DevLoad(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changes[filePath].Modules)
+
+	loadedModulesPerFile, err := linker.Check(dir)
+	require.NoError(t, err)
+	require.Len(t, loadedModulesPerFile[filePath], 1)
+	assert.Equal(t, "vpc", loadedModulesPerFile[filePath][0].Name)
+	assert.Equal(t, 4, loadedModulesPerFile[filePath][0].Line)
+
+	_, err = linker.DevUnload(dir)
+	require.NoError(t, err)
+	resultBytes, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, initial, string(resultBytes))
+}
@@ -0,0 +1,163 @@
+package linker
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+)
+
+// jsonKind is the kind of a JSON value.
+type jsonKind int
+
+const (
+	jsonObject jsonKind = iota
+	jsonArray
+	jsonString
+	jsonLiteral
+)
+
+// jsonNode is a JSON value together with its byte span in the source, which
+// allows rewriting parts of a document without re-encoding the rest of it.
+type jsonNode struct {
+	kind    jsonKind
+	start   int // offset of the first byte of the value
+	end     int // offset just past the last byte of the value
+	members []*jsonMember
+	elems   []*jsonNode
+}
+
+// jsonMember is a key/value pair of a JSON object.
+type jsonMember struct {
+	key   string
+	start int // offset of the opening quote of the key
+	value *jsonNode
+}
+
+// member returns the first member of an object with the given key, or nil.
+func (n *jsonNode) member(key string) *jsonMember {
+	for _, member := range n.members {
+		if member.key == key {
+			return member
+		}
+	}
+	return nil
+}
+
+// raw returns the source text of the value.
+func (n *jsonNode) raw(src []byte) string {
+	return string(src[n.start:n.end])
+}
+
+// parseJSONSpans parses a JSON document into a tree of jsonNodes.
+func parseJSONSpans(src []byte) (*jsonNode, error) {
+	if !json.Valid(src) {
+		return nil, fmt.Errorf("invalid JSON")
+	}
+	p := &jsonParser{src: src}
+	return p.value(), nil
+}
+
+// jsonParser is a minimal recursive descent parser over a document that has
+// already been validated by json.Valid.
+type jsonParser struct {
+	src []byte
+	pos int
+}
+
+func (p *jsonParser) value() *jsonNode {
+	p.skipSpace()
+	node := &jsonNode{start: p.pos}
+	switch p.src[p.pos] {
+	case '{':
+		node.kind = jsonObject
+		p.pos++
+		for {
+			p.skipSpace()
+			if p.src[p.pos] == '}' {
+				p.pos++
+				break
+			}
+			if p.src[p.pos] == ',' {
+				p.pos++
+				continue
+			}
+			keyStart := p.pos
+			p.skipString()
+			var key string
+			// The document is valid, so the key always decodes.
+			_ = json.Unmarshal(p.src[keyStart:p.pos], &key)
+			p.skipSpace()
+			p.pos++ // ':'
+			node.members = append(node.members, &jsonMember{key: key, start: keyStart, value: p.value()})
+		}
+	case '[':
+		node.kind = jsonArray
+		p.pos++
+		for {
+			p.skipSpace()
+			if p.src[p.pos] == ']' {
+				p.pos++
+				break
+			}
+			if p.src[p.pos] == ',' {
+				p.pos++
+				continue
+			}
+			node.elems = append(node.elems, p.value())
+		}
+	case '"':
+		node.kind = jsonString
+		p.skipString()
+	default:
+		node.kind = jsonLiteral
+		for p.pos < len(p.src) && !isJSONDelimiter(p.src[p.pos]) {
+			p.pos++
+		}
+	}
+	node.end = p.pos
+	return node
+}
+
+func (p *jsonParser) skipString() {
+	p.pos++ // opening quote
+	for p.src[p.pos] != '"' {
+		if p.src[p.pos] == '\\' {
+			p.pos++
+		}
+		p.pos++
+	}
+	p.pos++ // closing quote
+}
+
+func (p *jsonParser) skipSpace() {
+	for p.pos < len(p.src) && isJSONSpace(p.src[p.pos]) {
+		p.pos++
+	}
+}
+
+func isJSONSpace(b byte) bool {
+	return b == ' ' || b == '\t' || b == '\r' || b == '\n'
+}
+
+func isJSONDelimiter(b byte) bool {
+	return isJSONSpace(b) || b == ',' || b == '}' || b == ']'
+}
+
+// jsonEdit replaces the bytes in [start, end) with text.
+type jsonEdit struct {
+	start int
+	end   int
+	text  string
+}
+
+// applyJSONEdits applies non-overlapping edits to src and returns the result.
+func applyJSONEdits(src []byte, edits []jsonEdit) []byte {
+	sort.SliceStable(edits, func(i, j int) bool {
+		return edits[i].start > edits[j].start
+	})
+	result := append([]byte{}, src...)
+	for _, edit := range edits {
+		result = append(result[:edit.start], append([]byte(edit.text), result[edit.end:]...)...)
+	}
+	return result
+}
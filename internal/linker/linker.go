@@ -5,57 +5,193 @@ import (
 	"io/fs"
 	"path/filepath"
 	"reflect"
+	"strings"
 	"terralink/internal/ignore"
 
 	log "github.com/sirupsen/logrus"
 )
 
-// LoadedModules is a type alias for a slice of strings representing module names.
-type LoadedModules []string
+// LoadedModule describes a module found in a "loaded" (dev) state.
+type LoadedModule struct {
+	// Name is the module name.
+	Name string
+	// File is the path of the file declaring the module.
+	File string
+	// Line and Column locate the terralink-state comment (1-based).
+	Line   int
+	Column int
+	// LocalPath is the path from the dev annotation, if any.
+	LocalPath string
+	// Profiles are the profiles listed in the dev annotation, if any.
+	Profiles []string
+	// Source and Version are the originals recorded in the state annotation.
+	Source  string
+	Version string
+}
+
+// LoadedModules is a slice of the loaded modules found in a single file.
+type LoadedModules []LoadedModule
+
+// FileChange summarises the modifications made to a single file by DevLoad
+// or DevUnload. In dry-run mode it describes the changes that would be made.
+type FileChange struct {
+	// Modules is the number of modules that were loaded or unloaded.
+	Modules int
+	// Diff is a unified diff of the file content before and after the change.
+	Diff string
+}
 
 // Linker is the main struct responsible for orchestrating the linking,
 // unlinking, and checking of Terraform modules. It uses an IgnoreMatcher
 // to determine which files and directories to skip.
 type Linker struct {
-	matcher *ignore.IgnoreMatcher
+	matcher         *ignore.IgnoreMatcher
+	dryRun          bool
+	selector        *Selector
+	loadOptions     LoadOptions
+	skipMissing     bool
+	allowedRoots    []string
+	verifyInterface bool
+	links           *Links
+	revision        string
+	format          bool
+}
+
+// Option configures optional behaviour of a Linker.
+type Option func(*Linker)
+
+// WithDryRun makes DevLoad and DevUnload compute their changes in memory
+// without writing any file to disk.
+func WithDryRun(dryRun bool) Option {
+	return func(l *Linker) {
+		l.dryRun = dryRun
+	}
+}
+
+// WithSelector restricts every operation to the modules matched by selector.
+func WithSelector(selector *Selector) Option {
+	return func(l *Linker) {
+		l.selector = selector
+	}
+}
+
+// WithGitRef overrides the ref of git dev annotations when loading.
+func WithGitRef(ref string) Option {
+	return func(l *Linker) {
+		l.loadOptions.Ref = ref
+	}
+}
+
+// WithSkipMissing makes DevLoad skip modules whose local path is invalid
+// with a warning, instead of failing.
+func WithSkipMissing(skipMissing bool) Option {
+	return func(l *Linker) {
+		l.skipMissing = skipMissing
+	}
+}
+
+// WithAllowedRoot makes DevLoad refuse local paths outside of root. When
+// given several times, local paths must be inside one of the roots.
+func WithAllowedRoot(root string) Option {
+	return func(l *Linker) {
+		if root != "" {
+			l.allowedRoots = append(l.allowedRoots, root)
+		}
+	}
+}
+
+// WithModuleRoots sets the named directories that dev annotations can refer
+// to as "path=@name/sub/dir".
+func WithModuleRoots(roots map[string]string) Option {
+	return func(l *Linker) {
+		l.loadOptions.ModuleRoots = roots
+	}
+}
+
+// WithLinks makes modules without a dev annotation use the one linked to
+// their source or address in links, as if they were annotated.
+func WithLinks(links *Links) Option {
+	return func(l *Linker) {
+		l.links = links
+	}
+}
+
+// WithVerifyInterface makes DevLoad compare every module it loads from a local
+// path with the variables and outputs of the local module, and fail on any
+// incompatibility.
+func WithVerifyInterface(verify bool) Option {
+	return func(l *Linker) {
+		l.verifyInterface = verify
+	}
+}
+
+// WithFormat makes every rewritten .tf and .hcl file formatted as a whole
+// like 'terraform fmt', instead of only the rewritten blocks that were
+// already formatted.
+func WithFormat(format bool) Option {
+	return func(l *Linker) {
+		l.format = format
+	}
 }
 
 // NewLinker creates and returns a new Linker instance.
-func NewLinker(matcher *ignore.IgnoreMatcher) *Linker {
-	return &Linker{
+func NewLinker(matcher *ignore.IgnoreMatcher, opts ...Option) *Linker {
+	l := &Linker{
 		matcher: matcher,
 	}
+	for _, opt := range opts {
+		opt(l)
+	}
+	if l.selector != nil {
+		l.selector.loadOptions = l.loadOptions
+	}
+	return l
 }
 
-// fileProcessor defines the function signature for processing a single HCL file.
+// fileProcessor defines the function signature for processing a single configuration file.
 // This uses generics to allow different return types from the processor.
-type fileProcessor[T any] func(file *HCLFile) (T, error)
+type fileProcessor[T any] func(file ConfigFile) (T, error)
 
-// processFiles is a generic function that walks the directory starting from scanPath.
+// processFiles is a generic function that walks the directories starting from scanPaths.
 // It applies the given processor function to each non-ignored Terraform file it finds
 // and aggregates the results into a map where the key is the file path.
-func processFiles[T any](scanPath string, matcher *ignore.IgnoreMatcher, processor fileProcessor[T]) (map[string]T, error) {
+// Ignored directories are not descended into, and files reachable from
+// several scan paths are processed once. Modules are looked up in links, if
+// any, before the file is processed.
+func processFiles[T any](scanPaths []string, matcher *ignore.IgnoreMatcher, links *Links, processor fileProcessor[T]) (map[string]T, error) {
 	results := make(map[string]T)
+	seen := make(map[string]bool)
 
-	walkErr := filepath.WalkDir(scanPath, func(path string, d fs.DirEntry, err error) error {
+	walkFn := func(path string, d fs.DirEntry, err error) error {
 		if err != nil {
 			return err // Propagate errors from walking, e.g., permission denied
 		}
 
-		// Check if the individual file should be ignored.
-		if matcher.ShouldIgnore(path) {
+		// Only Terraform and Terragrunt files are processed.
+		if d.IsDir() || !isConfigFileName(path) {
 			return nil
 		}
+		if absPath, err := filepath.Abs(path); err == nil {
+			if seen[absPath] {
+				return nil
+			}
+			seen[absPath] = true
+		}
 
-		// Read and parse the HCL file.
-		hclFile, err := NewHCLFile(path)
+		// Read and parse the configuration file.
+		configFile, err := NewConfigFile(path)
 		if err != nil {
 			log.Errorf("Warning: skipping file due to parsing error: %v\n", err)
 			return nil
 		}
+		if links != nil {
+			for _, module := range configFile.Modules() {
+				module.link(links)
+			}
+		}
 
 		// Apply the specific processing logic to the file.
-		result, err := processor(hclFile)
+		result, err := processor(configFile)
 		if err != nil {
 			return fmt.Errorf("error processing file %s: %w", path, err)
 		}
@@ -70,24 +206,48 @@ func processFiles[T any](scanPath string, matcher *ignore.IgnoreMatcher, process
 		}
 
 		return nil
-	})
+	}
 
-	if walkErr != nil {
-		return nil, fmt.Errorf("error walking directories: %w", walkErr)
+	for _, scanPath := range scanPaths {
+		if err := matcher.Walk(scanPath, walkFn); err != nil {
+			return nil, fmt.Errorf("error walking directories: %w", err)
+		}
 	}
 
 	return results, nil
 }
 
+// isConfigFileName reports whether path names a file terralink can process.
+func isConfigFileName(path string) bool {
+	return strings.HasSuffix(path, ".tf") || strings.HasSuffix(path, jsonFileSuffix) || strings.HasSuffix(path, ".hcl")
+}
+
 // Check scans the given path for Terraform files and reports which modules
-// in each file are currently in a "loaded" (dev) state.
-func (l *Linker) Check(scanPath string) (map[string]LoadedModules, error) {
-	return processFiles(scanPath, l.matcher, func(hclFile *HCLFile) (LoadedModules, error) {
+// in each file are currently in a "loaded" (dev) state. With WithRevision it
+// reads the files from git instead.
+func (l *Linker) Check(scanPaths ...string) (map[string]LoadedModules, error) {
+	return readFiles(l, scanPaths, func(configFile ConfigFile) (LoadedModules, error) {
 		var loadedModules LoadedModules
-		for _, module := range hclFile.Modules() {
-			if module.IsLoaded() {
-				loadedModules = append(loadedModules, module.Name())
+		for _, module := range configFile.Modules() {
+			if !l.selector.Matches(configFile, module) {
+				continue
+			}
+			state, loaded := module.State()
+			if !loaded {
+				continue
 			}
+			devAnnotation, _ := module.DevAnnotation()
+			pos := module.StatePos()
+			loadedModules = append(loadedModules, LoadedModule{
+				Name:      module.Name(),
+				File:      configFile.Path(),
+				Line:      pos.Line,
+				Column:    pos.Column,
+				LocalPath: devAnnotation.Path,
+				Profiles:  devAnnotation.Profiles,
+				Source:    state.Source,
+				Version:   state.Version,
+			})
 		}
 		if len(loadedModules) == 0 {
 			return loadedModules, nil // Return nil so it's skipped in results map
@@ -98,48 +258,158 @@ func (l *Linker) Check(scanPath string) (map[string]LoadedModules, error) {
 
 // DevLoad scans for Terraform files and modifies module blocks that have a
 // terralink dev annotation, switching them to use a local path.
-func (l *Linker) DevLoad(scanPath string) (map[string]int, error) {
-	return processFiles(scanPath, l.matcher, func(hclFile *HCLFile) (int, error) {
-		changes := 0
-		for _, module := range hclFile.Modules() {
-			loaded, err := module.Load()
-			if err != nil {
-				return 0, fmt.Errorf("in module '%s': %w", module.Name(), err)
-			}
-			if loaded {
-				changes++
-			}
-		}
+// Annotated local paths are validated first: if any of them is invalid, no
+// file is written and a PathValidationError listing every problem is returned,
+// unless WithSkipMissing is set, in which case those modules are skipped.
+// With WithVerifyInterface, modules are then compared with their local module
+// and an InterfaceError is returned, without writing any file, on mismatch.
+func (l *Linker) DevLoad(scanPaths ...string) (map[string]FileChange, error) {
+	unlock, err := l.lock(scanPaths)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
 
-		if changes > 0 {
-			if err := hclFile.Write(); err != nil {
-				return 0, err
+	var pending []ConfigFile
+	var problems []PathProblem
+	var diagnostics []InterfaceDiagnostic
+	changes, err := processFiles(scanPaths, l.matcher, l.links, func(configFile ConfigFile) (FileChange, error) {
+		return l.rewrite(configFile, &pending, func(module LinkableModule) (bool, error) {
+			if problem := l.validateModule(configFile, module); problem != nil {
+				if l.skipMissing {
+					log.Warnf("skipping module '%s' in %s: path '%s' %s\n", problem.Module, problem.File, problem.Path, problem.Reason)
+					return false, nil
+				}
+				problems = append(problems, *problem)
+				return false, nil
 			}
-		}
-		return changes, nil
+			if l.verifyInterface && !module.IsLoaded() {
+				moduleDiagnostics, err := l.verifyModule(configFile, module)
+				if err != nil {
+					return false, err
+				}
+				diagnostics = append(diagnostics, moduleDiagnostics...)
+			}
+			return module.Load(l.loadOptions)
+		})
 	})
+	if err != nil {
+		return nil, err
+	}
+	if len(problems) > 0 {
+		return nil, &PathValidationError{Problems: problems}
+	}
+	if len(diagnostics) > 0 {
+		return nil, &InterfaceError{Diagnostics: diagnostics}
+	}
+	if err := l.write(pending); err != nil {
+		return nil, err
+	}
+	return changes, nil
 }
 
 // DevUnload scans for Terraform files and reverts module blocks from a
 // local dev state back to their original source and version.
-func (l *Linker) DevUnload(scanPath string) (map[string]int, error) {
-	return processFiles(scanPath, l.matcher, func(hclFile *HCLFile) (int, error) {
-		changes := 0
-		for _, module := range hclFile.Modules() {
-			unloaded, err := module.Unload()
-			if err != nil {
-				return 0, fmt.Errorf("in module '%s': %w", module.Name(), err)
-			}
-			if unloaded {
-				changes++
+func (l *Linker) DevUnload(scanPaths ...string) (map[string]FileChange, error) {
+	unlock, err := l.lock(scanPaths)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var pending []ConfigFile
+	changes, err := processFiles(scanPaths, l.matcher, l.links, func(configFile ConfigFile) (FileChange, error) {
+		return l.rewrite(configFile, &pending, LinkableModule.Unload)
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := l.write(pending); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// validateModule checks the local path a module would be loaded from. It
+// returns nil if the module is valid, already loaded, or not linked to a
+// local path.
+func (l *Linker) validateModule(configFile ConfigFile, module LinkableModule) *PathProblem {
+	if module.IsLoaded() {
+		return nil
+	}
+	devAnnotation, found := module.DevAnnotation()
+	if !found || devAnnotation.Git != "" {
+		return nil
+	}
+	if reason := devAnnotation.pathProblem(configFile.Path(), l.loadOptions); reason != "" {
+		return &PathProblem{File: configFile.Path(), Module: module.Name(), Path: devAnnotation.Path, Reason: reason}
+	}
+	devSource, _ := module.DevSource(l.loadOptions)
+	if reason := validateDevSource(configFile.Path(), devSource, l.allowedRoots); reason != "" {
+		return &PathProblem{File: configFile.Path(), Module: module.Name(), Path: devAnnotation.Path, Reason: reason}
+	}
+	return nil
+}
+
+// lock takes the advisory lock covering the scan paths, unless running in
+// dry-run mode. The returned function releases it.
+func (l *Linker) lock(scanPaths []string) (func(), error) {
+	if l.dryRun {
+		return func() {}, nil
+	}
+	return lockScanPaths(scanPaths)
+}
+
+// write saves every pending file, unless running in dry-run mode. Writing is
+// all-or-nothing: if a file cannot be written, every file already written is
+// restored to its original content.
+func (l *Linker) write(pending []ConfigFile) error {
+	if l.dryRun {
+		return nil
+	}
+	for i, configFile := range pending {
+		if err := configFile.Write(); err != nil {
+			for _, written := range pending[:i] {
+				if restoreErr := written.Restore(); restoreErr != nil {
+					log.Errorf("%v\n", restoreErr)
+				}
 			}
+			return fmt.Errorf("%w (%d file(s) already written were restored)", err, i)
 		}
+	}
+	return nil
+}
 
-		if changes > 0 {
-			if err := hclFile.Write(); err != nil {
-				return 0, err
-			}
+// rewrite applies the given module operation to every module in the file in
+// memory, and adds the file to pending when anything changed.
+func (l *Linker) rewrite(configFile ConfigFile, pending *[]ConfigFile, apply func(LinkableModule) (bool, error)) (FileChange, error) {
+	change := FileChange{}
+	for _, module := range configFile.Modules() {
+		if !l.selector.Matches(configFile, module) {
+			continue
 		}
-		return changes, nil
-	})
+		changed, err := apply(module)
+		if err != nil {
+			return FileChange{}, fmt.Errorf("in module '%s': %w", module.Name(), err)
+		}
+		if changed {
+			change.Modules++
+		}
+	}
+
+	if change.Modules == 0 {
+		return change, nil
+	}
+	if hclFile, isHCL := configFile.(*HCLFile); isHCL && l.format {
+		hclFile.format = true
+	}
+
+	diff, err := configFile.Diff()
+	if err != nil {
+		return FileChange{}, err
+	}
+	change.Diff = diff
+
+	*pending = append(*pending, configFile)
+	return change, nil
 }
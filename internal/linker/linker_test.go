@@ -1,8 +1,10 @@
 package linker
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
+	"strings"
 	"terralink/internal/ignore"
 	"testing"
 
@@ -34,7 +36,7 @@ module "my_module" {
 		expectedDevLoad: `
 module "my_module" {
   # terralink: path=../modules/my-module
-  # terralink-state: source="app.terraform.io/my-org/my-module/aws" version="1.0.0"
+  # terralink-state: v2 source="app.terraform.io/my-org/my-module/aws" version="1.0.0"
   source = "../modules/my-module"
 
 
@@ -64,7 +66,7 @@ module "no_version" {
 		expectedDevLoad: `
 module "no_version" {
   # terralink: path=./local_vpc
-  # terralink-state: source="git::https://example.com/vpc.git"
+  # terralink-state: v2 source="git::https://example.com/vpc.git"
   source = "./local_vpc"
 
 }
@@ -101,7 +103,7 @@ module "unmanaged_module" {
 module "managed_module" {
   # comment random
   # terralink: path=../local/managed
-  # terralink-state: source="my-registry/managed/aws" version="1.2.3"
+  # terralink-state: v2 source="my-registry/managed/aws" version="1.2.3"
   source = "../local/managed"
 }
 `,
@@ -165,7 +167,7 @@ module "module_without_annotation" {
 		expectedDevLoad: `
 module "module_without_annotation" {
   # terralink: path=../dev/module  
-  # terralink-state: source="remote/source" version="1.0.0"
+  # terralink-state: v2 source="remote/source" version="1.0.0"
   source = "../dev/module"
   block1 = {
     attr= try(coalesce(var.config.version, ""), "3.2.0")
@@ -216,6 +218,56 @@ module "module_without_annotation" {
 	},
 }
 
+var terragruntTestCase = struct {
+	initialHCL        string
+	expectedDevLoad   string
+	expectedDevUnload string
+}{
+	initialHCL: `
+include "root" {
+  path = find_in_parent_folders()
+}
+
+terraform {
+  # terralink: path=../../local/infra-modules
+  source = "git::https://example.com/infra-modules.git//modules/vpc?ref=v1.2.3"
+}
+
+inputs = {
+  cidr = "10.0.0.0/16"
+}
+`,
+	expectedDevLoad: `
+include "root" {
+  path = find_in_parent_folders()
+}
+
+terraform {
+  # terralink: path=../../local/infra-modules
+  # terralink-state: v2 source="git::https://example.com/infra-modules.git//modules/vpc?ref=v1.2.3"
+  source = "../../local/infra-modules//modules/vpc"
+}
+
+inputs = {
+  cidr = "10.0.0.0/16"
+}
+`,
+	expectedDevUnload: `
+include "root" {
+  path = find_in_parent_folders()
+}
+
+terraform {
+  # terralink: path=../../local/infra-modules
+  source = "git::https://example.com/infra-modules.git//modules/vpc?ref=v1.2.3"
+}
+
+inputs = {
+  cidr = "10.0.0.0/16"
+}
+`,
+}
+
 // --- Test Functions ---
 
 func TestLinker_DevLoad(t *testing.T) {
@@ -228,6 +280,7 @@ func TestLinker_DevLoad(t *testing.T) {
 			dir := t.TempDir()
 			filePath := filepath.Join(dir, "test.tf")
 			require.NoError(t, os.WriteFile(filePath, []byte(tc.initialHCL), 0644))
+			createDevSourceDirs(t, filePath)
 
 			// Execute
 			_, err := linker.DevLoad(filePath)
@@ -297,7 +350,15 @@ func TestLinker_CheckCommand(t *testing.T) {
 		loadedModules, exists := loadedModulesPerFile[filePath]
 		assert.Equal(t, true, exists)
 		assert.Equal(t, len(loadedModules), 1)
-		assert.Contains(t, loadedModules, "my_module")
+		assert.Equal(t, LoadedModule{
+			Name:      "my_module",
+			File:      filePath,
+			Line:      4,
+			Column:    3,
+			LocalPath: "../modules/my-module",
+			Source:    "app.terraform.io/my-org/my-module/aws",
+			Version:   "1.0.0",
+		}, loadedModules[0])
 	})
 
 	t.Run("Check finds no loaded modules", func(t *testing.T) {
@@ -316,3 +377,179 @@ func TestLinker_CheckCommand(t *testing.T) {
 		assert.Equal(t, len(loadedModules), 0)
 	})
 }
+
+func TestLinker_DryRun(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+	linker := NewLinker(matcher, WithDryRun(true))
+
+	t.Run("DevLoad reports a diff without writing", func(t *testing.T) {
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "test.tf")
+		require.NoError(t, os.WriteFile(filePath, []byte(testCases[0].initialHCL), 0644))
+		createDevSourceDirs(t, filePath)
+
+		changes, err := linker.DevLoad(filePath)
+		require.NoError(t, err)
+
+		change, exists := changes[filePath]
+		require.True(t, exists)
+		assert.Equal(t, 1, change.Modules)
+		assert.Contains(t, change.Diff, "--- a/"+diffPath(filePath))
+		assert.Contains(t, change.Diff, `-  source  = "app.terraform.io/my-org/my-module/aws"`)
+		assert.Contains(t, change.Diff, `-  version = "1.0.0"`)
+		assert.Contains(t, change.Diff, `+  # terralink-state: v2 source="app.terraform.io/my-org/my-module/aws" version="1.0.0"`)
+
+		resultBytes, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, testCases[0].initialHCL, string(resultBytes))
+	})
+
+	t.Run("DevUnload reports a diff without writing", func(t *testing.T) {
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "test.tf")
+		require.NoError(t, os.WriteFile(filePath, []byte(testCases[0].expectedDevLoad), 0644))
+
+		changes, err := linker.DevUnload(filePath)
+		require.NoError(t, err)
+
+		change, exists := changes[filePath]
+		require.True(t, exists)
+		assert.Equal(t, 1, change.Modules)
+		assert.Contains(t, change.Diff, `-  # terralink-state:`)
+
+		resultBytes, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, testCases[0].expectedDevLoad, string(resultBytes))
+	})
+
+	t.Run("Diff marks a missing newline at end of file", func(t *testing.T) {
+		diff, err := unifiedDiff("test.tf", []byte("a\n"), []byte("a"))
+		require.NoError(t, err)
+		assert.Contains(t, diff, "-a\n+a\n\\ No newline at end of file\n")
+
+		diff, err = unifiedDiff("test.tf", []byte("a\nb"), []byte("c\nb"))
+		require.NoError(t, err)
+		assert.Contains(t, diff, "-a\n+c\n b\n\\ No newline at end of file\n")
+	})
+
+	t.Run("No changes produce no entry", func(t *testing.T) {
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "test.tf")
+		require.NoError(t, os.WriteFile(filePath, []byte(testCases[5].initialHCL), 0644))
+
+		changes, err := linker.DevLoad(filePath)
+		require.NoError(t, err)
+		assert.Empty(t, changes)
+	})
+}
+
+func TestLinker_Format(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	const initialHCL = `module "vpc" {
+  # terralink: path=../modules/vpc
+  source = "my-registry/vpc/aws"
+  version="1.0.0"
+}
+
+locals {
+  name="main"
+}
+`
+	for _, format := range []bool{false, true} {
+		t.Run(fmt.Sprintf("format=%v", format), func(t *testing.T) {
+			filePath := filepath.Join(t.TempDir(), "main.tf")
+			require.NoError(t, os.WriteFile(filePath, []byte(initialHCL), 0644))
+			createDevSourceDirs(t, filePath)
+			linker := NewLinker(matcher, WithFormat(format))
+
+			_, err := linker.DevLoad(filePath)
+			require.NoError(t, err)
+			loaded, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			// Without formatting, only the rewritten lines change.
+			assert.Equal(t, format, formatHcl(loaded) == string(loaded))
+			assert.Equal(t, !format, strings.Contains(string(loaded), `name="main"`))
+
+			_, err = linker.DevUnload(filePath)
+			require.NoError(t, err)
+			unloaded, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			if format {
+				assert.Equal(t, formatHcl([]byte(initialHCL)), string(unloaded))
+			} else {
+				assert.Equal(t, initialHCL, string(unloaded))
+			}
+		})
+	}
+}
+
+func TestLinker_Terragrunt(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+	linker := NewLinker(matcher)
+
+	dir := filepath.Join(t.TempDir(), "live", "dev")
+	require.NoError(t, os.MkdirAll(dir, 0755))
+	filePath := filepath.Join(dir, "terragrunt.hcl")
+	require.NoError(t, os.WriteFile(filePath, []byte(terragruntTestCase.initialHCL), 0644))
+	createDevSourceDirs(t, filePath)
+
+	_, err = linker.DevLoad(dir)
+	require.NoError(t, err)
+	resultBytes, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	compareHcl(t, []byte(terragruntTestCase.expectedDevLoad), resultBytes)
+
+	loadedModulesPerFile, err := linker.Check(dir)
+	require.NoError(t, err)
+	require.Len(t, loadedModulesPerFile[filePath], 1)
+	assert.Equal(t, "terraform", loadedModulesPerFile[filePath][0].Name)
+	assert.Equal(t, "../../local/infra-modules", loadedModulesPerFile[filePath][0].LocalPath)
+
+	_, err = linker.DevUnload(dir)
+	require.NoError(t, err)
+	resultBytes, err = os.ReadFile(filePath)
+	require.NoError(t, err)
+	compareHcl(t, []byte(terragruntTestCase.expectedDevUnload), resultBytes)
+}
+
+func TestLinker_TerraformSettingsBlockIgnored(t *testing.T) {
+	hclFile, err := NewHCLFile(writeTempFile(t, "versions.tf", `
+terraform {
+  # terralink: path=../local
+  required_version = ">= 1.5"
+}
+`))
+	require.NoError(t, err)
+	assert.Empty(t, hclFile.Modules())
+}
+
+// createDevSourceDirs creates the local module directory, with an empty
+// main.tf, of every module of the file linked to a local path, so that the
+// path validation of DevLoad passes.
+func createDevSourceDirs(t *testing.T, filePath string) {
+	t.Helper()
+	configFile, err := NewConfigFile(filePath)
+	require.NoError(t, err)
+	for _, module := range configFile.Modules() {
+		devAnnotation, found := module.DevAnnotation()
+		if !found || devAnnotation.Git != "" {
+			continue
+		}
+		devSource, _ := module.DevSource(LoadOptions{})
+		base, subdir := splitSourceSubdir(devSource)
+		dir := filepath.Join(resolveDevPath(filePath, base), subdir)
+		require.NoError(t, os.MkdirAll(dir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(dir, "main.tf"), nil, 0644))
+	}
+}
+
+func writeTempFile(t *testing.T, name, content string) string {
+	t.Helper()
+	filePath := filepath.Join(t.TempDir(), name)
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+	return filePath
+}
@@ -0,0 +1,247 @@
+package linker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/zclconf/go-cty/cty"
+	"github.com/zclconf/go-cty/cty/convert"
+)
+
+// moduleAddressRegex matches a module address used as a link key, e.g.
+// "live/prod/module.vpc" or "module.vpc".
+var moduleAddressRegex = regexp.MustCompile(`^(?:(.*)/)?module\.([^/.]+)$`)
+
+// Links maps module source addresses and module addresses to dev
+// annotations, so that modules can be linked without a "# terralink:" comment
+// committed next to them. They are read from personal links files:
+//
+//	link "my-registry/managed/aws" {
+//	  path = "~/src/terraform-aws-managed"
+//	}
+//
+//	link "live/prod/module.vpc" {
+//	  path     = "../vpc"
+//	  profiles = ["networking"]
+//	}
+//
+// A source address matches every module using it whatever its "//subdir" and
+// "?ref=": the subdirectory is mapped onto the linked path. A module address
+// is a directory, relative to the links file, followed by "module.<name>".
+type Links struct {
+	sources   map[string]DevAnnotation
+	addresses map[moduleAddress]DevAnnotation
+}
+
+// moduleAddress identifies a module by its absolute directory and name.
+type moduleAddress struct {
+	dir  string
+	name string
+}
+
+// LoadLinks reads the given links files. Links of later files override the
+// ones of earlier files with the same key.
+func LoadLinks(paths ...string) (*Links, error) {
+	links := &Links{sources: map[string]DevAnnotation{}, addresses: map[moduleAddress]DevAnnotation{}}
+	for _, path := range paths {
+		if err := links.loadFile(path); err != nil {
+			return nil, err
+		}
+	}
+	return links, nil
+}
+
+// loadFile reads the "link" blocks of a single links file.
+func (l *Links) loadFile(path string) error {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read file %s: %w", path, err)
+	}
+	file, diags := hclsyntax.ParseConfig(content, path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to parse HCL in %s: %w", path, diags)
+	}
+
+	base, err := filepath.Abs(filepath.Dir(path))
+	if err != nil {
+		return err
+	}
+	body := file.Body.(*hclsyntax.Body)
+	for name, attr := range body.Attributes {
+		return fmt.Errorf("%s: unsupported setting %q", attr.NameRange, name)
+	}
+	for _, block := range body.Blocks {
+		if block.Type != "link" || len(block.Labels) != 1 {
+			return fmt.Errorf("%s: expected a block like 'link \"<source or module address>\" {}'", block.TypeRange)
+		}
+		annotation, err := parseLinkBlock(block, base)
+		if err != nil {
+			return err
+		}
+
+		key := strings.TrimSpace(block.Labels[0])
+		if match := moduleAddressRegex.FindStringSubmatch(key); match != nil {
+			dir, err := expandHome(match[1])
+			if err != nil {
+				return fmt.Errorf("%s: %w", block.LabelRanges[0], err)
+			}
+			if !filepath.IsAbs(dir) {
+				dir = filepath.Join(base, dir)
+			}
+			l.addresses[moduleAddress{dir: filepath.Clean(dir), name: match[2]}] = annotation
+			continue
+		}
+		l.sources[linkSourceKey(key)] = annotation
+	}
+	return nil
+}
+
+// parseLinkBlock decodes the attributes of a "link" block, which are the ones
+// of a dev annotation. Relative local paths are resolved against base, the
+// directory of the links file; "~", "$VAR" and "@root" paths are expanded
+// when loading, like annotated paths.
+func parseLinkBlock(block *hclsyntax.Block, base string) (DevAnnotation, error) {
+	var annotation DevAnnotation
+	for _, attr := range sortedAttributes(block.Body.Attributes) {
+		value, diags := attr.Expr.Value(nil)
+		if diags.HasErrors() {
+			return DevAnnotation{}, fmt.Errorf("%s: %w", attr.NameRange, diags)
+		}
+		if attr.Name == "profiles" {
+			converted, err := convert.Convert(value, cty.List(cty.String))
+			if err != nil || converted.IsNull() {
+				return DevAnnotation{}, fmt.Errorf("%s: profiles must be a list of strings", attr.NameRange)
+			}
+			for _, profile := range converted.AsValueSlice() {
+				annotation.Profiles = append(annotation.Profiles, profile.AsString())
+			}
+			continue
+		}
+
+		converted, err := convert.Convert(value, cty.String)
+		if err != nil || converted.IsNull() {
+			return DevAnnotation{}, fmt.Errorf("%s: %s must be a string", attr.NameRange, attr.Name)
+		}
+		switch attr.Name {
+		case "path":
+			annotation.Path = resolveLinkPath(converted.AsString(), base)
+		case "git":
+			annotation.Git = converted.AsString()
+		case "ref":
+			annotation.Ref = converted.AsString()
+		default:
+			return DevAnnotation{}, fmt.Errorf("%s: unsupported setting %q", attr.NameRange, attr.Name)
+		}
+	}
+	if len(block.Body.Blocks) > 0 {
+		return DevAnnotation{}, fmt.Errorf("%s: unsupported block %q", block.Body.Blocks[0].TypeRange, block.Body.Blocks[0].Type)
+	}
+	if annotation.Path == "" && annotation.Git == "" {
+		return DevAnnotation{}, fmt.Errorf("%s: link needs a path or a git address", block.TypeRange)
+	}
+	return annotation, nil
+}
+
+// sortedAttributes returns the attributes of a body in source order.
+func sortedAttributes(attributes hclsyntax.Attributes) []*hclsyntax.Attribute {
+	sorted := make([]*hclsyntax.Attribute, 0, len(attributes))
+	for _, attr := range attributes {
+		sorted = append(sorted, attr)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		return sorted[i].SrcRange.Start.Byte < sorted[j].SrcRange.Start.Byte
+	})
+	return sorted
+}
+
+// resolveLinkPath resolves the relative alternatives of a linked path
+// against base. Alternatives starting with "~", "$" or a module root are kept
+// as written.
+func resolveLinkPath(path, base string) string {
+	alternatives := strings.Split(path, pathAlternativeSeparator)
+	for i, alternative := range alternatives {
+		if alternative == "" || filepath.IsAbs(alternative) || strings.HasPrefix(alternative, "~") ||
+			strings.HasPrefix(alternative, "$") || strings.HasPrefix(alternative, moduleRootPrefix) {
+			continue
+		}
+		alternatives[i] = filepath.ToSlash(filepath.Join(base, alternative))
+	}
+	return strings.Join(alternatives, pathAlternativeSeparator)
+}
+
+// expandHome expands a leading "~" in path to the user's home directory.
+func expandHome(path string) (string, error) {
+	if path != "~" && !strings.HasPrefix(path, "~/") {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("cannot resolve the home directory: %w", err)
+	}
+	return filepath.Join(home, strings.TrimPrefix(path, "~")), nil
+}
+
+// linkSourceKey returns a source address without its "?" query string, the
+// form source addresses are looked up by.
+func linkSourceKey(source string) string {
+	key, _, _ := strings.Cut(source, "?")
+	return strings.TrimSuffix(key, "/")
+}
+
+// annotation returns the dev annotation linked to a module, looked up by
+// module address, then by exact source address including the "//subdir",
+// then by source address without it. A subdirectory that is not part of the
+// key is appended to the linked path.
+func (l *Links) annotation(filePath, name, source string, terragrunt bool) (DevAnnotation, bool) {
+	if l == nil {
+		return DevAnnotation{}, false
+	}
+	if filePath != "" {
+		if dir, err := filepath.Abs(filepath.Dir(filePath)); err == nil {
+			if annotation, found := l.addresses[moduleAddress{dir: dir, name: name}]; found {
+				return annotation, true
+			}
+		}
+	}
+	if source == "" {
+		return DevAnnotation{}, false
+	}
+
+	key := linkSourceKey(source)
+	if annotation, found := l.sources[key]; found {
+		if terragrunt && annotation.Path != "" && sourceSubdir(source) != "" {
+			// The linked path is the subdirectory itself; "//." keeps
+			// devSource from appending the subdirectory once more.
+			annotation.Path = withSourceSubdir(annotation.Path, ".")
+		}
+		return annotation, true
+	}
+	base, subdir := splitSourceSubdir(key)
+	annotation, found := l.sources[base]
+	if !found {
+		return DevAnnotation{}, false
+	}
+	if subdir != "" && !terragrunt && annotation.Path != "" {
+		alternatives := strings.Split(annotation.Path, pathAlternativeSeparator)
+		for i, alternative := range alternatives {
+			alternatives[i] = strings.TrimSuffix(alternative, "/") + "/" + subdir
+		}
+		annotation.Path = strings.Join(alternatives, pathAlternativeSeparator)
+	}
+	return annotation, true
+}
+
+// linkSource returns the source a module is linked by: the original source
+// recorded in its state while loaded, or else its current source.
+func linkSource(module LinkableModule) string {
+	if state, found := module.State(); found {
+		return state.Source
+	}
+	return module.Source()
+}
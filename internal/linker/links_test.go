@@ -0,0 +1,186 @@
+package linker
+
+import (
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const linksHCL = `
+link "my-registry/managed/aws" {
+  path = "../managed-aws"
+}
+
+link "git::https://example.com/infra.git" {
+  path     = "~/src/infra"
+  profiles = ["networking"]
+}
+
+link "git::https://example.com/infra.git//modules/dns" {
+  path = "/src/dns"
+}
+
+link "git::https://example.com/fork.git" {
+  git = "git::ssh://git@example.com/me/fork.git"
+  ref = "main"
+}
+
+link "live/module.app" {
+  path = "../app"
+}
+`
+
+// writeLinks writes a links file into a new project directory and returns
+// the loaded links and the project directory.
+func writeLinks(t *testing.T, content string) (*Links, string) {
+	t.Helper()
+	root := t.TempDir()
+	projectDir := filepath.Join(root, "project")
+	require.NoError(t, os.MkdirAll(filepath.Join(projectDir, "live"), 0755))
+	path := filepath.Join(projectDir, ".terralink.local.hcl")
+	require.NoError(t, os.WriteFile(path, []byte(content), 0644))
+
+	links, err := LoadLinks(path)
+	require.NoError(t, err)
+	return links, projectDir
+}
+
+func TestLinks_Annotation(t *testing.T) {
+	links, projectDir := writeLinks(t, linksHCL)
+	filePath := filepath.Join(projectDir, "live", "main.tf")
+	managedPath := filepath.ToSlash(filepath.Join(filepath.Dir(projectDir), "managed-aws"))
+
+	testCases := []struct {
+		name       string
+		moduleName string
+		source     string
+		terragrunt bool
+		expected   DevAnnotation
+		found      bool
+	}{
+		{"Registry source", "vpc", "my-registry/managed/aws", false, DevAnnotation{Path: managedPath}, true},
+		{"Git source with subdir and ref", "vpc", "git::https://example.com/infra.git//modules/vpc?ref=v1.2.3", false,
+			DevAnnotation{Path: "~/src/infra/modules/vpc", Profiles: []string{"networking"}}, true},
+		{"Terragrunt keeps the subdir for the source", "terraform", "git::https://example.com/infra.git//modules/vpc?ref=v1", true,
+			DevAnnotation{Path: "~/src/infra", Profiles: []string{"networking"}}, true},
+		{"Exact subdir wins", "dns", "git::https://example.com/infra.git//modules/dns", false, DevAnnotation{Path: "/src/dns"}, true},
+		{"Exact subdir in Terragrunt", "terraform", "git::https://example.com/infra.git//modules/dns", true, DevAnnotation{Path: "/src/dns//."}, true},
+		{"Git link", "fork", "git::https://example.com/fork.git//sub", false,
+			DevAnnotation{Git: "git::ssh://git@example.com/me/fork.git", Ref: "main"}, true},
+		{"Module address wins over source", "app", "my-registry/managed/aws", false,
+			DevAnnotation{Path: filepath.ToSlash(filepath.Join(filepath.Dir(projectDir), "app"))}, true},
+		{"Unknown source", "other", "my-registry/other/aws", false, DevAnnotation{}, false},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			annotation, found := links.annotation(filePath, tc.moduleName, tc.source, tc.terragrunt)
+			assert.Equal(t, tc.found, found)
+			assert.Equal(t, tc.expected, annotation)
+		})
+	}
+
+	t.Run("Module address in another directory", func(t *testing.T) {
+		_, found := links.annotation(filepath.Join(projectDir, "main.tf"), "app", "", false)
+		assert.False(t, found)
+	})
+}
+
+func TestLoadLinks_Errors(t *testing.T) {
+	testCases := []struct {
+		name        string
+		content     string
+		expectedErr string
+	}{
+		{"Missing path", `link "a/b/c" {}`, "link needs a path or a git address"},
+		{"Unknown attribute", "link \"a/b/c\" {\n  dir = \"x\"\n}", `unsupported setting "dir"`},
+		{"Missing label", `link {}`, `expected a block like 'link "<source or module address>" {}'`},
+		{"Unknown block", `links "a/b/c" {}`, `expected a block like`},
+		{"Top-level attribute", `path = "x"`, `unsupported setting "path"`},
+		{"Wrong type", "link \"a/b/c\" {\n  profiles = \"x\"\n}", "profiles must be a list of strings"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			path := filepath.Join(t.TempDir(), ".terralink.local.hcl")
+			require.NoError(t, os.WriteFile(path, []byte(tc.content), 0644))
+
+			_, err := LoadLinks(path)
+			assert.ErrorContains(t, err, tc.expectedErr)
+		})
+	}
+}
+
+func TestLinker_DevLoadWithLinks(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	links, projectDir := writeLinks(t, `
+link "git::https://example.com/infra.git" {
+  path = "../infra"
+}
+`)
+	liveDir := filepath.Join(projectDir, "live")
+	moduleDir := filepath.Join(filepath.Dir(projectDir), "infra", "modules", "vpc")
+	require.NoError(t, os.MkdirAll(moduleDir, 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "main.tf"), nil, 0644))
+
+	hclPath := filepath.Join(liveDir, "main.tf")
+	initialHCL := `
+module "vpc" {
+  source  = "git::https://example.com/infra.git//modules/vpc?ref=v1.2.3"
+  version = "1.0.0"
+}
+`
+	require.NoError(t, os.WriteFile(hclPath, []byte(initialHCL), 0644))
+
+	jsonPath := filepath.Join(liveDir, "network.tf.json")
+	initialJSON := `{
+  "module": {
+    "network": {
+      "source": "git::https://example.com/infra.git//modules/vpc"
+    }
+  }
+}
+`
+	require.NoError(t, os.WriteFile(jsonPath, []byte(initialJSON), 0644))
+
+	l := NewLinker(matcher, WithLinks(links))
+	changes, err := l.DevLoad(liveDir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changes[hclPath].Modules)
+	assert.Equal(t, 1, changes[jsonPath].Modules)
+
+	content, err := os.ReadFile(hclPath)
+	require.NoError(t, err)
+	assert.Equal(t, `
+module "vpc" {
+  # terralink-state: v2 source="git::https://example.com/infra.git//modules/vpc?ref=v1.2.3" version="1.0.0"
+  source = "../../infra/modules/vpc"
+}
+`, string(content))
+
+	content, err = os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `"source": "../../infra/modules/vpc", "//": {"terralink-state": {"source":"git::https://example.com/infra.git//modules/vpc"`)
+
+	loaded, err := l.Check(liveDir)
+	require.NoError(t, err)
+	require.Len(t, loaded[hclPath], 1)
+	assert.Equal(t, filepath.ToSlash(moduleDir), loaded[hclPath][0].LocalPath)
+	require.Len(t, loaded[jsonPath], 1)
+
+	// Without the links the modules are still unloaded from their state.
+	_, err = NewLinker(matcher).DevUnload(liveDir)
+	require.NoError(t, err)
+	content, err = os.ReadFile(hclPath)
+	require.NoError(t, err)
+	assert.Equal(t, initialHCL, string(content))
+	content, err = os.ReadFile(jsonPath)
+	require.NoError(t, err)
+	assert.Equal(t, initialJSON, string(content))
+}
@@ -0,0 +1,167 @@
+package linker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+const (
+	// moduleRootPrefix introduces a named module root in an annotated path.
+	moduleRootPrefix = "@"
+	// pathAlternativeSeparator separates the alternatives of an annotated
+	// path; the first one that exists is used.
+	pathAlternativeSeparator = "|"
+)
+
+// pathCandidate is one alternative of an annotated local path.
+type pathCandidate struct {
+	// raw is the alternative as annotated.
+	raw string
+	// source is the expanded path, or an empty string if the alternative
+	// cannot be expanded.
+	source string
+	// problem describes why the alternative cannot be expanded.
+	problem string
+}
+
+// pathCandidates expands every alternative of the annotated path.
+func (a DevAnnotation) pathCandidates(filePath string, opts LoadOptions) []pathCandidate {
+	var candidates []pathCandidate
+	for _, raw := range strings.Split(a.Path, pathAlternativeSeparator) {
+		if raw == "" {
+			continue
+		}
+		source, problem := expandLocalPath(raw, filePath, opts)
+		candidates = append(candidates, pathCandidate{raw: raw, source: source, problem: problem})
+	}
+	return candidates
+}
+
+// localPath returns the local path a module is linked to: the first
+// alternative of the annotated path that expands to an existing directory,
+// or else the first one that can be expanded. Paths that cannot be expanded
+// at all are returned as annotated.
+func (a DevAnnotation) localPath(filePath string, opts LoadOptions) string {
+	candidates := a.pathCandidates(filePath, opts)
+	for _, candidate := range candidates {
+		if candidate.source == "" {
+			continue
+		}
+		if info, err := os.Stat(resolveDevPath(filePath, candidate.source)); err == nil && info.IsDir() {
+			return candidate.source
+		}
+	}
+	for _, candidate := range candidates {
+		if candidate.source != "" {
+			return candidate.source
+		}
+	}
+	return a.Path
+}
+
+// pathProblem describes why the annotated path cannot be used, or returns an
+// empty string if it can. A single alternative is only reported when it
+// cannot be expanded; several are reported when none of them exists.
+func (a DevAnnotation) pathProblem(filePath string, opts LoadOptions) string {
+	candidates := a.pathCandidates(filePath, opts)
+	if len(candidates) == 1 {
+		return candidates[0].problem
+	}
+
+	var problems []string
+	for _, candidate := range candidates {
+		if candidate.problem != "" {
+			problems = append(problems, fmt.Sprintf("'%s' %s", candidate.raw, candidate.problem))
+			continue
+		}
+		dir := resolveDevPath(filePath, candidate.source)
+		if info, err := os.Stat(dir); err == nil && info.IsDir() {
+			return ""
+		}
+		problems = append(problems, fmt.Sprintf("'%s' does not exist (resolved to %s)", candidate.raw, dir))
+	}
+	return "has no existing alternative: " + strings.Join(problems, ", ")
+}
+
+// expandLocalPath expands environment variables ("$VAR" or "${VAR}"), a
+// leading "~" and a leading "@name" module root in an annotated path. Expanded
+// and absolute paths are rewritten relative to the directory of filePath so
+// that the source written to the file stays portable; paths that already
+// start with "./" or "../" are returned as is.
+func expandLocalPath(raw, filePath string, opts LoadOptions) (string, string) {
+	var missing []string
+	path := os.Expand(raw, func(name string) string {
+		value, found := os.LookupEnv(name)
+		if !found {
+			missing = append(missing, name)
+		}
+		return value
+	})
+	if len(missing) > 0 {
+		sort.Strings(missing)
+		return "", fmt.Sprintf("uses unset environment variable(s) %s", strings.Join(missing, ", "))
+	}
+	expanded := path != raw
+
+	base, subdir := splitSourceSubdir(path)
+	switch {
+	case base == "~" || strings.HasPrefix(base, "~/"):
+		home, err := os.UserHomeDir()
+		if err != nil {
+			return "", fmt.Sprintf("cannot resolve the home directory: %v", err)
+		}
+		base = filepath.Join(home, strings.TrimPrefix(base, "~"))
+		expanded = true
+	case strings.HasPrefix(base, moduleRootPrefix):
+		name, rest, _ := strings.Cut(strings.TrimPrefix(base, moduleRootPrefix), "/")
+		root, found := opts.ModuleRoots[name]
+		if !found {
+			return "", fmt.Sprintf("refers to unknown module root '%s%s'", moduleRootPrefix, name)
+		}
+		base = filepath.Join(root, rest)
+		expanded = true
+	}
+
+	if !expanded && (filePath == "" || isLocalSource(base)) {
+		return raw, ""
+	}
+	if !filepath.IsAbs(base) {
+		base = filepath.Join(filepath.Dir(filePath), base)
+	}
+	return withSourceSubdir(relativeSource(base, filePath), subdir), ""
+}
+
+// isLocalSource reports whether path is already written the way Terraform
+// expects local module sources: relative, starting with "./" or "../".
+func isLocalSource(path string) bool {
+	return strings.HasPrefix(path, "./") || strings.HasPrefix(path, "../") || path == "." || path == ".."
+}
+
+// relativeSource returns path relative to the directory of filePath as a
+// Terraform local source, i.e. starting with "./" or "../". It returns the
+// absolute path when filePath is empty or no relative path exists.
+func relativeSource(path, filePath string) string {
+	target, err := filepath.Abs(path)
+	if err != nil {
+		return filepath.ToSlash(path)
+	}
+	if filePath == "" {
+		return filepath.ToSlash(target)
+	}
+	fileDir, err := filepath.Abs(filepath.Dir(filePath))
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	rel, err := filepath.Rel(fileDir, target)
+	if err != nil {
+		return filepath.ToSlash(target)
+	}
+	rel = filepath.ToSlash(rel)
+	if rel != ".." && !strings.HasPrefix(rel, "../") {
+		rel = "./" + rel
+	}
+	return rel
+}
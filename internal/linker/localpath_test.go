@@ -0,0 +1,97 @@
+package linker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLocalPath_Expand(t *testing.T) {
+	root := t.TempDir()
+	home := filepath.Join(root, "home")
+	filePath := filepath.Join(root, "live", "dev", "main.tf")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "vpc"), 0755))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "live", "dev", "local", "vpc"), 0755))
+	t.Setenv("HOME", home)
+	t.Setenv("TERRALINK_MODULES_ROOT", filepath.Join(root, "modules"))
+	opts := LoadOptions{ModuleRoots: map[string]string{"platform": filepath.Join(root, "modules")}}
+
+	testCases := []struct {
+		name          string
+		path          string
+		expected      string
+		expectProblem string
+	}{
+		{"Relative path", "../../modules/vpc", "../../modules/vpc", ""},
+		{"Relative path without prefix", "local/vpc", "./local/vpc", ""},
+		{"Absolute path", filepath.ToSlash(filepath.Join(root, "modules", "vpc")), "../../modules/vpc", ""},
+		{"Braced variable", "${TERRALINK_MODULES_ROOT}/vpc", "../../modules/vpc", ""},
+		{"Plain variable", "$TERRALINK_MODULES_ROOT/vpc", "../../modules/vpc", ""},
+		{"Home directory", "~/src/vpc", "../../home/src/vpc", ""},
+		{"Named root", "@platform/vpc", "../../modules/vpc", ""},
+		{"Named root with subdir", "@platform//vpc", "../../modules//vpc", ""},
+		{"First existing alternative", "../missing|@platform/vpc|./local/vpc", "../../modules/vpc", ""},
+		{"Alternatives skip unknown roots", "@other/vpc|./local/vpc", "./local/vpc", ""},
+		{"No existing alternative", "../missing|../other", "../missing", "has no existing alternative: '../missing' does not exist"},
+		{"Unset variable", "${TERRALINK_UNSET}/vpc", "${TERRALINK_UNSET}/vpc", "uses unset environment variable(s) TERRALINK_UNSET"},
+		{"Unknown root", "@other/vpc", "@other/vpc", "refers to unknown module root '@other'"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			annotation := DevAnnotation{Path: tc.path}
+			assert.Equal(t, tc.expected, annotation.localPath(filePath, opts))
+			if tc.expectProblem == "" {
+				assert.Empty(t, annotation.pathProblem(filePath, opts))
+			} else {
+				assert.Contains(t, annotation.pathProblem(filePath, opts), tc.expectProblem)
+			}
+		})
+	}
+}
+
+func TestLinker_DevLoadExpandsPaths(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	liveDir := filepath.Join(root, "live")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "vpc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "vpc", "main.tf"), nil, 0644))
+	require.NoError(t, os.MkdirAll(liveDir, 0755))
+	t.Setenv("TERRALINK_MODULES_ROOT", filepath.Join(root, "modules"))
+
+	filePath := filepath.Join(liveDir, "main.tf")
+	initialHCL := `
+module "vpc" {
+  # terralink: path=../vpc|${TERRALINK_MODULES_ROOT}/vpc
+  source = "my-registry/vpc/aws"
+}
+`
+	require.NoError(t, os.WriteFile(filePath, []byte(initialHCL), 0644))
+
+	_, err = NewLinker(matcher).DevLoad(liveDir)
+	require.NoError(t, err)
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `source = "../modules/vpc"`)
+
+	t.Run("Reports unset variables", func(t *testing.T) {
+		require.NoError(t, os.WriteFile(filePath, []byte(`
+module "vpc" {
+  # terralink: path=${TERRALINK_UNSET}/vpc
+  source = "my-registry/vpc/aws"
+}
+`), 0644))
+
+		_, err = NewLinker(matcher).DevLoad(liveDir)
+		var validationErr *PathValidationError
+		require.True(t, errors.As(err, &validationErr))
+		assert.Contains(t, validationErr.Problems[0].Reason, "TERRALINK_UNSET")
+	})
+}
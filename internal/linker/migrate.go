@@ -0,0 +1,71 @@
+package linker
+
+import (
+	"strings"
+
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	log "github.com/sirupsen/logrus"
+)
+
+// MigrateState rewrites the v1 state annotations of the loaded modules in
+// the current format, keeping the modules loaded. Files are written
+// atomically, and only in memory in dry-run mode. The state of Terraform
+// JSON modules is already JSON encoded and is left untouched.
+func (l *Linker) MigrateState(scanPaths ...string) (map[string]FileChange, error) {
+	unlock, err := l.lock(scanPaths)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var pending []ConfigFile
+	changes, err := processFiles(scanPaths, l.matcher, l.links, func(configFile ConfigFile) (FileChange, error) {
+		return l.rewrite(configFile, &pending, func(module LinkableModule) (bool, error) {
+			hclModule, isHCL := module.(*Module)
+			if !isHCL {
+				return false, nil
+			}
+			return hclModule.migrateState(), nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := l.write(pending); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// migrateState replaces the v1 state annotations of the block with the same
+// state in the current format. It returns true if the block changed.
+func (m *Module) migrateState() bool {
+	body := m.block.Body()
+	inputTokens := body.BuildTokens(nil)
+	outputTokens := make(hclwrite.Tokens, 0, len(inputTokens))
+	migrated := false
+	for _, token := range inputTokens {
+		if token.Type == hclsyntax.TokenComment && isStateAnnotationV1(string(token.Bytes)) {
+			state, _ := parseStateAnnotation(string(token.Bytes))
+			comment := buildStateAnnotation(state)
+			// Line comments may hold their newline.
+			if strings.HasSuffix(string(token.Bytes), "\n") {
+				comment += "\n"
+			}
+			migratedToken := &hclwrite.Token{Type: hclsyntax.TokenComment, Bytes: []byte(comment)}
+			m.spacing().copy(token, migratedToken)
+			token = migratedToken
+			migrated = true
+		}
+		outputTokens = append(outputTokens, token)
+	}
+	if !migrated {
+		return false
+	}
+
+	body.Clear()
+	body.AppendUnstructuredTokens(outputTokens)
+	log.Infof("migrating the state annotation of module '%s'\n", m.name)
+	return true
+}
@@ -0,0 +1,73 @@
+package linker
+
+import (
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinker_MigrateState(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "main.tf")
+	require.NoError(t, os.WriteFile(filePath, []byte(`
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  source = "../modules/vpc"
+}
+
+module "dns" {
+  # terralink: path=../modules/dns
+  # terralink-state: v2 source="my-registry/dns/aws"
+  source = "../modules/dns"
+}
+
+module "app" {
+  # terralink: path=../modules/app
+  source = "my-registry/app/aws"
+}
+`), 0644))
+
+	t.Run("Dry run", func(t *testing.T) {
+		changes, err := NewLinker(matcher, WithDryRun(true)).MigrateState(dir)
+		require.NoError(t, err)
+		assert.Equal(t, 1, changes[filePath].Modules)
+		assert.Contains(t, changes[filePath].Diff, `+  # terralink-state: v2 source="my-registry/vpc/aws" version="1.0.0"`)
+	})
+
+	changes, err := NewLinker(matcher).MigrateState(dir)
+	require.NoError(t, err)
+	assert.Equal(t, 1, changes[filePath].Modules)
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: v2 source="my-registry/vpc/aws" version="1.0.0"
+  source = "../modules/vpc"
+}
+
+module "dns" {
+  # terralink: path=../modules/dns
+  # terralink-state: v2 source="my-registry/dns/aws"
+  source = "../modules/dns"
+}
+
+module "app" {
+  # terralink: path=../modules/app
+  source = "my-registry/app/aws"
+}
+`, string(content))
+
+	changes, err = NewLinker(matcher).MigrateState(dir)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+}
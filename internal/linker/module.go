@@ -1,19 +1,33 @@
 package linker
 
 import (
+	"bytes"
 	"fmt"
+	"sort"
+	"strconv"
+	"strings"
 
+	"github.com/hashicorp/hcl/v2"
 	"github.com/hashicorp/hcl/v2/hclsyntax"
 	"github.com/hashicorp/hcl/v2/hclwrite"
 	"github.com/sirupsen/logrus"
 	"github.com/zclconf/go-cty/cty"
 )
 
-// Module represents a single "module" block within a Terraform file.
+// terragruntModuleName is the name reported for Terragrunt "terraform" blocks,
+// which carry no label of their own.
+const terragruntModuleName = "terraform"
+
+// Module represents a single "module" block within a Terraform file, or the
+// "terraform" block of a Terragrunt configuration.
 // It provides methods to inspect and manipulate the module's state.
 type Module struct {
-	name  string
-	block *hclwrite.Block
+	name       string
+	block      *hclwrite.Block
+	terragrunt bool
+	file       *HCLFile
+	// linked is the dev annotation given by a links file, if any.
+	linked *DevAnnotation
 }
 
 // NewModule creates a new Module instance from a name and an HCL block.
@@ -21,11 +35,137 @@ func NewModule(name string, block *hclwrite.Block) *Module {
 	return &Module{name: name, block: block}
 }
 
+// NewTerragruntModule creates a new Module instance from the "terraform"
+// block of a Terragrunt configuration.
+func NewTerragruntModule(block *hclwrite.Block) *Module {
+	return &Module{name: terragruntModuleName, block: block, terragrunt: true}
+}
+
 // Name returns the name of the module.
 func (m *Module) Name() string {
 	return m.name
 }
 
+// Source returns the current value of the module's source attribute.
+func (m *Module) Source() string {
+	return getAttrValueAsString(m.block.Body().GetAttribute("source"))
+}
+
+// DevAnnotation returns the module's dev annotation: its "# terralink:"
+// comment, or else the annotation given by a links file.
+func (m *Module) DevAnnotation() (DevAnnotation, bool) {
+	if annotation, found := findDevAnnotation(m.block); found {
+		return annotation, true
+	}
+	if m.linked != nil {
+		return *m.linked, true
+	}
+	return DevAnnotation{}, false
+}
+
+// link looks the module up in links, to be used when it has no dev
+// annotation comment.
+func (m *Module) link(links *Links) {
+	if annotation, found := links.annotation(m.filePath(), m.name, linkSource(m), m.terragrunt); found {
+		m.linked = &annotation
+	}
+}
+
+// DevSource returns the source the module is switched to when loaded.
+func (m *Module) DevSource(opts LoadOptions) (string, bool) {
+	devAnnotation, found := m.DevAnnotation()
+	if !found {
+		return "", false
+	}
+	return devAnnotation.devSource(m.Source(), m.terragrunt, m.filePath(), opts), true
+}
+
+// filePath returns the path of the file declaring the module, or an empty
+// string if the module was not read from an HCLFile.
+func (m *Module) filePath() string {
+	if m.file == nil {
+		return ""
+	}
+	return m.file.path
+}
+
+// State returns the original source and version recorded in the module's
+// state annotation.
+func (m *Module) State() (StateAnnotation, bool) {
+	return findStateAnnotation(m.block)
+}
+
+// Pos returns the position of the module's block type, after any comment
+// leading the block. It returns the zero position if the module was not read
+// from an HCLFile.
+func (m *Module) Pos() hcl.Pos {
+	if m.file == nil {
+		return hcl.Pos{}
+	}
+	for _, token := range m.block.BuildTokens(nil) {
+		if token.Type == hclsyntax.TokenIdent {
+			return m.file.position(token)
+		}
+	}
+	return hcl.Pos{}
+}
+
+// StatePos returns the position of the module's state annotation comment.
+// It returns the zero position if the module is not loaded or was not read
+// from an HCLFile.
+func (m *Module) StatePos() hcl.Pos {
+	_, token := findStateAnnotationToken(m.block)
+	if token == nil || m.file == nil {
+		return hcl.Pos{}
+	}
+	return m.file.position(token)
+}
+
+// callSite returns the arguments passed to the module by its block. Terragrunt
+// blocks pass inputs differently and have no call site to verify.
+func (m *Module) callSite() (moduleCallSite, bool) {
+	if m.terragrunt || m.file == nil {
+		return moduleCallSite{}, false
+	}
+	file, diags := hclsyntax.ParseConfig(m.file.Bytes(), m.file.path, hcl.InitialPos)
+	if diags.HasErrors() {
+		return moduleCallSite{}, false
+	}
+	for _, block := range file.Body.(*hclsyntax.Body).Blocks {
+		if block.Type != "module" || len(block.Labels) != 1 || block.Labels[0] != m.name {
+			continue
+		}
+		callSite := moduleCallSite{Pos: block.TypeRange.Start, Arguments: map[string]hcl.Pos{}}
+		for name, attr := range block.Body.Attributes {
+			callSite.Arguments[name] = attr.NameRange.Start
+		}
+		return callSite, true
+	}
+	return moduleCallSite{}, false
+}
+
+// stateCount returns the number of state annotation comments in the block.
+func (m *Module) stateCount() int {
+	count := 0
+	for _, token := range m.block.Body().BuildTokens(nil) {
+		if token.Type == hclsyntax.TokenComment {
+			if _, isState := parseStateAnnotation(string(token.Bytes)); isState {
+				count++
+			}
+		}
+	}
+	return count
+}
+
+// devSources returns every source the module may have been switched to.
+func (m *Module) devSources(opts LoadOptions) []string {
+	devAnnotation, found := m.DevAnnotation()
+	if !found {
+		return nil
+	}
+	return devAnnotation.devSources(linkSource(m), m.terragrunt, m.filePath(), opts)
+}
+
 // IsLoaded checks if the module is currently in a "loaded" (dev) state by
 // looking for a state annotation.
 func (m *Module) IsLoaded() bool {
@@ -34,101 +174,135 @@ func (m *Module) IsLoaded() bool {
 }
 
 // Load activates the development mode for this module by replacing the source
-// with a local path and injecting a state annotation to remember the original source.
-// It performs low-level token manipulation to ensure comments are placed correctly.
+// with a local path (or git address) and injecting a state annotation to remember
+// the original source.
+// It performs low-level token manipulation to ensure comments are placed correctly,
+// and leaves every other token as it was, so that Unload restores the block
+// byte for byte.
 // It returns true if a change was made.
-func (m *Module) Load() (bool, error) {
+func (m *Module) Load(opts LoadOptions) (bool, error) {
 	if m.IsLoaded() {
 		return false, nil
 	}
 
-	devPath, devAnnotationFound := findDevAnnotation(m.block)
+	devAnnotation, devAnnotationFound := m.DevAnnotation()
 	if !devAnnotationFound {
 		return false, nil
 	}
+	_, commented := findDevAnnotation(m.block)
 
-	originalSource := getAttrValueAsString(m.block.Body().GetAttribute("source"))
-	originalVersion := getAttrValueAsString(m.block.Body().GetAttribute("version"))
-
-	if originalSource == "" {
+	body := m.block.Body()
+	inputTokens := body.BuildTokens(nil)
+	source, sourceEnd, err := attributeLine(inputTokens, "source")
+	if err != nil {
+		return false, err
+	}
+	if source < 0 {
 		return false, fmt.Errorf("module has no source attribute")
 	}
+	version, versionEnd, err := attributeLine(inputTokens, "version")
+	if err != nil {
+		return false, err
+	}
+	// A block formatted like 'terraform fmt' stays formatted.
+	formatted := m.formatted()
+	state, err := m.originalState(inputTokens, formatted)
+	if err != nil {
+		return false, err
+	}
+	devSource := devAnnotation.devSource(state.Source, m.terragrunt, m.filePath(), opts)
+
+	spacing := m.spacing()
+	// The state annotation is indented like the source attribute and ends
+	// like its line.
+	newline := lineEnding(inputTokens[sourceEnd])
+	var stateComments hclwrite.Tokens
+	stateTokens := func() hclwrite.Tokens {
+		comment := &hclwrite.Token{Type: hclsyntax.TokenComment, Bytes: []byte(buildStateAnnotation(state))}
+		spacing.copy(inputTokens[source], comment)
+		stateComments = append(stateComments, comment)
+		return hclwrite.Tokens{comment, {Type: hclsyntax.TokenNewline, Bytes: []byte(newline)}}
+	}
 
-	stateAnnotationStr := buildStateAnnotation(originalSource, originalVersion)
-
-	body := m.block.Body()
-	inputTokens := body.BuildTokens(nil)
 	outputTokens := hclwrite.Tokens{}
-	sourceReplaced := false
-	braceLevel := 0
-	parenLevel := 0
+	// Linked modules have no dev annotation to follow; the state annotation
+	// opens the block instead.
+	stateInjected := commented
 	for i := 0; i < len(inputTokens); i++ {
 		token := inputTokens[i]
 
-		if token.Type == hclsyntax.TokenOBrace {
-			braceLevel++
-		}
-
-		if token.Type == hclsyntax.TokenCBrace {
-			braceLevel--
-		}
-		if token.Type == hclsyntax.TokenOParen {
-			parenLevel++
-		}
-		if token.Type == hclsyntax.TokenCParen {
-			parenLevel--
+		if !stateInjected && token.Type != hclsyntax.TokenNewline {
+			outputTokens = append(outputTokens, stateTokens()...)
+			stateInjected = true
 		}
 
-		// Find the `source` attribute and replace its line with the new local path.
-		if !sourceReplaced && token.Type == hclsyntax.TokenIdent && string(token.Bytes) == "source" && braceLevel == 0 && parenLevel == 0 {
-			outputTokens = append(outputTokens, buildAttributeTokens("source", devPath)...)
-			sourceReplaced = true
-
-			// Skip the original source attribute tokens until the next newline.
-			tokensToSkip, err := tokensUntil(inputTokens[i:], hclsyntax.TokenNewline)
-			if err != nil {
-				return false, fmt.Errorf("failed to find end of source attribute: %w", err)
+		// Replace the expression of the `source` attribute with the new local
+		// path, keeping its name, alignment and line ending.
+		if i == source {
+			outputTokens = append(outputTokens, inputTokens[source], inputTokens[source+1])
+			sourceTokens := hclwrite.TokensForValue(cty.StringVal(devSource))
+			spacing.copy(inputTokens[source+2], sourceTokens[0])
+			outputTokens = append(outputTokens, sourceTokens...)
+			// A trailing comment is part of the recorded expression, unless it
+			// is the dev annotation.
+			end := inputTokens[sourceEnd]
+			if end.Type == hclsyntax.TokenComment && !isDevComment(end) {
+				end = &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte(lineEnding(end))}
 			}
-			i += tokensToSkip
+			outputTokens = append(outputTokens, end)
+			if isDevComment(end) {
+				outputTokens = append(outputTokens, stateTokens()...)
+			}
+			i = sourceEnd
 			continue
 		}
 
-		// Find and remove the `version` attribute line.
-		if token.Type == hclsyntax.TokenIdent && string(token.Bytes) == "version" && braceLevel == 0 && parenLevel == 0 {
-			tokensToSkip, err := tokensUntil(inputTokens[i:], hclsyntax.TokenNewline)
-			if err != nil {
-				return false, fmt.Errorf("failed to find end of version attribute: %w", err)
+		// Remove the `version` attribute line. A dev annotation ending it
+		// stays in its place, on a line of its own.
+		if i == version {
+			if end := inputTokens[versionEnd]; isDevComment(end) {
+				comment := &hclwrite.Token{Type: end.Type, Bytes: end.Bytes}
+				spacing.copy(inputTokens[version], comment)
+				outputTokens = append(outputTokens, comment)
+				outputTokens = append(outputTokens, stateTokens()...)
 			}
-			i += tokensToSkip
+			i = versionEnd
 			continue
 		}
 
 		outputTokens = append(outputTokens, token)
 
 		// Find the dev annotation and inject the state annotation right after it.
-		if token.Type == hclsyntax.TokenComment {
-			if _, isDev := parseDevAnnotation(string(token.Bytes)); isDev {
-				outputTokens = append(outputTokens, &hclwrite.Token{
-					Type:  hclsyntax.TokenComment,
-					Bytes: []byte(stateAnnotationStr),
-				}, &hclwrite.Token{
-					Type:  hclsyntax.TokenNewline,
-					Bytes: []byte("\n"),
-				})
-			}
+		if isDevComment(token) {
+			outputTokens = append(outputTokens, stateTokens()...)
 		}
 	}
 
 	body.Clear()
 	body.AppendUnstructuredTokens(outputTokens)
+	if formatted {
+		if err := m.format(); err != nil {
+			return false, err
+		}
+	} else if m.formatted() {
+		// Unload formats a formatted block; tell it this one was not.
+		if state.Attributes == nil {
+			state.Attributes = map[string]string{}
+		}
+		state.Attributes[stateUnformattedKey] = "true"
+		for _, comment := range stateComments {
+			comment.Bytes = []byte(buildStateAnnotation(state))
+		}
+	}
 
-	logrus.Infof("loading module '%s' with local path '%s'\n", m.name, devPath)
+	logrus.Infof("loading module '%s' with dev source '%s'\n", m.name, devSource)
 	return true, nil
 }
 
 // Unload deactivates dev mode by restoring the original source and version
 // from the state annotation and removing the annotation itself.
-// It uses token manipulation to preserve user comments and formatting.
+// It uses token manipulation to preserve user comments and formatting, and
+// puts the version line back where it was.
 // It returns true if a change was made.
 func (m *Module) Unload() (bool, error) {
 	state, stateAnnotationFound := findStateAnnotation(m.block)
@@ -138,8 +312,17 @@ func (m *Module) Unload() (bool, error) {
 
 	body := m.block.Body()
 	inputTokens := body.BuildTokens(nil)
+	source, sourceEnd, err := attributeLine(inputTokens, "source")
+	if err != nil {
+		return false, err
+	}
+	if source < 0 {
+		return false, fmt.Errorf("module has no source attribute")
+	}
+	formatted := m.formatted() && state.Attributes[stateUnformattedKey] == ""
+	spacing := m.spacing()
 	outputTokens := hclwrite.Tokens{}
-	sourceReplaced := false
+	restoredSource := 0
 
 	for i := 0; i < len(inputTokens); i++ {
 		token := inputTokens[i]
@@ -147,60 +330,327 @@ func (m *Module) Unload() (bool, error) {
 		// Skip existing terralink-state comments.
 		if token.Type == hclsyntax.TokenComment {
 			if _, isState := parseStateAnnotation(string(token.Bytes)); isState {
-				// Also skip the following newline if it exists.
-				if i+1 < len(inputTokens) && inputTokens[i+1].Type == hclsyntax.TokenNewline {
+				// Also skip the newline ending it, unless the comment holds it.
+				if !endsLine(token) && i+1 < len(inputTokens) && inputTokens[i+1].Type == hclsyntax.TokenNewline {
 					i++
 				}
 				continue
 			}
 		}
 
-		// Find and replace the source attribute.
-		if !sourceReplaced && token.Type == hclsyntax.TokenIdent && string(token.Bytes) == "source" {
-			outputTokens = append(outputTokens, buildAttributeTokens("source", state.Source)...)
-			if state.Version != "" {
-				outputTokens = append(outputTokens, buildAttributeTokens("version", state.Version)...)
-			}
-			sourceReplaced = true
-
-			tokensToSkip, err := tokensUntil(inputTokens[i:], hclsyntax.TokenNewline)
+		// Replace the expression of the source attribute with the original one.
+		if i == source {
+			end := inputTokens[sourceEnd]
+			lineTokens, err := parseLine("source = "+originalExpr(state, "source")+lineEnding(end), spacing)
 			if err != nil {
-				return false, fmt.Errorf("failed to find end of source attribute: %w", err)
+				return false, fmt.Errorf("failed to restore the original source: %w", err)
+			}
+			sourceTokens := lineTokens[2:]
+			spacing.copy(inputTokens[source+2], sourceTokens[0])
+			// Keep the line ending, or the comment holding it, unless the
+			// original expression has a comment of its own.
+			if sourceTokens[len(sourceTokens)-1].Type == hclsyntax.TokenNewline {
+				sourceTokens[len(sourceTokens)-1] = end
 			}
-			i += tokensToSkip
+			restoredSource = len(outputTokens)
+			outputTokens = append(outputTokens, inputTokens[source], inputTokens[source+1])
+			outputTokens = append(outputTokens, sourceTokens...)
+			i = sourceEnd
 			continue
 		}
 
 		outputTokens = append(outputTokens, token)
 	}
 
+	versionTokens, err := m.originalVersionLine(state, inputTokens[source], lineEnding(inputTokens[sourceEnd]))
+	if err != nil {
+		return false, fmt.Errorf("failed to restore the original version: %w", err)
+	}
+	if versionTokens != nil {
+		outputTokens = restoreVersionLine(outputTokens, restoredSource, versionOffset(state), versionTokens)
+	}
+
 	body.Clear()
 	body.AppendUnstructuredTokens(outputTokens)
+	if formatted {
+		if err := m.format(); err != nil {
+			return false, err
+		}
+	}
 	logrus.Infof("unloading module '%s' to original source '%s'\n", m.name, state.Source)
 	return true, nil
 }
 
+// spacing returns the whitespace kept for the tokens of the file declaring
+// the module, or nil if the module was not read from an HCLFile.
+func (m *Module) spacing() spacing {
+	if m.file == nil {
+		return nil
+	}
+	return m.file.spacing
+}
+
+// formatted reports whether the block is formatted like 'terraform fmt'.
+func (m *Module) formatted() bool {
+	content := m.spacing().bytes(m.block.BuildTokens(nil))
+	return bytes.Equal(hclwrite.Format(content), content)
+}
+
+// format formats the block like 'terraform fmt'.
+func (m *Module) format() error {
+	file, diags := hclwrite.ParseConfig(hclwrite.Format(m.block.BuildTokens(nil).Bytes()), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return fmt.Errorf("failed to format module '%s': %w", m.name, diags)
+	}
+	blocks := file.Body().Blocks()
+	if len(blocks) != 1 {
+		return fmt.Errorf("failed to format module '%s'", m.name)
+	}
+	m.block.Body().Clear()
+	m.block.Body().AppendUnstructuredTokens(blocks[0].Body().BuildTokens(nil))
+	return nil
+}
+
+// originalState returns the state annotation recording the block's source
+// and version. Unless they are plain string literals, their exact text is
+// recorded too, so that interpolations, heredocs and trailing comments are
+// restored as they were. So are the position and the layout of the version
+// line when Unload would not write them back the same way.
+func (m *Module) originalState(tokens hclwrite.Tokens, formatted bool) (StateAnnotation, error) {
+	state := StateAnnotation{
+		Source:     getAttrValueAsString(m.block.Body().GetAttribute("source")),
+		Version:    getAttrValueAsString(m.block.Body().GetAttribute("version")),
+		Attributes: map[string]string{},
+	}
+	spacing := m.spacing()
+	source, sourceEnd, err := attributeLine(tokens, "source")
+	if err != nil {
+		return StateAnnotation{}, err
+	}
+	version, versionEnd, err := attributeLine(tokens, "version")
+	if err != nil {
+		return StateAnnotation{}, err
+	}
+
+	if expr := spacing.expr(tokens[source+2 : sourceEnd+1]); expr != quotedString(state.Source) {
+		state.Attributes[stateSourceExprKey] = expr
+	}
+	if version >= 0 {
+		// An empty version is only written back if its expression is recorded.
+		if expr := spacing.expr(tokens[version+2 : versionEnd+1]); expr != quotedString(state.Version) || state.Version == "" {
+			state.Attributes[stateVersionExprKey] = expr
+		}
+		line := string(spacing.bytes(tokens[version : versionEnd+1]))
+		// Formatting restores the layout of a formatted block, but not the line
+		// ending or a dev annotation ending the line.
+		newline := lineEnding(tokens[sourceEnd])
+		if line != defaultVersionLine(state, spacing.before(tokens[source]), newline) &&
+			(!formatted || lineEnding(tokens[versionEnd]) != newline || isDevComment(tokens[versionEnd])) {
+			state.Attributes[stateVersionLineKey] = line
+		}
+		starts := lineStarts(tokens)
+		if offset := lineIndex(starts, version) - lineIndex(starts, source); offset != 1 {
+			state.Attributes[stateVersionOffsetKey] = strconv.Itoa(offset)
+		}
+	}
+
+	if len(state.Attributes) == 0 {
+		state.Attributes = nil
+	}
+	return state, nil
+}
+
+// originalExpr returns the text of the original expression of the source or
+// version recorded in a state annotation.
+func originalExpr(state StateAnnotation, name string) string {
+	if expr := state.Attributes[name+"_expr"]; expr != "" {
+		return expr
+	}
+	if name == "version" {
+		return quotedString(state.Version)
+	}
+	return quotedString(state.Source)
+}
+
+// defaultVersionLine returns the version line Unload writes when no layout
+// is recorded: indented like the source and ending like the lines of the
+// file.
+func defaultVersionLine(state StateAnnotation, indent, ending string) string {
+	return indent + "version = " + originalExpr(state, "version") + ending
+}
+
+// originalVersionLine returns the tokens of the original version line of a
+// state annotation, or nil if it has no version. source is the name token of
+// the source attribute and newline the line ending of its line.
+func (m *Module) originalVersionLine(state StateAnnotation, source *hclwrite.Token, newline string) (hclwrite.Tokens, error) {
+	line := state.Attributes[stateVersionLineKey]
+	if line == "" {
+		if state.Version == "" && state.Attributes[stateVersionExprKey] == "" {
+			return nil, nil
+		}
+		line = defaultVersionLine(state, m.spacing().before(source), newline)
+	}
+	return parseLine(line, m.spacing())
+}
+
+// versionOffset returns the number of lines from the source line to the
+// version line recorded in a state annotation, 1 by default.
+func versionOffset(state StateAnnotation) int {
+	if offset, err := strconv.Atoi(state.Attributes[stateVersionOffsetKey]); err == nil && offset != 0 {
+		return offset
+	}
+	return 1
+}
+
 // --- Token Helpers ---
 
-// tokensUntil is a helper to count tokens until a specific type is found.
-func tokensUntil(tokens hclwrite.Tokens, tokenType hclsyntax.TokenType) (int, error) {
+// nesting returns how a token changes the nesting depth of brackets,
+// parentheses, braces and template sequences.
+func nesting(token *hclwrite.Token) int {
+	switch token.Type {
+	case hclsyntax.TokenOParen, hclsyntax.TokenOBrack, hclsyntax.TokenOBrace,
+		hclsyntax.TokenTemplateInterp, hclsyntax.TokenTemplateControl:
+		return 1
+	case hclsyntax.TokenCParen, hclsyntax.TokenCBrack, hclsyntax.TokenCBrace, hclsyntax.TokenTemplateSeqEnd:
+		return -1
+	}
+	return 0
+}
+
+// endsLine reports whether a token ends its line: a newline, or a line
+// comment holding it.
+func endsLine(token *hclwrite.Token) bool {
+	switch token.Type {
+	case hclsyntax.TokenNewline:
+		return true
+	case hclsyntax.TokenComment:
+		return strings.HasSuffix(string(token.Bytes), "\n")
+	}
+	return false
+}
+
+// lineEnding returns the line ending of a token ending its line.
+func lineEnding(token *hclwrite.Token) string {
+	if strings.HasSuffix(string(token.Bytes), "\r\n") {
+		return "\r\n"
+	}
+	return "\n"
+}
+
+// isDevComment reports whether a token is a dev annotation comment.
+func isDevComment(token *hclwrite.Token) bool {
+	if token.Type != hclsyntax.TokenComment {
+		return false
+	}
+	_, isDev := parseDevAnnotation(string(token.Bytes))
+	return isDev
+}
+
+// attributeEnd returns the index of the last token of the attribute whose
+// name is tokens[0]: the newline ending its line, or the trailing comment
+// holding that newline. Newlines within brackets, parentheses, braces and
+// template sequences do not end the attribute.
+func attributeEnd(tokens hclwrite.Tokens) (int, error) {
+	depth := 0
 	for i, token := range tokens {
-		if token.Type == tokenType {
+		depth += nesting(token)
+		if depth == 0 && endsLine(token) {
 			return i, nil
 		}
 	}
-	return 0, fmt.Errorf("token %s not found in tokens", tokenType)
+	return 0, fmt.Errorf("end of attribute %s not found", tokens[0].Bytes)
+}
+
+// attributeLine returns the indices of the name and of the last token of the
+// attribute called name among the tokens of a body, outside nested blocks
+// and expressions, or -1 if there is none.
+func attributeLine(tokens hclwrite.Tokens, name string) (int, int, error) {
+	depth := 0
+	for i := 0; i+1 < len(tokens); i++ {
+		if depth == 0 && tokens[i].Type == hclsyntax.TokenIdent && string(tokens[i].Bytes) == name && tokens[i+1].Type == hclsyntax.TokenEqual {
+			end, err := attributeEnd(tokens[i:])
+			if err != nil {
+				return -1, -1, err
+			}
+			return i, i + end, nil
+		}
+		depth += nesting(tokens[i])
+	}
+	return -1, -1, nil
+}
+
+// lineStarts returns the indices of the tokens starting each line of a body.
+func lineStarts(tokens hclwrite.Tokens) []int {
+	starts := []int{}
+	depth := 0
+	lineStart := true
+	for i, token := range tokens {
+		if lineStart {
+			starts = append(starts, i)
+		}
+		depth += nesting(token)
+		lineStart = depth == 0 && endsLine(token)
+	}
+	return starts
+}
+
+// lineIndex returns the index of the line holding the token at index i.
+func lineIndex(starts []int, i int) int {
+	return sort.SearchInts(starts, i+1) - 1
 }
 
-// buildAttributeTokens creates the HCL tokens for a complete attribute line.
-func buildAttributeTokens(name, value string) hclwrite.Tokens {
-	// Using NewExpressionLiteral ensures proper quoting and escaping.
-	expr := hclwrite.NewExpressionLiteral(cty.StringVal(value))
-	tokens := hclwrite.Tokens{
-		{Type: hclsyntax.TokenIdent, Bytes: []byte(name)},
-		{Type: hclsyntax.TokenEqual, Bytes: []byte("=")},
+// insertLine inserts the tokens of a line into the tokens of a body, offset
+// lines after the line holding the token at index i, or before it if offset
+// is negative. The position is clamped to the body.
+func insertLine(tokens hclwrite.Tokens, i, offset int, line hclwrite.Tokens) hclwrite.Tokens {
+	starts := lineStarts(tokens)
+	target := lineIndex(starts, i) + offset
+	if offset < 0 {
+		// The line was counted before the line holding i, which it now precedes.
+		target++
 	}
-	tokens = append(tokens, expr.BuildTokens(nil)...)
-	tokens = append(tokens, &hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte("\n")})
-	return tokens
+	at := len(tokens)
+	if target < 0 {
+		at = 0
+	} else if target < len(starts) {
+		at = starts[target]
+	}
+	result := make(hclwrite.Tokens, 0, len(tokens)+len(line))
+	result = append(result, tokens[:at]...)
+	result = append(result, line...)
+	return append(result, tokens[at:]...)
+}
+
+// restoreVersionLine puts the version line back. If it ends with the dev
+// annotation, which Load left on a line of its own, it replaces that line;
+// otherwise it is inserted offset lines from the line holding i.
+func restoreVersionLine(tokens hclwrite.Tokens, i, offset int, line hclwrite.Tokens) hclwrite.Tokens {
+	if end := line[len(line)-1]; isDevComment(end) {
+		for _, start := range lineStarts(tokens) {
+			if start < len(tokens) && tokens[start].Type == hclsyntax.TokenComment &&
+				bytes.Equal(tokens[start].Bytes, end.Bytes) {
+				result := make(hclwrite.Tokens, 0, len(tokens)+len(line)-1)
+				result = append(result, tokens[:start]...)
+				result = append(result, line...)
+				return append(result, tokens[start+1:]...)
+			}
+		}
+	}
+	return insertLine(tokens, i, offset, line)
+}
+
+// parseLine parses a line of HCL into tokens, recording the whitespace
+// before them.
+func parseLine(line string, spacing spacing) (hclwrite.Tokens, error) {
+	file, diags := hclwrite.ParseConfig([]byte(line), "", hcl.InitialPos)
+	if diags.HasErrors() {
+		return nil, fmt.Errorf("failed to parse %q: %w", line, diags)
+	}
+	spacing.record([]byte(line), file.BuildTokens(nil))
+	return file.Body().BuildTokens(nil), nil
+}
+
+// quotedString returns the HCL string literal of a value.
+func quotedString(value string) string {
+	return string(hclwrite.TokensForValue(cty.StringVal(value)).Bytes())
 }
@@ -1,6 +1,10 @@
 package linker
 
 import (
+	"bytes"
+	"flag"
+	"os"
+	"path/filepath"
 	"testing"
 
 	"github.com/hashicorp/hcl/v2"
@@ -9,6 +13,8 @@ import (
 	"github.com/stretchr/testify/require"
 )
 
+var updateGolden = flag.Bool("update", false, "rewrite the golden files of testdata/roundtrip")
+
 // Helper to create a test module and its parent file from HCL string content
 func createTestModule(t *testing.T, content string) (*Module, *hclwrite.File) {
 	t.Helper()
@@ -39,7 +45,7 @@ module "test" {
 			expectedHCL: `
 module "test" {
   # terralink: path=../local
-  # terralink-state: source="remote/source" version="1.0.0"
+  # terralink-state: v2 source="remote/source" version="1.0.0"
   source = "../local"
 }`,
 			expectChange: true,
@@ -54,7 +60,7 @@ module "test" {
 			expectedHCL: `
 module "test" {
   # terralink: path=../local
-  # terralink-state: source="remote/source"
+  # terralink-state: v2 source="remote/source"
   source = "../local"
 }`,
 			expectChange: true,
@@ -94,7 +100,7 @@ module "test" {
 	for _, tc := range testCases {
 		t.Run(tc.name, func(t *testing.T) {
 			module, hclFile := createTestModule(t, tc.initialHCL)
-			changed, err := module.Load()
+			changed, err := module.Load(LoadOptions{})
 
 			if tc.expectErr {
 				assert.Error(t, err)
@@ -144,6 +150,22 @@ module "test" {
 module "test" {
   # terralink: path=../local
   source = "remote/source"
+}`,
+			expectChange: true,
+		},
+		{
+			name: "Unload a module with a v2 state annotation",
+			initialHCL: `
+module "test" {
+  # terralink: path=../local
+  # terralink-state: v2 source="remote/\"source\"" version="1.0.0" owner="net"
+  source = "../local"
+}`,
+			expectedHCL: `
+module "test" {
+  # terralink: path=../local
+  source  = "remote/\"source\""
+  version = "1.0.0"
 }`,
 			expectChange: true,
 		},
@@ -181,3 +203,281 @@ module "test" {
 		})
 	}
 }
+
+func TestModule_LoadUnloadEscapedValues(t *testing.T) {
+	initialHCL := `
+module "test" {
+  # terralink: path=../local
+  source  = "git::https://host/org/mod.git?ref=v1#\"x\""
+  version = ">= 1.0, < 2.0 # \\latest"
+}`
+	module, hclFile := createTestModule(t, initialHCL)
+	changed, err := module.Load(LoadOptions{})
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Contains(t, string(hclFile.Bytes()), `# terralink-state: v2 source="git::https://host/org/mod.git?ref=v1#\"x\"" version=">= 1.0, < 2.0 # \\latest"`)
+
+	state, loaded := module.State()
+	assert.True(t, loaded)
+	assert.Equal(t, StateAnnotation{Source: `git::https://host/org/mod.git?ref=v1#"x"`, Version: `>= 1.0, < 2.0 # \latest`}, state)
+
+	changed, err = module.Unload()
+	require.NoError(t, err)
+	assert.True(t, changed)
+	assert.Equal(t, formatHcl([]byte(initialHCL)), formatHcl(hclFile.Bytes()))
+}
+
+func TestModule_LoadUnloadExpressions(t *testing.T) {
+	testCases := []struct {
+		name          string
+		initialHCL    string
+		expectedState string
+	}{
+		{
+			name: "Trailing comments",
+			initialHCL: `
+module "test" {
+  # terralink: path=../local
+  source  = "remote/source" # pinned by platform
+  version = "1.0.0" // see CHANGELOG
+  count   = 1
+}
+`,
+			expectedState: `# terralink-state: v2 source="remote/source" version="1.0.0" source_expr="\"remote/source\" # pinned by platform" version_expr="\"1.0.0\" // see CHANGELOG"`,
+		},
+		{
+			name: "Interpolated source",
+			initialHCL: `
+module "test" {
+  # terralink: path=../local
+  source  = "${local.registry}/vpc/aws"
+  version = var.vpc_version
+}
+`,
+			expectedState: `# terralink-state: v2 source="\"$${local.registry}/vpc/aws\"" version="var.vpc_version" source_expr="\"$${local.registry}/vpc/aws\"" version_expr="var.vpc_version"`,
+		},
+		{
+			name: "Heredoc source",
+			initialHCL: `
+module "test" {
+  # terralink: path=../local
+  source = <<EOT
+remote/source
+EOT
+}
+`,
+			expectedState: `# terralink-state: v2 source="remote/source\n" source_expr="<<EOT\nremote/source\nEOT"`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module, hclFile := createTestModule(t, tc.initialHCL)
+			changed, err := module.Load(LoadOptions{})
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.Contains(t, string(hclFile.Bytes()), tc.expectedState)
+			assert.Contains(t, string(hclFile.Bytes()), `source = "../local"`)
+
+			changed, err = module.Unload()
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.Equal(t, formatHcl([]byte(tc.initialHCL)), formatHcl(hclFile.Bytes()))
+		})
+	}
+}
+
+func TestModule_LoadGit(t *testing.T) {
+	testCases := []struct {
+		name        string
+		initialHCL  string
+		opts        LoadOptions
+		expectedHCL string
+	}{
+		{
+			name: "Git annotation replaces registry source",
+			initialHCL: `
+module "test" {
+  # terralink: git=git::ssh://git@host/org/mod.git ref=feature/x
+  source  = "remote/source"
+  version = "1.0.0"
+}`,
+			expectedHCL: `
+module "test" {
+  # terralink: git=git::ssh://git@host/org/mod.git ref=feature/x
+  # terralink-state: v2 source="remote/source" version="1.0.0"
+  source = "git::ssh://git@host/org/mod.git?ref=feature/x"
+}`,
+		},
+		{
+			name: "Git annotation keeps subdir of original source",
+			initialHCL: `
+module "test" {
+  # terralink: git=git::ssh://git@host/org/mod.git ref=feature/x
+  source = "git::https://host/org/mod.git//modules/vpc?ref=v1.2.3"
+}`,
+			expectedHCL: `
+module "test" {
+  # terralink: git=git::ssh://git@host/org/mod.git ref=feature/x
+  # terralink-state: v2 source="git::https://host/org/mod.git//modules/vpc?ref=v1.2.3"
+  source = "git::ssh://git@host/org/mod.git//modules/vpc?ref=feature/x"
+}`,
+		},
+		{
+			name: "Ref override",
+			initialHCL: `
+module "test" {
+  # terralink: git=git::ssh://git@host/org/mod.git ref=feature/x
+  source = "remote/source"
+}`,
+			opts: LoadOptions{Ref: "hotfix/y"},
+			expectedHCL: `
+module "test" {
+  # terralink: git=git::ssh://git@host/org/mod.git ref=feature/x
+  # terralink-state: v2 source="remote/source"
+  source = "git::ssh://git@host/org/mod.git?ref=hotfix/y"
+}`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			module, hclFile := createTestModule(t, tc.initialHCL)
+			changed, err := module.Load(tc.opts)
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.Equal(t, formatHcl([]byte(tc.expectedHCL)), formatHcl(hclFile.Bytes()))
+
+			changed, err = module.Unload()
+			require.NoError(t, err)
+			assert.True(t, changed)
+			assert.Equal(t, formatHcl([]byte(tc.initialHCL)), formatHcl(hclFile.Bytes()))
+		})
+	}
+}
+
+// loadUnloadFile loads every module of an HCL file, then unloads every
+// module of the loaded content read back. It returns the loaded and the
+// unloaded content, or an error if a module cannot be loaded.
+func loadUnloadFile(t *testing.T, path string, content []byte) ([]byte, []byte, error) {
+	t.Helper()
+	file, err := ParseHCLFile(path, content)
+	if err != nil {
+		return nil, nil, err
+	}
+	for _, module := range file.hclModules() {
+		if _, err := module.Load(LoadOptions{}); err != nil {
+			return nil, nil, err
+		}
+	}
+	loaded := file.Bytes()
+
+	file, err = ParseHCLFile(path, loaded)
+	require.NoError(t, err, "loaded content does not parse:\n%s", loaded)
+	for _, module := range file.hclModules() {
+		_, err := module.Unload()
+		require.NoError(t, err)
+	}
+	return loaded, file.Bytes(), nil
+}
+
+func TestModule_LoadUnloadGolden(t *testing.T) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "roundtrip", "*.tf"))
+	require.NoError(t, err)
+	require.NotEmpty(t, paths)
+
+	for _, path := range paths {
+		t.Run(filepath.Base(path), func(t *testing.T) {
+			content, err := os.ReadFile(path)
+			require.NoError(t, err)
+			loaded, unloaded, err := loadUnloadFile(t, path, content)
+			require.NoError(t, err)
+
+			goldenPath := path + ".loaded"
+			if *updateGolden {
+				require.NoError(t, os.WriteFile(goldenPath, loaded, 0644))
+			}
+			golden, err := os.ReadFile(goldenPath)
+			require.NoError(t, err)
+			assert.Equal(t, string(golden), string(loaded))
+			assert.Equal(t, string(content), string(unloaded))
+		})
+	}
+}
+
+func TestModule_LoadUnloadFormatted(t *testing.T) {
+	testCases := []struct {
+		name       string
+		initialHCL string
+		loadedHCL  string
+	}{
+		{
+			name: "Version aligns its siblings",
+			initialHCL: `module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+  name    = "main"
+}
+`,
+			loadedHCL: `module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: v2 source="my-registry/vpc/aws" version="1.0.0"
+  source = "../modules/vpc"
+  name   = "main"
+}
+`,
+		},
+		{
+			name: "Longer sibling",
+			initialHCL: `module "vpc" {
+  # terralink: path=../modules/vpc
+  count      = 1
+  version    = "1.0.0"
+  source     = "my-registry/vpc/aws"
+  depends_on = [module.base]
+}
+`,
+			loadedHCL: `module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: v2 source="my-registry/vpc/aws" version="1.0.0" version_offset="-1"
+  count      = 1
+  source     = "../modules/vpc"
+  depends_on = [module.base]
+}
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			loaded, unloaded, err := loadUnloadFile(t, "main.tf", []byte(tc.initialHCL))
+			require.NoError(t, err)
+			assert.Equal(t, tc.loadedHCL, string(loaded))
+			assert.Equal(t, string(hclwrite.Format(loaded)), string(loaded))
+			assert.Equal(t, string(hclwrite.Format(unloaded)), string(unloaded))
+			assert.Equal(t, tc.initialHCL, string(unloaded))
+		})
+	}
+}
+
+func FuzzModule_LoadUnload(f *testing.F) {
+	paths, err := filepath.Glob(filepath.Join("testdata", "roundtrip", "*.tf"))
+	require.NoError(f, err)
+	for _, path := range paths {
+		content, err := os.ReadFile(path)
+		require.NoError(f, err)
+		f.Add(content)
+	}
+	f.Add([]byte("module \"a\" {\n  # terralink: path=../a\n  source = \"a\"\n}\n"))
+
+	f.Fuzz(func(t *testing.T, content []byte) {
+		_, unloaded, err := loadUnloadFile(t, "fuzz.tf", content)
+		if err != nil {
+			return
+		}
+		if !bytes.Equal(content, unloaded) {
+			t.Fatalf("load/unload changed\n%q\ninto\n%q", content, unloaded)
+		}
+	})
+}
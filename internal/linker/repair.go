@@ -0,0 +1,272 @@
+package linker
+
+import (
+	"bytes"
+	"fmt"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+	"github.com/hashicorp/hcl/v2/hclwrite"
+	log "github.com/sirupsen/logrus"
+)
+
+// repairHistoryDepth is the number of commits of a file searched for the last
+// committed version of a module block.
+const repairHistoryDepth = 50
+
+var (
+	// malformedSourceRegex and malformedVersionRegex salvage the original
+	// source and version from a malformed state annotation, e.g. one missing
+	// its quotes or its "# terralink-state:" prefix.
+	malformedSourceRegex  = regexp.MustCompile(`source\s*[=:]\s*"?([^"\s]+)`)
+	malformedVersionRegex = regexp.MustCompile(`version\s*[=:]\s*"?([^"\s]+)`)
+)
+
+// ModuleRepair describes a module with broken state annotations and how
+// Repair fixes it.
+type ModuleRepair struct {
+	File   string
+	Module string
+	Line   int
+	// Problems lists what is wrong with the module's state annotations.
+	Problems []string
+	// Source and Version are the original source and version the module is
+	// restored to, and Origin tells where they were found.
+	Source  string
+	Version string
+	Origin  string
+}
+
+// RepairConfirmFunc is asked before a module is repaired; modules it declines
+// are left untouched.
+type RepairConfirmFunc func(ModuleRepair) bool
+
+// Repair finds modules with malformed, duplicated or orphaned state
+// annotations and rewrites them to a clean unloaded state: every state
+// annotation is removed and the original source and version are restored.
+// The original is taken from a valid state annotation, else from the last
+// committed version of the block in git, else from what can be salvaged from
+// a malformed state annotation. Modules whose original cannot be found are
+// skipped with a warning. Only the native syntax is repaired.
+func (l *Linker) Repair(confirm RepairConfirmFunc, scanPaths ...string) (map[string]FileChange, error) {
+	unlock, err := l.lock(scanPaths)
+	if err != nil {
+		return nil, err
+	}
+	defer unlock()
+
+	var pending []ConfigFile
+	changes, err := processFiles(scanPaths, l.matcher, l.links, func(configFile ConfigFile) (FileChange, error) {
+		return l.rewrite(configFile, &pending, func(module LinkableModule) (bool, error) {
+			hclModule, isHCL := module.(*Module)
+			if !isHCL {
+				if len(module.malformedStates()) > 0 || module.stateCount() > 1 {
+					log.Warnf("skipping module '%s' in %s: only .tf and .hcl files can be repaired\n", module.Name(), configFile.Path())
+				}
+				return false, nil
+			}
+			repair, needed := planRepair(configFile, hclModule)
+			if !needed {
+				return false, nil
+			}
+			if repair.Source == "" {
+				log.Warnf("skipping module '%s' in %s: cannot find its original source (%s)\n", repair.Module, repair.File, strings.Join(repair.Problems, "; "))
+				return false, nil
+			}
+			if confirm != nil && !confirm(repair) {
+				return false, nil
+			}
+			return hclModule.repair(repair.Source, repair.Version)
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+	if err := l.write(pending); err != nil {
+		return nil, err
+	}
+	return changes, nil
+}
+
+// planRepair reports whether a module needs to be repaired and how.
+func planRepair(configFile ConfigFile, module *Module) (ModuleRepair, bool) {
+	repair := ModuleRepair{File: configFile.Path(), Module: module.Name(), Line: module.Pos().Line}
+	malformed := module.malformedStates()
+	for _, comment := range malformed {
+		repair.Problems = append(repair.Problems, fmt.Sprintf("malformed state annotation '%s'", comment))
+	}
+	if count := module.stateCount(); count > 1 {
+		repair.Problems = append(repair.Problems, fmt.Sprintf("%d terralink-state annotations", count))
+	}
+	state, loaded := module.State()
+	if _, annotated := module.DevAnnotation(); loaded && !annotated {
+		repair.Problems = append(repair.Problems, "terralink-state annotation without a dev annotation")
+	}
+	if len(repair.Problems) == 0 {
+		return repair, false
+	}
+
+	if loaded {
+		repair.Source, repair.Version, repair.Origin = state.Source, state.Version, "terralink-state annotation"
+		return repair, true
+	}
+	if committed, commit, found := committedState(configFile.Path(), module); found {
+		repair.Source, repair.Version, repair.Origin = committed.Source, committed.Version, "git commit "+commit
+		return repair, true
+	}
+	for _, comment := range malformed {
+		if match := malformedSourceRegex.FindStringSubmatch(comment); match != nil {
+			repair.Source, repair.Origin = match[1], "malformed state annotation"
+			if match := malformedVersionRegex.FindStringSubmatch(comment); match != nil {
+				repair.Version = match[1]
+			}
+			return repair, true
+		}
+	}
+	if source := module.Source(); source != "" && !isLocalSource(source) {
+		repair.Source, repair.Origin = source, "current source"
+		repair.Version = getAttrValueAsString(module.block.Body().GetAttribute("version"))
+	}
+	return repair, true
+}
+
+// committedState returns the original source and version of a module found
+// in the last committed version of its block that has one: its state
+// annotation if it was committed loaded, or else its source if it is not a
+// local path. It also returns the abbreviated commit hash.
+func committedState(filePath string, module *Module) (StateAnnotation, string, bool) {
+	dir, name := filepath.Split(filePath)
+	if dir == "" {
+		dir = "."
+	}
+	output, err := exec.Command("git", "-C", dir, "log", "--format=%h", "-n", fmt.Sprint(repairHistoryDepth), "--", name).Output()
+	if err != nil {
+		return StateAnnotation{}, "", false
+	}
+
+	for _, commit := range strings.Fields(string(output)) {
+		content, err := exec.Command("git", "-C", dir, "show", commit+":./"+name).Output()
+		if err != nil {
+			continue
+		}
+		file, diags := hclwrite.ParseConfig(content, filePath, hcl.InitialPos)
+		if diags.HasErrors() {
+			continue
+		}
+		for _, block := range file.Body().Blocks() {
+			if block.Type() != module.block.Type() || !equalLabels(block.Labels(), module.block.Labels()) {
+				continue
+			}
+			if state, found := findStateAnnotation(block); found {
+				return state, commit, true
+			}
+			source := getAttrValueAsString(block.Body().GetAttribute("source"))
+			if source != "" && !isLocalSource(source) {
+				version := getAttrValueAsString(block.Body().GetAttribute("version"))
+				return StateAnnotation{Source: source, Version: version}, commit, true
+			}
+		}
+	}
+	return StateAnnotation{}, "", false
+}
+
+// equalLabels reports whether two blocks have the same labels.
+func equalLabels(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// isStateComment reports whether a comment is, or was meant to be, a state
+// annotation.
+func isStateComment(comment string) bool {
+	return strings.Contains(strings.ToLower(comment), "terralink-state")
+}
+
+// malformedStates returns the comments of the block that mention
+// "terralink-state" but cannot be parsed as a state annotation.
+func (m *Module) malformedStates() []string {
+	var malformed []string
+	for _, token := range m.block.Body().BuildTokens(nil) {
+		if token.Type != hclsyntax.TokenComment || !isStateComment(string(token.Bytes)) {
+			continue
+		}
+		if _, isState := parseStateAnnotation(string(token.Bytes)); !isState {
+			malformed = append(malformed, strings.TrimSpace(string(token.Bytes)))
+		}
+	}
+	return malformed
+}
+
+// repair removes every state annotation of the block, valid or not, and
+// its version, then unloads the module to the given original source and
+// version. It returns true if the block changed.
+func (m *Module) repair(source, version string) (bool, error) {
+	before := m.block.BuildTokens(nil).Bytes()
+
+	body := m.block.Body()
+	inputTokens := body.BuildTokens(nil)
+	versionStart, versionEnd, err := attributeLine(inputTokens, "version")
+	if err != nil {
+		return false, err
+	}
+	// The state annotation ends like the source line.
+	newline := "\n"
+	if sourceStart, sourceEnd, err := attributeLine(inputTokens, "source"); err == nil && sourceStart >= 0 {
+		newline = lineEnding(inputTokens[sourceEnd])
+	}
+	outputTokens := hclwrite.Tokens{}
+	stateInjected := false
+	for i := 0; i < len(inputTokens); i++ {
+		token := inputTokens[i]
+
+		// Drop every state annotation together with its newline.
+		if token.Type == hclsyntax.TokenComment && isStateComment(string(token.Bytes)) {
+			if !endsLine(token) && i+1 < len(inputTokens) && inputTokens[i+1].Type == hclsyntax.TokenNewline {
+				i++
+			}
+			continue
+		}
+
+		// Drop the version line; Unload writes the original one back. A dev
+		// annotation ending it is kept on a line of its own.
+		if i == versionStart {
+			if end := inputTokens[versionEnd]; isDevComment(end) {
+				outputTokens = append(outputTokens, &hclwrite.Token{Type: end.Type, Bytes: end.Bytes})
+			}
+			i = versionEnd
+			continue
+		}
+
+		// A single clean state annotation opens the block.
+		if !stateInjected && token.Type != hclsyntax.TokenNewline {
+			outputTokens = append(outputTokens,
+				&hclwrite.Token{Type: hclsyntax.TokenComment, Bytes: []byte(buildStateAnnotation(StateAnnotation{Source: source, Version: version}))},
+				&hclwrite.Token{Type: hclsyntax.TokenNewline, Bytes: []byte(newline)},
+			)
+			stateInjected = true
+		}
+		outputTokens = append(outputTokens, token)
+	}
+
+	body.Clear()
+	body.AppendUnstructuredTokens(outputTokens)
+	if _, err := m.Unload(); err != nil {
+		return false, err
+	}
+	// The layout of the broken block cannot be restored; format it instead.
+	if err := m.format(); err != nil {
+		return false, err
+	}
+	return !bytes.Equal(before, m.block.BuildTokens(nil).Bytes()), nil
+}
@@ -0,0 +1,254 @@
+package linker
+
+import (
+	"os"
+	"os/exec"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinker_Repair(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name            string
+		hcl             string
+		expected        string
+		expectedChanged bool
+	}{
+		{
+			name: "Duplicate state annotations",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  source = "../modules/vpc"
+}
+`,
+			expected: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+}
+`,
+			expectedChanged: true,
+		},
+		{
+			name: "Malformed state annotation",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state source=my-registry/vpc/aws version="1.0.0
+  source = "../modules/vpc"
+}
+`,
+			expected: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+}
+`,
+			expectedChanged: true,
+		},
+		{
+			name: "State annotation without dev annotation",
+			hcl: `
+module "vpc" {
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+`,
+			expected: `
+module "vpc" {
+  source = "my-registry/vpc/aws"
+}
+`,
+			expectedChanged: true,
+		},
+		{
+			name: "Version referenced by another argument",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  source = "../modules/vpc"
+  engine = var.version
+}
+`,
+			expected: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+  engine  = var.version
+}
+`,
+			expectedChanged: true,
+		},
+		{
+			name:            "CRLF line endings",
+			hcl:             "\r\nmodule \"vpc\" {\r\n  # terralink: path=../modules/vpc\r\n  # terralink-state: source=\"my-registry/vpc/aws\" version=\"1.0.0\"\r\n  # terralink-state: source=\"my-registry/vpc/aws\" version=\"1.0.0\"\r\n  source = \"../modules/vpc\"\r\n}\r\n",
+			expected:        "\r\nmodule \"vpc\" {\r\n  # terralink: path=../modules/vpc\r\n  source  = \"my-registry/vpc/aws\"\r\n  version = \"1.0.0\"\r\n}\r\n",
+			expectedChanged: true,
+		},
+		{
+			name: "Original source not found",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: lost
+  source = "../modules/vpc"
+}
+`,
+			expected: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: lost
+  source = "../modules/vpc"
+}
+`,
+		},
+		{
+			name: "Healthy loaded module",
+			hcl: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+`,
+			expected: `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws"
+  source = "../modules/vpc"
+}
+`,
+		},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			dir := t.TempDir()
+			filePath := filepath.Join(dir, "main.tf")
+			require.NoError(t, os.WriteFile(filePath, []byte(tc.hcl), 0644))
+
+			changes, err := NewLinker(matcher).Repair(nil, dir)
+			require.NoError(t, err)
+			_, changed := changes[filePath]
+			assert.Equal(t, tc.expectedChanged, changed)
+
+			content, err := os.ReadFile(filePath)
+			require.NoError(t, err)
+			assert.Equal(t, tc.expected, string(content))
+		})
+	}
+}
+
+func TestLinker_RepairConfirm(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	content := `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  source = "../modules/vpc"
+}
+`
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "main.tf")
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	var repairs []ModuleRepair
+	changes, err := NewLinker(matcher).Repair(func(repair ModuleRepair) bool {
+		repairs = append(repairs, repair)
+		return false
+	}, dir)
+	require.NoError(t, err)
+	assert.Empty(t, changes)
+	assert.Equal(t, []ModuleRepair{{
+		File: filePath, Module: "vpc", Line: 2,
+		Problems: []string{"2 terralink-state annotations"},
+		Source:   "my-registry/vpc/aws", Version: "1.0.0", Origin: "terralink-state annotation",
+	}}, repairs)
+
+	t.Run("Dry run", func(t *testing.T) {
+		changes, err := NewLinker(matcher, WithDryRun(true)).Repair(nil, dir)
+		require.NoError(t, err)
+		require.Contains(t, changes, filePath)
+		assert.Contains(t, changes[filePath].Diff, `+  source  = "my-registry/vpc/aws"`)
+	})
+
+	actual, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, content, string(actual))
+}
+
+func TestLinker_RepairFromGitHistory(t *testing.T) {
+	if _, err := exec.LookPath("git"); err != nil {
+		t.Skip("git is not installed")
+	}
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	repoDir := t.TempDir()
+	filePath := filepath.Join(repoDir, "main.tf")
+	require.NoError(t, os.WriteFile(filePath, []byte(`
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.2.0"
+}
+`), 0644))
+	for _, args := range [][]string{
+		{"init", "-q"},
+		{"add", "main.tf"},
+		{"-c", "user.name=test", "-c", "user.email=test@example.com", "commit", "-q", "-m", "initial"},
+	} {
+		cmd := exec.Command("git", args...)
+		cmd.Dir = repoDir
+		if output, err := cmd.CombinedOutput(); err != nil {
+			t.Fatalf("git %v failed: %v: %s", args, err, output)
+		}
+	}
+
+	// A merge conflict resolution left the module loaded with its state
+	// annotation mangled beyond salvage.
+	require.NoError(t, os.WriteFile(filePath, []byte(`
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: <<<<<<< HEAD
+  source = "../modules/vpc"
+}
+`), 0644))
+
+	var repairs []ModuleRepair
+	_, err = NewLinker(matcher).Repair(func(repair ModuleRepair) bool {
+		repairs = append(repairs, repair)
+		return true
+	}, repoDir)
+	require.NoError(t, err)
+	require.Len(t, repairs, 1)
+	assert.Contains(t, repairs[0].Origin, "git commit ")
+
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.2.0"
+}
+`, string(content))
+}
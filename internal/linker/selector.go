@@ -0,0 +1,160 @@
+package linker
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+)
+
+// Selector restricts load, unload and check to a subset of modules.
+// Modules can be selected by name (or glob), by the file declaring them, by
+// the local directory their dev annotation resolves to, or by the profiles of
+// their dev annotation. Selectors of the same kind are combined with OR,
+// different kinds with AND. An empty Selector selects every module.
+type Selector struct {
+	names      []string
+	files      []string
+	localPaths []string
+	profiles   []string
+	// loadOptions resolves the module roots of annotated paths. It is set
+	// by the Linker using the selector.
+	loadOptions LoadOptions
+}
+
+// NewSelector builds a Selector from command line arguments, local paths and
+// profile names.
+// Arguments naming an existing file or ending in a Terraform file extension
+// select files; any other argument is a module name or glob such as "aws_*"
+// (an optional "module." prefix is accepted). Files and local paths are
+// resolved relative to the current working directory.
+func NewSelector(args []string, localPaths []string, profiles []string) (*Selector, error) {
+	s := &Selector{profiles: profiles}
+	for _, arg := range args {
+		if isConfigFileArg(arg) {
+			absPath, err := filepath.Abs(arg)
+			if err != nil {
+				return nil, fmt.Errorf("invalid file selector %q: %w", arg, err)
+			}
+			s.files = append(s.files, absPath)
+			continue
+		}
+
+		name := strings.TrimPrefix(arg, "module.")
+		if _, err := path.Match(name, ""); err != nil {
+			return nil, fmt.Errorf("invalid module selector %q: %w", arg, err)
+		}
+		s.names = append(s.names, name)
+	}
+
+	for _, localPath := range localPaths {
+		absPath, err := filepath.Abs(localPath)
+		if err != nil {
+			return nil, fmt.Errorf("invalid local path selector %q: %w", localPath, err)
+		}
+		s.localPaths = append(s.localPaths, absPath)
+	}
+	return s, nil
+}
+
+// isConfigFileArg reports whether a selector argument refers to a file.
+func isConfigFileArg(arg string) bool {
+	for _, suffix := range []string{".tf", jsonFileSuffix, ".hcl"} {
+		if strings.HasSuffix(arg, suffix) {
+			return true
+		}
+	}
+	info, err := os.Stat(arg)
+	return err == nil && info.Mode().IsRegular()
+}
+
+// IsEmpty reports whether the selector selects every module.
+func (s *Selector) IsEmpty() bool {
+	return s == nil || (len(s.names) == 0 && len(s.files) == 0 && len(s.localPaths) == 0 && len(s.profiles) == 0)
+}
+
+// Matches reports whether the given module of the given file is selected.
+func (s *Selector) Matches(file ConfigFile, module LinkableModule) bool {
+	if s.IsEmpty() {
+		return true
+	}
+	return s.matchesName(module.Name()) &&
+		s.matchesFile(file.Path()) &&
+		s.matchesLocalPath(file.Path(), module) &&
+		s.matchesProfile(module)
+}
+
+func (s *Selector) matchesName(name string) bool {
+	if len(s.names) == 0 {
+		return true
+	}
+	for _, pattern := range s.names {
+		if matched, _ := path.Match(pattern, name); matched {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Selector) matchesFile(filePath string) bool {
+	if len(s.files) == 0 {
+		return true
+	}
+	absPath, err := filepath.Abs(filePath)
+	if err != nil {
+		return false
+	}
+	for _, file := range s.files {
+		if file == absPath {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Selector) matchesLocalPath(filePath string, module LinkableModule) bool {
+	if len(s.localPaths) == 0 {
+		return true
+	}
+	devAnnotation, found := module.DevAnnotation()
+	if !found || devAnnotation.Path == "" {
+		return false
+	}
+	resolved, err := filepath.Abs(resolveDevPath(filePath, devAnnotation.localPath(filePath, s.loadOptions)))
+	if err != nil {
+		return false
+	}
+	for _, localPath := range s.localPaths {
+		if localPath == resolved {
+			return true
+		}
+	}
+	return false
+}
+
+func (s *Selector) matchesProfile(module LinkableModule) bool {
+	if len(s.profiles) == 0 {
+		return true
+	}
+	devAnnotation, found := module.DevAnnotation()
+	if !found {
+		return false
+	}
+	for _, profile := range s.profiles {
+		if devAnnotation.HasProfile(profile) {
+			return true
+		}
+	}
+	return false
+}
+
+// resolveDevPath resolves an annotated local path relative to the directory
+// of the file declaring the module.
+func resolveDevPath(filePath, devPath string) string {
+	devPath, _ = splitSourceSubdir(devPath)
+	if filepath.IsAbs(devPath) {
+		return filepath.Clean(devPath)
+	}
+	return filepath.Join(filepath.Dir(filePath), devPath)
+}
@@ -0,0 +1,108 @@
+package linker
+
+import (
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const selectorTestHCL = `
+module "aws_vpc" {
+  # terralink: path=../local/aws/vpc profile=networking
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+}
+
+module "aws_managed" {
+  # terralink: path=../local/aws/managed profile=platform
+  source  = "my-registry/managed/aws"
+  version = "1.2.3"
+}
+
+module "gcp_network" {
+  # terralink: path=../local/gcp/network profile=networking,gcp
+  source  = "my-registry/network/gcp"
+  version = "2.0.0"
+}
+`
+
+func TestSelector_Matches(t *testing.T) {
+	dir := t.TempDir()
+	filePath := filepath.Join(dir, "envs", "main.tf")
+	require.NoError(t, os.MkdirAll(filepath.Dir(filePath), 0755))
+	require.NoError(t, os.WriteFile(filePath, []byte(selectorTestHCL), 0644))
+	otherFile := filepath.Join(dir, "other.tf")
+
+	file, err := NewHCLFile(filePath)
+	require.NoError(t, err)
+
+	testCases := []struct {
+		name       string
+		args       []string
+		localPaths []string
+		profiles   []string
+		expected   []string
+	}{
+		{"Empty selects all", nil, nil, nil, []string{"aws_vpc", "aws_managed", "gcp_network"}},
+		{"Exact name", []string{"aws_vpc"}, nil, nil, []string{"aws_vpc"}},
+		{"Module address", []string{"module.gcp_network"}, nil, nil, []string{"gcp_network"}},
+		{"Glob", []string{"aws_*"}, nil, nil, []string{"aws_vpc", "aws_managed"}},
+		{"Names are OR-ed", []string{"aws_vpc", "gcp_*"}, nil, nil, []string{"aws_vpc", "gcp_network"}},
+		{"File", []string{filePath}, nil, nil, []string{"aws_vpc", "aws_managed", "gcp_network"}},
+		{"Other file", []string{otherFile}, nil, nil, nil},
+		{"File and glob are AND-ed", []string{filePath, "gcp_*"}, nil, nil, []string{"gcp_network"}},
+		{"Local path", nil, []string{filepath.Join(dir, "local", "aws", "managed")}, nil, []string{"aws_managed"}},
+		{"Local path with trailing slash", nil, []string{filepath.Join(dir, "local", "aws", "managed") + "/"}, nil, []string{"aws_managed"}},
+		{"Profile", nil, nil, []string{"networking"}, []string{"aws_vpc", "gcp_network"}},
+		{"Profiles are OR-ed", nil, nil, []string{"platform", "gcp"}, []string{"aws_managed", "gcp_network"}},
+		{"Profile and glob are AND-ed", []string{"aws_*"}, nil, []string{"networking"}, []string{"aws_vpc"}},
+		{"Unknown profile", nil, nil, []string{"unknown"}, nil},
+		{"Local path and name are AND-ed", []string{"gcp_*"}, []string{filepath.Join(dir, "local", "aws", "managed")}, nil, nil},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			selector, err := NewSelector(tc.args, tc.localPaths, tc.profiles)
+			require.NoError(t, err)
+
+			var selected []string
+			for _, module := range file.Modules() {
+				if selector.Matches(file, module) {
+					selected = append(selected, module.Name())
+				}
+			}
+			assert.Equal(t, tc.expected, selected)
+		})
+	}
+}
+
+func TestSelector_InvalidGlob(t *testing.T) {
+	_, err := NewSelector([]string{"aws_["}, nil, nil)
+	assert.Error(t, err)
+}
+
+func TestLinker_DevLoadWithSelector(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+	selector, err := NewSelector([]string{"aws_*"}, nil, nil)
+	require.NoError(t, err)
+	linker := NewLinker(matcher, WithSelector(selector))
+
+	filePath := writeTempFile(t, "main.tf", selectorTestHCL)
+	createDevSourceDirs(t, filePath)
+	changes, err := linker.DevLoad(filePath)
+	require.NoError(t, err)
+	assert.Equal(t, 2, changes[filePath].Modules)
+
+	loadedModulesPerFile, err := NewLinker(matcher).Check(filePath)
+	require.NoError(t, err)
+	var loaded []string
+	for _, module := range loadedModulesPerFile[filePath] {
+		loaded = append(loaded, module.Name)
+	}
+	assert.Equal(t, []string{"aws_vpc", "aws_managed"}, loaded)
+}
@@ -0,0 +1,75 @@
+package linker
+
+import "strings"
+
+// gitRefParam is the query argument selecting a ref in git module sources.
+const gitRefParam = "ref"
+
+// sourceSubdir returns the "//subdir" part of a module source address, without
+// the leading slashes and any query string, e.g. "modules/vpc" for
+// "git::https://example.com/infra.git//modules/vpc?ref=v1.2.3".
+// It returns an empty string if the source has no subdirectory.
+func sourceSubdir(source string) string {
+	_, subdir := splitSourceSubdir(source)
+	if i := strings.Index(subdir, "?"); i >= 0 {
+		subdir = subdir[:i]
+	}
+	return subdir
+}
+
+// splitSourceSubdir splits a module source address at its "//" subdirectory
+// separator. The "//" that follows a URL scheme is not a separator. The
+// subdirectory keeps any trailing query string.
+func splitSourceSubdir(source string) (base, subdir string) {
+	offset := 0
+	if i := strings.Index(source, "::"); i >= 0 {
+		offset = i + len("::")
+	}
+	if i := strings.Index(source[offset:], "://"); i >= 0 {
+		offset += i + len("://")
+	}
+	i := strings.Index(source[offset:], "//")
+	if i < 0 {
+		return source, ""
+	}
+	return source[:offset+i], source[offset+i+len("//"):]
+}
+
+// withSourceSubdir appends a "//subdir" to a local path, unless there is no
+// subdirectory or the path already selects one itself.
+func withSourceSubdir(path, subdir string) string {
+	if subdir == "" || strings.Contains(path, "//") {
+		return path
+	}
+	return strings.TrimSuffix(path, "/") + "//" + subdir
+}
+
+// gitSource builds a git module source from a git address, the subdirectory
+// to use when the address has none of its own, and a ref. Any ref already in
+// the address is replaced, other query arguments are kept.
+func gitSource(address, subdir, ref string) string {
+	base, query, _ := strings.Cut(address, "?")
+	base, ownSubdir := splitSourceSubdir(base)
+	if ownSubdir != "" {
+		subdir = ownSubdir
+	}
+
+	var params []string
+	for _, param := range strings.Split(query, "&") {
+		if param != "" && !strings.HasPrefix(param, gitRefParam+"=") {
+			params = append(params, param)
+		}
+	}
+	if ref != "" {
+		params = append(params, gitRefParam+"="+ref)
+	}
+
+	source := base
+	if subdir != "" {
+		source += "//" + subdir
+	}
+	if len(params) > 0 {
+		source += "?" + strings.Join(params, "&")
+	}
+	return source
+}
@@ -0,0 +1,57 @@
+package linker
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestSource_SourceSubdir(t *testing.T) {
+	testCases := []struct {
+		source   string
+		expected string
+	}{
+		{"git::https://example.com/infra.git//modules/vpc?ref=v1.2.3", "modules/vpc"},
+		{"git::ssh://git@example.com/infra.git//modules/vpc", "modules/vpc"},
+		{"github.com/org/infra//modules/vpc", "modules/vpc"},
+		{"tfr:///terraform-aws-modules/vpc/aws?version=3.0.0", ""},
+		{"git::https://example.com/infra.git?ref=v1.2.3", ""},
+		{"my-registry/managed/aws", ""},
+		{"../modules//vpc", "vpc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.source, func(t *testing.T) {
+			assert.Equal(t, tc.expected, sourceSubdir(tc.source))
+		})
+	}
+}
+
+func TestSource_WithSourceSubdir(t *testing.T) {
+	assert.Equal(t, "../infra//modules/vpc", withSourceSubdir("../infra", "modules/vpc"))
+	assert.Equal(t, "../infra//modules/vpc", withSourceSubdir("../infra/", "modules/vpc"))
+	assert.Equal(t, "../infra", withSourceSubdir("../infra", ""))
+	assert.Equal(t, "../infra//other", withSourceSubdir("../infra//other", "modules/vpc"))
+}
+
+func TestSource_GitSource(t *testing.T) {
+	testCases := []struct {
+		name     string
+		address  string
+		subdir   string
+		ref      string
+		expected string
+	}{
+		{"Plain address", "git::ssh://git@host/org/mod.git", "", "feature/x", "git::ssh://git@host/org/mod.git?ref=feature/x"},
+		{"Subdir from original", "git::ssh://git@host/org/mod.git", "modules/vpc", "feature/x", "git::ssh://git@host/org/mod.git//modules/vpc?ref=feature/x"},
+		{"Own subdir wins", "git::https://host/org/mod.git//other", "modules/vpc", "main", "git::https://host/org/mod.git//other?ref=main"},
+		{"Existing ref replaced", "git::https://host/org/mod.git?ref=v1.0.0&depth=1", "", "main", "git::https://host/org/mod.git?depth=1&ref=main"},
+		{"No ref", "git::https://host/org/mod.git", "modules/vpc", "", "git::https://host/org/mod.git//modules/vpc"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			assert.Equal(t, tc.expected, gitSource(tc.address, tc.subdir, tc.ref))
+		})
+	}
+}
@@ -0,0 +1,121 @@
+package linker
+
+import (
+	"os"
+	"sort"
+)
+
+// ModuleState classifies a module by its dev annotation and state annotation.
+type ModuleState string
+
+const (
+	// StateUnannotated is a module without a dev annotation.
+	StateUnannotated ModuleState = "unannotated"
+	// StateUnloaded is an annotated module using its original source.
+	StateUnloaded ModuleState = "unloaded"
+	// StateLoaded is an annotated module switched to its dev source.
+	StateLoaded ModuleState = "loaded"
+	// StateInconsistent is a module whose annotations and source disagree,
+	// e.g. one edited by hand while loaded.
+	StateInconsistent ModuleState = "inconsistent"
+)
+
+// ModuleStatus describes a single module found by Status.
+type ModuleStatus struct {
+	// Name is the module name.
+	Name string `json:"module"`
+	// File is the path of the file declaring the module.
+	File string `json:"file"`
+	// Line and Column locate the module's declaration (1-based).
+	Line   int         `json:"line"`
+	Column int         `json:"column"`
+	State  ModuleState `json:"state"`
+	// Reason explains an inconsistent state.
+	Reason string `json:"reason,omitempty"`
+	// LocalPath is the local path from the dev annotation, if any, and
+	// LocalPathExists whether it resolves to an existing directory.
+	LocalPath       string `json:"local_path,omitempty"`
+	LocalPathExists bool   `json:"local_path_exists"`
+	// Git is the git address from the dev annotation, if any.
+	Git string `json:"git,omitempty"`
+	// Source is the current value of the module's source.
+	Source string `json:"source"`
+	// OriginalSource and OriginalVersion are recorded in the state annotation
+	// while the module is loaded.
+	OriginalSource  string   `json:"original_source,omitempty"`
+	OriginalVersion string   `json:"original_version,omitempty"`
+	Profiles        []string `json:"profiles,omitempty"`
+}
+
+// Status scans the given paths and describes every selected module, ordered
+// by file and line.
+func (l *Linker) Status(scanPaths ...string) ([]ModuleStatus, error) {
+	statusesPerFile, err := processFiles(scanPaths, l.matcher, l.links, func(configFile ConfigFile) ([]ModuleStatus, error) {
+		var statuses []ModuleStatus
+		for _, module := range configFile.Modules() {
+			if l.selector.Matches(configFile, module) {
+				statuses = append(statuses, l.moduleStatus(configFile, module))
+			}
+		}
+		return statuses, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var statuses []ModuleStatus
+	for _, fileStatuses := range statusesPerFile {
+		statuses = append(statuses, fileStatuses...)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		if statuses[i].File != statuses[j].File {
+			return statuses[i].File < statuses[j].File
+		}
+		return statuses[i].Line < statuses[j].Line
+	})
+	return statuses, nil
+}
+
+// moduleStatus describes a single module.
+func (l *Linker) moduleStatus(configFile ConfigFile, module LinkableModule) ModuleStatus {
+	pos := module.Pos()
+	status := ModuleStatus{
+		Name:   module.Name(),
+		File:   configFile.Path(),
+		Line:   pos.Line,
+		Column: pos.Column,
+		Source: module.Source(),
+	}
+
+	devAnnotation, annotated := module.DevAnnotation()
+	if annotated {
+		status.LocalPath = devAnnotation.Path
+		status.Git = devAnnotation.Git
+		status.Profiles = devAnnotation.Profiles
+		if devAnnotation.Path != "" {
+			localPath := devAnnotation.localPath(configFile.Path(), l.loadOptions)
+			info, err := os.Stat(resolveDevPath(configFile.Path(), localPath))
+			status.LocalPathExists = err == nil && info.IsDir()
+		}
+	}
+	state, loaded := module.State()
+	status.OriginalSource = state.Source
+	status.OriginalVersion = state.Version
+
+	// The rules of 'check --strict' decide which modules are inconsistent.
+	for _, diagnostic := range l.moduleDrift(configFile, module) {
+		status.State = StateInconsistent
+		status.Reason = diagnostic.Reason
+		return status
+	}
+
+	switch {
+	case loaded:
+		status.State = StateLoaded
+	case annotated:
+		status.State = StateUnloaded
+	default:
+		status.State = StateUnannotated
+	}
+	return status
+}
@@ -0,0 +1,89 @@
+package linker
+
+import (
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestLinker_Status(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	liveDir := filepath.Join(root, "live")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "vpc"), 0755))
+	require.NoError(t, os.MkdirAll(liveDir, 0755))
+
+	filePath := filepath.Join(liveDir, "main.tf")
+	content := `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  # terralink-state: source="my-registry/vpc/aws" version="1.0.0"
+  source = "../modules/vpc"
+}
+
+# A module that is not linked.
+module "dns" {
+  source = "my-registry/dns/aws"
+}
+
+module "app" {
+  # terralink: path=../modules/app profile=apps
+  source  = "my-registry/app/aws"
+  version = "2.0.0"
+}
+
+module "edited" {
+  # terralink-state: source="my-registry/edited/aws"
+  source = "../modules/edited"
+}
+
+module "stale" {
+  # terralink: path=../modules/vpc
+  source = "../modules/vpc"
+}
+
+# Linked by hand without any annotation, as 'check --strict' reports it.
+module "manual" {
+  source = "../modules/vpc"
+}
+`
+	require.NoError(t, os.WriteFile(filePath, []byte(content), 0644))
+
+	statuses, err := NewLinker(matcher).Status(liveDir)
+	require.NoError(t, err)
+	require.Len(t, statuses, 6)
+
+	assert.Equal(t, ModuleStatus{
+		Name: "vpc", File: filePath, Line: 2, Column: 1, State: StateLoaded,
+		LocalPath: "../modules/vpc", LocalPathExists: true, Source: "../modules/vpc",
+		OriginalSource: "my-registry/vpc/aws", OriginalVersion: "1.0.0",
+	}, statuses[0])
+	assert.Equal(t, ModuleStatus{
+		Name: "dns", File: filePath, Line: 9, Column: 1, State: StateUnannotated, Source: "my-registry/dns/aws",
+	}, statuses[1])
+	assert.Equal(t, ModuleStatus{
+		Name: "app", File: filePath, Line: 13, Column: 1, State: StateUnloaded,
+		LocalPath: "../modules/app", Source: "my-registry/app/aws", Profiles: []string{"apps"},
+	}, statuses[2])
+	assert.Equal(t, StateInconsistent, statuses[3].State)
+	assert.Equal(t, "has a terralink-state annotation but no dev annotation", statuses[3].Reason)
+	assert.Equal(t, StateInconsistent, statuses[4].State)
+	assert.Equal(t, "uses the local source '../modules/vpc' without a terralink-state annotation; it was probably linked by hand", statuses[4].Reason)
+	assert.Equal(t, StateInconsistent, statuses[5].State)
+	assert.Equal(t, statuses[4].Reason, statuses[5].Reason)
+
+	t.Run("Selected modules only", func(t *testing.T) {
+		selector, err := NewSelector([]string{"app"}, nil, nil)
+		require.NoError(t, err)
+		statuses, err := NewLinker(matcher, WithSelector(selector)).Status(liveDir)
+		require.NoError(t, err)
+		require.Len(t, statuses, 1)
+		assert.Equal(t, "app", statuses[0].Name)
+	})
+}
@@ -0,0 +1,24 @@
+# Network layer.
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "~> 5.0"
+
+  name       = "main"
+  cidr_block = "10.0.0.0/16"
+}
+
+module "dns" {
+  source = "my-registry/dns/aws"
+}
+
+module "subnets" {
+  # terralink: path=../modules/subnets
+  providers = {
+    aws = aws.network
+  }
+  source     = "my-registry/subnets/aws"
+  version    = ">= 1.0, < 2.0"
+  vpc_id     = module.vpc.id
+  depends_on = [module.vpc]
+}
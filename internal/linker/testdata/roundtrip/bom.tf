@@ -0,0 +1,5 @@
+﻿module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+}
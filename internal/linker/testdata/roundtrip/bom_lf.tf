@@ -0,0 +1,5 @@
+﻿# Shared modules.
+module "dns" {
+  # terralink: path=../modules/dns
+  source = "my-registry/dns/aws"
+}
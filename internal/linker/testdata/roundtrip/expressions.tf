@@ -0,0 +1,13 @@
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "${local.registry}/vpc/aws" // mirrored
+  version = var.vpc_version
+}
+
+module "db" {
+  # terralink: git=git::ssh://git@example.com/org/db.git ref=main
+  source = <<EOT
+git::https://example.com/org/db.git//modules/db?ref=v1.0.0
+EOT
+  version = "1.0.0" /* pinned */ # see CHANGELOG
+}
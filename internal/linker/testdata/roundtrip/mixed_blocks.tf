@@ -0,0 +1,15 @@
+resource "null_resource" "a" {
+  triggers = {}
+}
+
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+}
+
+module "dns" {
+  # terralink: path=../modules/dns
+  source  = "my-registry/dns/aws"
+  version = "2.0.0"
+}
@@ -0,0 +1,11 @@
+module "vpc" {
+	# terralink: path=../modules/vpc
+	source=	"my-registry/vpc/aws"   
+
+
+    version   =   "1.0.0"	# keep
+	name = "main"
+}
+module "db" { # terralink: path=../modules/db
+  source =    "my-registry/db/aws"
+}
\ No newline at end of file
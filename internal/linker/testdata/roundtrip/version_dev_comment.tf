@@ -0,0 +1,10 @@
+module "vpc" {
+  source  = "my-registry/vpc/aws"
+  version = "1.2.3" # terralink: path=../modules/vpc
+  count   = 1
+}
+
+module "db" {
+  version = "3.0.0" # terralink: path=../modules/db
+  source = "my-registry/db/aws"
+}
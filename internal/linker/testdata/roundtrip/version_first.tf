@@ -0,0 +1,18 @@
+module "vpc" {
+  # terralink: path=../modules/vpc
+  version = "1.2.3"
+  # Pinned until the v2 migration.
+  count  = 1
+  source = "my-registry/vpc/aws"
+}
+
+module "db" {
+  source = "my-registry/db/aws" # terralink: path=../modules/db
+  version = "3.0.0"
+}
+
+module "cache" {
+  # terralink: path=../modules/cache
+  source  = "my-registry/cache/aws"
+  version = ""
+}
@@ -0,0 +1,106 @@
+package linker
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// PathProblem describes an annotated local path that cannot be loaded.
+type PathProblem struct {
+	File   string
+	Module string
+	Path   string
+	Reason string
+}
+
+// PathValidationError is returned by DevLoad when annotated local paths are
+// invalid. It lists every problem found, not only the first one.
+type PathValidationError struct {
+	Problems []PathProblem
+}
+
+func (e *PathValidationError) Error() string {
+	lines := []string{fmt.Sprintf("%d invalid local path(s), no file was changed:", len(e.Problems))}
+	for _, problem := range e.Problems {
+		lines = append(lines, fmt.Sprintf("  - %s: module '%s': path '%s' %s", problem.File, problem.Module, problem.Path, problem.Reason))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// validateDevSource checks that a local dev source, resolved relative to the
+// directory of the file declaring the module, is a directory containing
+// Terraform files and, if allowedRoots are set, is inside one of them.
+// It returns a description of the problem, or an empty string if the source
+// is valid.
+func validateDevSource(filePath, devSource string, allowedRoots []string) string {
+	base, subdir := splitSourceSubdir(devSource)
+	dir := resolveDevPath(filePath, base)
+	if subdir != "" {
+		dir = filepath.Join(dir, subdir)
+	}
+
+	if len(allowedRoots) > 0 {
+		var reasons []string
+		for _, allowedRoot := range allowedRoots {
+			reason := checkWithinRoot(dir, allowedRoot)
+			if reason == "" {
+				reasons = nil
+				break
+			}
+			reasons = append(reasons, reason)
+		}
+		if len(reasons) > 0 {
+			return strings.Join(reasons, "; ")
+		}
+	}
+
+	info, err := os.Stat(dir)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return fmt.Sprintf("does not exist (resolved to %s)", dir)
+		}
+		return fmt.Sprintf("cannot be read: %v", err)
+	}
+	if !info.IsDir() {
+		return fmt.Sprintf("is not a directory (resolved to %s)", dir)
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return fmt.Sprintf("cannot be read: %v", err)
+	}
+	for _, entry := range entries {
+		name := entry.Name()
+		if !entry.IsDir() && (strings.HasSuffix(name, ".tf") || strings.HasSuffix(name, jsonFileSuffix)) {
+			return ""
+		}
+	}
+	return fmt.Sprintf("contains no .tf or .tf.json files (resolved to %s)", dir)
+}
+
+// checkWithinRoot returns a description of the problem if dir is outside of
+// root, following symlinks where the paths exist.
+func checkWithinRoot(dir, root string) string {
+	absDir, err := filepath.Abs(dir)
+	if err != nil {
+		return fmt.Sprintf("cannot be resolved: %v", err)
+	}
+	absRoot, err := filepath.Abs(root)
+	if err != nil {
+		return fmt.Sprintf("allowed root cannot be resolved: %v", err)
+	}
+	if evaluated, err := filepath.EvalSymlinks(absDir); err == nil {
+		absDir = evaluated
+	}
+	if evaluated, err := filepath.EvalSymlinks(absRoot); err == nil {
+		absRoot = evaluated
+	}
+
+	rel, err := filepath.Rel(absRoot, absDir)
+	if err != nil || rel == ".." || strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return fmt.Sprintf("escapes the allowed root %s (resolved to %s)", root, absDir)
+	}
+	return ""
+}
@@ -0,0 +1,161 @@
+package linker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestValidate_ValidateDevSource(t *testing.T) {
+	root := t.TempDir()
+	filePath := filepath.Join(root, "live", "main.tf")
+
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "valid"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "valid", "main.tf"), nil, 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "json"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "json", "main.tf.json"), nil, 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "empty"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "file"), nil, 0644))
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "repo", "modules", "vpc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "repo", "modules", "vpc", "main.tf"), nil, 0644))
+
+	testCases := []struct {
+		name          string
+		devSource     string
+		allowedRoot   string
+		expectProblem string
+	}{
+		{"Valid", "../modules/valid", "", ""},
+		{"Valid JSON module", "../modules/json", "", ""},
+		{"Valid subdir", "../repo//modules/vpc", "", ""},
+		{"Missing", "../modules/typo", "", "does not exist"},
+		{"Not a directory", "../modules/file", "", "is not a directory"},
+		{"No Terraform files", "../modules/empty", "", "contains no .tf or .tf.json files"},
+		{"Within allowed root", "../modules/valid", root, ""},
+		{"Escapes allowed root", "../modules/valid", filepath.Join(root, "live"), "escapes the allowed root"},
+	}
+
+	for _, tc := range testCases {
+		t.Run(tc.name, func(t *testing.T) {
+			var allowedRoots []string
+			if tc.allowedRoot != "" {
+				allowedRoots = append(allowedRoots, tc.allowedRoot)
+			}
+			reason := validateDevSource(filePath, tc.devSource, allowedRoots)
+			if tc.expectProblem == "" {
+				assert.Empty(t, reason)
+			} else {
+				assert.Contains(t, reason, tc.expectProblem)
+			}
+		})
+	}
+}
+
+const validateTestHCL = `
+module "valid" {
+  # terralink: path=../modules/valid
+  source  = "my-registry/valid/aws"
+  version = "1.0.0"
+}
+
+module "typo" {
+  # terralink: path=../modules/typo
+  source  = "my-registry/typo/aws"
+  version = "1.0.0"
+}
+`
+
+func TestLinker_DevLoadValidatesPaths(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (string, string, string) {
+		root := t.TempDir()
+		liveDir := filepath.Join(root, "live")
+		require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "valid"), 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "valid", "main.tf"), nil, 0644))
+		require.NoError(t, os.MkdirAll(liveDir, 0755))
+		validFile := filepath.Join(liveDir, "a.tf")
+		require.NoError(t, os.WriteFile(validFile, []byte(testCases[0].initialHCL), 0644))
+		createDevSourceDirs(t, validFile)
+		invalidFile := filepath.Join(liveDir, "b.tf")
+		require.NoError(t, os.WriteFile(invalidFile, []byte(validateTestHCL), 0644))
+		return liveDir, validFile, invalidFile
+	}
+
+	t.Run("Fails without writing any file", func(t *testing.T) {
+		liveDir, validFile, invalidFile := setup(t)
+
+		_, err := NewLinker(matcher).DevLoad(liveDir)
+		var validationErr *PathValidationError
+		require.True(t, errors.As(err, &validationErr))
+		require.Len(t, validationErr.Problems, 1)
+		assert.Equal(t, "typo", validationErr.Problems[0].Module)
+		assert.Equal(t, invalidFile, validationErr.Problems[0].File)
+
+		content, err := os.ReadFile(validFile)
+		require.NoError(t, err)
+		assert.Equal(t, testCases[0].initialHCL, string(content))
+		content, err = os.ReadFile(invalidFile)
+		require.NoError(t, err)
+		assert.Equal(t, validateTestHCL, string(content))
+	})
+
+	t.Run("Reports every problem", func(t *testing.T) {
+		liveDir, _, _ := setup(t)
+
+		_, err := NewLinker(matcher, WithAllowedRoot(liveDir)).DevLoad(liveDir)
+		var validationErr *PathValidationError
+		require.True(t, errors.As(err, &validationErr))
+		assert.Len(t, validationErr.Problems, 3)
+	})
+
+	t.Run("Skip missing", func(t *testing.T) {
+		liveDir, validFile, invalidFile := setup(t)
+
+		changes, err := NewLinker(matcher, WithSkipMissing(true)).DevLoad(liveDir)
+		require.NoError(t, err)
+		assert.Equal(t, 1, changes[validFile].Modules)
+		assert.Equal(t, 1, changes[invalidFile].Modules)
+
+		loadedModulesPerFile, err := NewLinker(matcher).Check(liveDir)
+		require.NoError(t, err)
+		require.Len(t, loadedModulesPerFile[invalidFile], 1)
+		assert.Equal(t, "valid", loadedModulesPerFile[invalidFile][0].Name)
+	})
+}
+
+func TestLinker_DevLoadModuleRoots(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	root := t.TempDir()
+	liveDir := filepath.Join(root, "live")
+	require.NoError(t, os.MkdirAll(filepath.Join(root, "modules", "vpc"), 0755))
+	require.NoError(t, os.WriteFile(filepath.Join(root, "modules", "vpc", "main.tf"), nil, 0644))
+	require.NoError(t, os.MkdirAll(liveDir, 0755))
+	filePath := filepath.Join(liveDir, "main.tf")
+	initialHCL := `
+module "vpc" {
+  # terralink: path=@mods/vpc
+  source = "my-registry/vpc/aws"
+}
+`
+	require.NoError(t, os.WriteFile(filePath, []byte(initialHCL), 0644))
+
+	_, err = NewLinker(matcher).DevLoad(liveDir)
+	var validationErr *PathValidationError
+	require.True(t, errors.As(err, &validationErr))
+	assert.Contains(t, validationErr.Problems[0].Reason, "unknown module root '@mods'")
+
+	_, err = NewLinker(matcher, WithModuleRoots(map[string]string{"mods": filepath.Join(root, "modules")})).DevLoad(liveDir)
+	require.NoError(t, err)
+	content, err := os.ReadFile(filePath)
+	require.NoError(t, err)
+	assert.Contains(t, string(content), `source = "../modules/vpc"`)
+}
@@ -0,0 +1,343 @@
+package linker
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"terralink/internal/report"
+
+	"github.com/hashicorp/hcl/v2"
+	"github.com/hashicorp/hcl/v2/hclsyntax"
+)
+
+// Rules reported by interface verification, defined with the other rules in
+// package report.
+const (
+	RuleMissingInput    = report.RuleMissingInput
+	RuleUnknownArgument = report.RuleUnknownArgument
+	RuleMissingOutput   = report.RuleMissingOutput
+)
+
+// moduleMetaArguments are the arguments of a module block handled by
+// Terraform itself rather than passed to the module as variables.
+var moduleMetaArguments = map[string]bool{
+	"source":     true,
+	"version":    true,
+	"count":      true,
+	"for_each":   true,
+	"providers":  true,
+	"depends_on": true,
+}
+
+// jsonModuleReferenceRegex finds module output references inside the string
+// expressions of JSON configuration files.
+var jsonModuleReferenceRegex = regexp.MustCompile(`\bmodule\.([A-Za-z_][A-Za-z0-9_-]*)(?:\[[^\]]*\])?\.([A-Za-z_][A-Za-z0-9_-]*)`)
+
+// InterfaceDiagnostic reports an incompatibility between a module call site
+// and the variables and outputs declared by the local module it is linked to.
+type InterfaceDiagnostic struct {
+	Rule    string
+	Message string
+	File    string
+	Line    int
+	Column  int
+	Module  string
+	// LocalPath is the local module directory the call site was compared with.
+	LocalPath string
+}
+
+// InterfaceError is returned by DevLoad when interface verification is
+// enabled and finds incompatibilities.
+type InterfaceError struct {
+	Diagnostics []InterfaceDiagnostic
+}
+
+func (e *InterfaceError) Error() string {
+	lines := []string{fmt.Sprintf("%d interface incompatibilities found, no file was changed:", len(e.Diagnostics))}
+	for _, diagnostic := range e.Diagnostics {
+		lines = append(lines, fmt.Sprintf("  - %s:%d:%d: %s", diagnostic.File, diagnostic.Line, diagnostic.Column, diagnostic.Message))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// moduleCallSite describes the arguments passed to a module by its block.
+type moduleCallSite struct {
+	// Pos is the position of the module block.
+	Pos hcl.Pos
+	// Arguments maps each argument name to its position.
+	Arguments map[string]hcl.Pos
+}
+
+// moduleInterface is the set of variables and outputs declared by a module.
+type moduleInterface struct {
+	// Variables maps each variable name to whether it is required.
+	Variables map[string]bool
+	Outputs   map[string]bool
+}
+
+// moduleReference is a "module.<name>.<output>" reference in a root module.
+type moduleReference struct {
+	Module string
+	Output string
+	File   string
+	Pos    hcl.Pos
+}
+
+// Verify compares every selected module that is linked to a local path with
+// the local module: required variables that are not set, arguments that are
+// not declared as variables, and references to outputs that are not declared.
+func (l *Linker) Verify(scanPaths ...string) ([]InterfaceDiagnostic, error) {
+	var diagnostics []InterfaceDiagnostic
+	_, err := processFiles(scanPaths, l.matcher, l.links, func(configFile ConfigFile) (int, error) {
+		for _, module := range configFile.Modules() {
+			if !l.selector.Matches(configFile, module) {
+				continue
+			}
+			moduleDiagnostics, err := l.verifyModule(configFile, module)
+			if err != nil {
+				return 0, fmt.Errorf("in module '%s': %w", module.Name(), err)
+			}
+			diagnostics = append(diagnostics, moduleDiagnostics...)
+		}
+		return 0, nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return diagnostics, nil
+}
+
+// verifyModule compares a single module with the local module it is linked
+// to. Modules that are not linked to a valid local path are skipped.
+func (l *Linker) verifyModule(configFile ConfigFile, module LinkableModule) ([]InterfaceDiagnostic, error) {
+	devAnnotation, found := module.DevAnnotation()
+	if !found || devAnnotation.Git != "" {
+		return nil, nil
+	}
+	callSite, ok := module.callSite()
+	if !ok {
+		return nil, nil
+	}
+	devSource, _ := module.DevSource(l.loadOptions)
+	if validateDevSource(configFile.Path(), devSource, nil) != "" {
+		return nil, nil
+	}
+
+	base, subdir := splitSourceSubdir(devSource)
+	localDir := filepath.Join(resolveDevPath(configFile.Path(), base), subdir)
+	iface, err := readModuleInterface(localDir)
+	if err != nil {
+		return nil, err
+	}
+	references, err := readModuleReferences(filepath.Dir(configFile.Path()))
+	if err != nil {
+		return nil, err
+	}
+
+	newDiagnostic := func(rule, file string, pos hcl.Pos, message string) InterfaceDiagnostic {
+		return InterfaceDiagnostic{
+			Rule:      rule,
+			Message:   message,
+			File:      file,
+			Line:      pos.Line,
+			Column:    pos.Column,
+			Module:    module.Name(),
+			LocalPath: devAnnotation.Path,
+		}
+	}
+
+	var diagnostics []InterfaceDiagnostic
+	for _, name := range sortedKeys(iface.Variables) {
+		if _, set := callSite.Arguments[name]; iface.Variables[name] && !set {
+			diagnostics = append(diagnostics, newDiagnostic(RuleMissingInput, configFile.Path(), callSite.Pos,
+				fmt.Sprintf("Module '%s' does not set required variable '%s' of %s.", module.Name(), name, localDir)))
+		}
+	}
+	for _, name := range sortedKeys(callSite.Arguments) {
+		if _, declared := iface.Variables[name]; !declared && !moduleMetaArguments[name] {
+			diagnostics = append(diagnostics, newDiagnostic(RuleUnknownArgument, configFile.Path(), callSite.Arguments[name],
+				fmt.Sprintf("Module '%s' sets argument '%s', which %s does not declare as a variable.", module.Name(), name, localDir)))
+		}
+	}
+	for _, reference := range references {
+		if reference.Module == module.Name() && !iface.Outputs[reference.Output] {
+			diagnostics = append(diagnostics, newDiagnostic(RuleMissingOutput, reference.File, reference.Pos,
+				fmt.Sprintf("Reference to 'module.%s.%s', which %s does not declare as an output.", module.Name(), reference.Output, localDir)))
+		}
+	}
+	return diagnostics, nil
+}
+
+// readModuleInterface reads the variable and output blocks of the .tf and
+// .tf.json files in a module directory.
+func readModuleInterface(dir string) (moduleInterface, error) {
+	iface := moduleInterface{Variables: map[string]bool{}, Outputs: map[string]bool{}}
+	err := forEachHCLBody(dir, func(path string, body *hclsyntax.Body) {
+		for _, block := range body.Blocks {
+			if len(block.Labels) != 1 {
+				continue
+			}
+			switch block.Type {
+			case "variable":
+				_, hasDefault := block.Body.Attributes["default"]
+				iface.Variables[block.Labels[0]] = !hasDefault
+			case "output":
+				iface.Outputs[block.Labels[0]] = true
+			}
+		}
+	})
+	if err != nil {
+		return iface, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return iface, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), jsonFileSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return iface, fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		var root map[string]json.RawMessage
+		if err := json.Unmarshal(content, &root); err != nil {
+			return iface, fmt.Errorf("failed to parse JSON in %s: %w", path, err)
+		}
+		for name, bodies := range jsonBlocks(root["variable"]) {
+			hasDefault := false
+			for _, body := range bodies {
+				_, found := body["default"]
+				hasDefault = hasDefault || found
+			}
+			iface.Variables[name] = !hasDefault
+		}
+		for name := range jsonBlocks(root["output"]) {
+			iface.Outputs[name] = true
+		}
+	}
+	return iface, nil
+}
+
+// jsonBlocks returns the bodies of the labelled blocks of one type in a
+// Terraform JSON file, by label. Terraform accepts an object of blocks or an
+// array of such objects, and an object or an array of objects as the body of
+// each block.
+func jsonBlocks(raw json.RawMessage) map[string][]map[string]json.RawMessage {
+	blocks := map[string][]map[string]json.RawMessage{}
+	var objects []map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &objects); err != nil {
+		var object map[string]json.RawMessage
+		if json.Unmarshal(raw, &object) != nil {
+			return blocks
+		}
+		objects = []map[string]json.RawMessage{object}
+	}
+	for _, object := range objects {
+		for label, value := range object {
+			var bodies []map[string]json.RawMessage
+			if err := json.Unmarshal(value, &bodies); err != nil {
+				var body map[string]json.RawMessage
+				if json.Unmarshal(value, &body) != nil {
+					continue
+				}
+				bodies = []map[string]json.RawMessage{body}
+			}
+			blocks[label] = append(blocks[label], bodies...)
+		}
+	}
+	return blocks
+}
+
+// readModuleReferences collects the "module.<name>.<output>" references of
+// every configuration file in a root module directory.
+func readModuleReferences(dir string) ([]moduleReference, error) {
+	var references []moduleReference
+	err := forEachHCLBody(dir, func(path string, body *hclsyntax.Body) {
+		hclsyntax.VisitAll(body, func(node hclsyntax.Node) hcl.Diagnostics {
+			expr, ok := node.(*hclsyntax.ScopeTraversalExpr)
+			if !ok || expr.Traversal.RootName() != "module" {
+				return nil
+			}
+			var names []string
+			for _, step := range expr.Traversal[1:] {
+				if attr, ok := step.(hcl.TraverseAttr); ok {
+					names = append(names, attr.Name)
+				}
+			}
+			if len(names) >= 2 {
+				references = append(references, moduleReference{Module: names[0], Output: names[1], File: path, Pos: expr.SrcRange.Start})
+			}
+			return nil
+		})
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), jsonFileSuffix) {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		jsonFile := &JSONFile{path: path, content: content}
+		for _, match := range jsonModuleReferenceRegex.FindAllSubmatchIndex(content, -1) {
+			references = append(references, moduleReference{
+				Module: string(content[match[2]:match[3]]),
+				Output: string(content[match[4]:match[5]]),
+				File:   path,
+				Pos:    jsonFile.position(match[0]),
+			})
+		}
+	}
+	return references, nil
+}
+
+// forEachHCLBody parses every .tf file of a directory and calls fn with its body.
+func forEachHCLBody(dir string, fn func(path string, body *hclsyntax.Body)) error {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		if entry.IsDir() || !strings.HasSuffix(entry.Name(), ".tf") {
+			continue
+		}
+		path := filepath.Join(dir, entry.Name())
+		content, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read file %s: %w", path, err)
+		}
+		file, diags := hclsyntax.ParseConfig(content, path, hcl.InitialPos)
+		if diags.HasErrors() {
+			return fmt.Errorf("failed to parse HCL in %s: %w", path, diags)
+		}
+		fn(path, file.Body.(*hclsyntax.Body))
+	}
+	return nil
+}
+
+// sortedKeys returns the keys of a map in sorted order.
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return keys
+}
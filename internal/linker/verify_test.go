@@ -0,0 +1,166 @@
+package linker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+const verifyTestModuleHCL = `
+variable "name" {
+  type = string
+}
+
+variable "cidr" {
+  type    = string
+  default = "10.0.0.0/16"
+}
+
+output "id" {
+  value = "vpc-123"
+}
+`
+
+const verifyTestRootHCL = `
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source  = "my-registry/vpc/aws"
+  version = "1.0.0"
+
+  cidr   = "10.1.0.0/16"
+  region = "eu-west-1"
+}
+
+output "vpc_id" {
+  value = module.vpc.id
+}
+
+output "vpc_arn" {
+  value = module.vpc.arn
+}
+`
+
+const verifyTestRootJSON = `{
+  "output": {
+    "vpc_subnets": {
+      "value": "${module.vpc.subnets}"
+    }
+  }
+}
+`
+
+func TestLinker_Verify(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	setup := func(t *testing.T) (string, string, string) {
+		root := t.TempDir()
+		moduleDir := filepath.Join(root, "modules", "vpc")
+		liveDir := filepath.Join(root, "live")
+		require.NoError(t, os.MkdirAll(moduleDir, 0755))
+		require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "main.tf"), []byte(verifyTestModuleHCL), 0644))
+		require.NoError(t, os.MkdirAll(liveDir, 0755))
+		hclFile := filepath.Join(liveDir, "main.tf")
+		require.NoError(t, os.WriteFile(hclFile, []byte(verifyTestRootHCL), 0644))
+		jsonFile := filepath.Join(liveDir, "outputs.tf.json")
+		require.NoError(t, os.WriteFile(jsonFile, []byte(verifyTestRootJSON), 0644))
+		return liveDir, hclFile, jsonFile
+	}
+
+	t.Run("Reports every incompatibility", func(t *testing.T) {
+		liveDir, hclFile, jsonFile := setup(t)
+
+		diagnostics, err := NewLinker(matcher).Verify(liveDir)
+		require.NoError(t, err)
+
+		type found struct {
+			Rule string
+			File string
+			Line int
+		}
+		var got []found
+		for _, diagnostic := range diagnostics {
+			assert.Equal(t, "vpc", diagnostic.Module)
+			assert.Equal(t, "../modules/vpc", diagnostic.LocalPath)
+			got = append(got, found{diagnostic.Rule, diagnostic.File, diagnostic.Line})
+		}
+		assert.ElementsMatch(t, []found{
+			{RuleMissingInput, hclFile, 2},
+			{RuleUnknownArgument, hclFile, 8},
+			{RuleMissingOutput, hclFile, 16},
+			{RuleMissingOutput, jsonFile, 4},
+		}, got)
+	})
+
+	t.Run("Compatible module", func(t *testing.T) {
+		liveDir, hclFile, jsonFile := setup(t)
+		require.NoError(t, os.WriteFile(hclFile, []byte(`
+module "vpc" {
+  # terralink: path=../modules/vpc
+  source = "my-registry/vpc/aws"
+  count  = 1
+  name   = "main"
+}
+
+output "vpc_id" {
+  value = module.vpc[0].id
+}
+`), 0644))
+		require.NoError(t, os.Remove(jsonFile))
+
+		diagnostics, err := NewLinker(matcher).Verify(liveDir)
+		require.NoError(t, err)
+		assert.Empty(t, diagnostics)
+	})
+
+	t.Run("JSON module", func(t *testing.T) {
+		liveDir, _, jsonFile := setup(t)
+		moduleDir := filepath.Join(filepath.Dir(liveDir), "modules", "vpc")
+		require.NoError(t, os.Remove(filepath.Join(moduleDir, "main.tf")))
+		require.NoError(t, os.WriteFile(filepath.Join(moduleDir, "main.tf.json"), []byte(`{
+  "variable": {
+    "name": {"type": "string"},
+    "cidr": {"type": "string", "default": "10.0.0.0/16"},
+    "region": [{"default": "eu-west-1"}]
+  },
+  "output": [
+    {"id": {"value": "vpc-123"}},
+    {"arn": {"value": "arn"}}
+  ]
+}
+`), 0644))
+		require.NoError(t, os.Remove(jsonFile))
+
+		diagnostics, err := NewLinker(matcher).Verify(liveDir)
+		require.NoError(t, err)
+		require.Len(t, diagnostics, 1)
+		assert.Equal(t, RuleMissingInput, diagnostics[0].Rule)
+		assert.Contains(t, diagnostics[0].Message, "'name'")
+	})
+
+	t.Run("DevLoad fails without writing any file", func(t *testing.T) {
+		liveDir, hclFile, _ := setup(t)
+
+		_, err := NewLinker(matcher, WithVerifyInterface(true)).DevLoad(liveDir)
+		var interfaceErr *InterfaceError
+		require.True(t, errors.As(err, &interfaceErr))
+		assert.Len(t, interfaceErr.Diagnostics, 4)
+
+		content, err := os.ReadFile(hclFile)
+		require.NoError(t, err)
+		assert.Equal(t, verifyTestRootHCL, string(content))
+	})
+
+	t.Run("DevLoad without verification", func(t *testing.T) {
+		liveDir, hclFile, _ := setup(t)
+
+		changes, err := NewLinker(matcher).DevLoad(liveDir)
+		require.NoError(t, err)
+		assert.Equal(t, 1, changes[hclFile].Modules)
+	})
+}
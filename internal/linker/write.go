@@ -0,0 +1,151 @@
+package linker
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	log "github.com/sirupsen/logrus"
+)
+
+// writeFileAtomic replaces the content of the file at path through a
+// temporary file renamed over it, so that readers never see a partially
+// written file. Symlinks are followed and the file keeps its mode and, where
+// the platform supports it, its ownership. A file with several hard links, or
+// whose owner cannot be given to the temporary file, is rewritten in place
+// instead.
+func writeFileAtomic(path string, content []byte) error {
+	target, err := filepath.EvalSymlinks(path)
+	if err != nil {
+		return err
+	}
+	info, err := os.Stat(target)
+	if err != nil {
+		return err
+	}
+	// Renaming over the file would detach it from its other links.
+	if hardLinked(target, info) {
+		return writeFileInPlace(target, content)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(target), "."+filepath.Base(target)+".terralink-*")
+	if err != nil {
+		return err
+	}
+	defer func() {
+		// Only left behind when something failed before the rename.
+		_ = os.Remove(tmp.Name())
+	}()
+
+	if _, err := tmp.Write(content); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Chmod(info.Mode() & (os.ModePerm | os.ModeSetuid | os.ModeSetgid | os.ModeSticky)); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := preserveOwner(tmp, info); err != nil {
+		_ = tmp.Close()
+		log.Warnf("cannot preserve the owner of %s, rewriting it in place: %v\n", target, err)
+		return writeFileInPlace(target, content)
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), target)
+}
+
+// writeFileInPlace truncates the existing file at path and writes content to
+// it, keeping its inode, mode and owner.
+func writeFileInPlace(path string, content []byte) error {
+	file, err := os.OpenFile(path, os.O_WRONLY|os.O_TRUNC, 0)
+	if err != nil {
+		return err
+	}
+	if _, err := file.Write(content); err != nil {
+		_ = file.Close()
+		return err
+	}
+	if err := file.Sync(); err != nil {
+		_ = file.Close()
+		return err
+	}
+	return file.Close()
+}
+
+// lockScanPaths takes a single exclusive advisory lock covering scanPaths so
+// that two terralink runs cannot rewrite the same tree at the same time, even
+// when their scan paths overlap. The lock is keyed by the root of the git
+// repository holding the scan paths, or by their common directory outside of
+// git. The lock file lives in the temporary directory. It fails immediately if
+// another run holds the lock; call the returned function to release it.
+func lockScanPaths(scanPaths []string) (func(), error) {
+	root, err := lockRoot(scanPaths)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256([]byte(root))
+	lockPath := filepath.Join(os.TempDir(), "terralink-"+hex.EncodeToString(sum[:8])+".lock")
+
+	lockFile, err := os.OpenFile(lockPath, os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open lock file %s: %w", lockPath, err)
+	}
+	if err := lockFileExclusive(lockFile); err != nil {
+		_ = lockFile.Close()
+		return nil, fmt.Errorf("another terralink run is in progress on %s: %w", root, err)
+	}
+	return func() {
+		_ = unlockFile(lockFile)
+		_ = lockFile.Close()
+	}, nil
+}
+
+// lockRoot returns the directory locked for scanPaths: the closest directory
+// holding a .git entry at or above their deepest common directory, or that
+// directory itself.
+func lockRoot(scanPaths []string) (string, error) {
+	var common string
+	for _, scanPath := range scanPaths {
+		dir, err := filepath.Abs(scanPath)
+		if err != nil {
+			return "", err
+		}
+		if evaluated, err := filepath.EvalSymlinks(dir); err == nil {
+			dir = evaluated
+		}
+		if info, err := os.Stat(dir); err == nil && !info.IsDir() {
+			dir = filepath.Dir(dir)
+		}
+		if common == "" {
+			common = dir
+			continue
+		}
+		for {
+			rel, err := filepath.Rel(common, dir)
+			if err == nil && rel != ".." && !strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+				break
+			}
+			common = filepath.Dir(common)
+		}
+	}
+	if common == "" {
+		return filepath.Abs(".")
+	}
+	for dir := common; ; dir = filepath.Dir(dir) {
+		if _, err := os.Stat(filepath.Join(dir, ".git")); err == nil {
+			return dir, nil
+		}
+		if dir == filepath.Dir(dir) {
+			return common, nil
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package linker
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"terralink/internal/ignore"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestWrite_WriteFileAtomic(t *testing.T) {
+	t.Run("Preserves the file mode", func(t *testing.T) {
+		filePath := filepath.Join(t.TempDir(), "main.tf")
+		require.NoError(t, os.WriteFile(filePath, []byte("old"), 0600))
+		require.NoError(t, os.Chmod(filePath, 0640))
+
+		require.NoError(t, writeFileAtomic(filePath, []byte("new")))
+
+		info, err := os.Stat(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, os.FileMode(0640), info.Mode().Perm())
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+	})
+
+	t.Run("Writes through symlinks", func(t *testing.T) {
+		dir := t.TempDir()
+		target := filepath.Join(dir, "shared.tf")
+		link := filepath.Join(dir, "main.tf")
+		require.NoError(t, os.WriteFile(target, []byte("old"), 0644))
+		require.NoError(t, os.Symlink(target, link))
+
+		require.NoError(t, writeFileAtomic(link, []byte("new")))
+
+		info, err := os.Lstat(link)
+		require.NoError(t, err)
+		assert.Equal(t, os.ModeSymlink, info.Mode()&os.ModeSymlink)
+		content, err := os.ReadFile(target)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+	})
+
+	t.Run("Leaves no temporary file", func(t *testing.T) {
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "main.tf")
+		require.NoError(t, os.WriteFile(filePath, []byte("old"), 0644))
+
+		require.NoError(t, writeFileAtomic(filePath, []byte("new")))
+
+		entries, err := os.ReadDir(dir)
+		require.NoError(t, err)
+		require.Len(t, entries, 1)
+		assert.Equal(t, "main.tf", entries[0].Name())
+	})
+
+	t.Run("Keeps hard links", func(t *testing.T) {
+		dir := t.TempDir()
+		filePath := filepath.Join(dir, "main.tf")
+		link := filepath.Join(dir, "linked.tf")
+		require.NoError(t, os.WriteFile(filePath, []byte("old"), 0644))
+		require.NoError(t, os.Link(filePath, link))
+
+		require.NoError(t, writeFileAtomic(filePath, []byte("new")))
+
+		content, err := os.ReadFile(link)
+		require.NoError(t, err)
+		assert.Equal(t, "new", string(content))
+	})
+}
+
+func TestWrite_LockScanPaths(t *testing.T) {
+	dir := t.TempDir()
+	require.NoError(t, os.Mkdir(filepath.Join(dir, ".git"), 0755))
+	subDir := filepath.Join(dir, "live")
+	require.NoError(t, os.Mkdir(subDir, 0755))
+
+	unlock, err := lockScanPaths([]string{dir})
+	require.NoError(t, err)
+
+	_, err = lockScanPaths([]string{dir})
+	assert.ErrorContains(t, err, "another terralink run is in progress")
+	_, err = lockScanPaths([]string{subDir})
+	assert.ErrorContains(t, err, "another terralink run is in progress", "overlapping scan paths share the lock of the repository")
+
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+	_, err = NewLinker(matcher).DevUnload(dir)
+	assert.ErrorContains(t, err, "another terralink run is in progress")
+	_, err = NewLinker(matcher, WithDryRun(true)).DevUnload(dir)
+	assert.NoError(t, err, "dry runs do not take the lock")
+
+	unlock()
+	unlock, err = lockScanPaths([]string{subDir})
+	require.NoError(t, err)
+	unlock()
+}
+
+// failingConfigFile is a ConfigFile whose Write always fails.
+type failingConfigFile struct {
+	*HCLFile
+}
+
+func (f failingConfigFile) Write() error {
+	return errors.New("disk full")
+}
+
+func TestLinker_WriteRollsBack(t *testing.T) {
+	matcher, err := ignore.NewMatcher(".")
+	require.NoError(t, err)
+
+	dir := t.TempDir()
+	var pending []ConfigFile
+	var paths []string
+	for _, name := range []string{"a.tf", "b.tf", "c.tf"} {
+		filePath := filepath.Join(dir, name)
+		require.NoError(t, os.WriteFile(filePath, []byte(testCases[0].initialHCL), 0644))
+		createDevSourceDirs(t, filePath)
+		hclFile, err := NewHCLFile(filePath)
+		require.NoError(t, err)
+		_, err = hclFile.Modules()[0].Load(LoadOptions{})
+		require.NoError(t, err)
+		pending = append(pending, hclFile)
+		paths = append(paths, filePath)
+	}
+	pending[2] = failingConfigFile{pending[2].(*HCLFile)}
+
+	err = NewLinker(matcher).write(pending)
+	assert.ErrorContains(t, err, "disk full")
+	assert.ErrorContains(t, err, "2 file(s) already written were restored")
+
+	for _, filePath := range paths {
+		content, err := os.ReadFile(filePath)
+		require.NoError(t, err)
+		assert.Equal(t, testCases[0].initialHCL, string(content))
+	}
+}
@@ -0,0 +1,43 @@
+//go:build !windows
+
+package linker
+
+import (
+	"os"
+	"syscall"
+
+	"golang.org/x/sys/unix"
+)
+
+// preserveOwner gives the file the owner and group described by info.
+func preserveOwner(file *os.File, info os.FileInfo) error {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	if !ok {
+		return nil
+	}
+	current, err := file.Stat()
+	if err != nil {
+		return err
+	}
+	if currentStat, ok := current.Sys().(*syscall.Stat_t); ok && currentStat.Uid == stat.Uid && currentStat.Gid == stat.Gid {
+		return nil
+	}
+	return file.Chown(int(stat.Uid), int(stat.Gid))
+}
+
+// hardLinked reports whether the file at path, described by info, has other
+// hard links.
+func hardLinked(path string, info os.FileInfo) bool {
+	stat, ok := info.Sys().(*syscall.Stat_t)
+	return ok && stat.Nlink > 1
+}
+
+// lockFileExclusive takes an exclusive lock on the file without blocking.
+func lockFileExclusive(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_EX|unix.LOCK_NB)
+}
+
+// unlockFile releases a lock taken by lockFileExclusive.
+func unlockFile(file *os.File) error {
+	return unix.Flock(int(file.Fd()), unix.LOCK_UN)
+}
@@ -0,0 +1,39 @@
+//go:build windows
+
+package linker
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+// preserveOwner is a no-op on Windows, where a renamed file keeps the
+// security descriptor inherited from its directory.
+func preserveOwner(file *os.File, info os.FileInfo) error {
+	return nil
+}
+
+// hardLinked reports whether the file at path has other hard links.
+func hardLinked(path string, info os.FileInfo) bool {
+	file, err := os.Open(path)
+	if err != nil {
+		return false
+	}
+	defer file.Close()
+	var data windows.ByHandleFileInformation
+	if err := windows.GetFileInformationByHandle(windows.Handle(file.Fd()), &data); err != nil {
+		return false
+	}
+	return data.NumberOfLinks > 1
+}
+
+// lockFileExclusive takes an exclusive lock on the file without blocking.
+func lockFileExclusive(file *os.File) error {
+	return windows.LockFileEx(windows.Handle(file.Fd()), windows.LOCKFILE_EXCLUSIVE_LOCK|windows.LOCKFILE_FAIL_IMMEDIATELY, 0, 1, 0, &windows.Overlapped{})
+}
+
+// unlockFile releases a lock taken by lockFileExclusive.
+func unlockFile(file *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(file.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -0,0 +1,384 @@
+// Package report renders check findings in machine-readable formats so that
+// CI systems can surface them as inline annotations.
+package report
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strings"
+)
+
+// Format identifies an output format.
+type Format string
+
+// Supported output formats.
+const (
+	FormatText   Format = "text"
+	FormatJSON   Format = "json"
+	FormatSARIF  Format = "sarif"
+	FormatJUnit  Format = "junit"
+	FormatGitHub Format = "github"
+	FormatGitLab Format = "gitlab"
+)
+
+// Formats lists every supported output format.
+var Formats = []Format{FormatText, FormatJSON, FormatSARIF, FormatJUnit, FormatGitHub, FormatGitLab}
+
+// Rules that can be reported.
+const (
+	// RuleLoadedModule is reported for a module left in a loaded state.
+	RuleLoadedModule = "loaded-module"
+	// RuleMissingInput is reported for a required variable of the local module
+	// that the module block does not set.
+	RuleMissingInput = "missing-input"
+	// RuleUnknownArgument is reported for a module block argument the local
+	// module does not declare as a variable.
+	RuleUnknownArgument = "unknown-argument"
+	// RuleMissingOutput is reported for a reference to an output the local
+	// module does not declare.
+	RuleMissingOutput = "missing-output"
+	// RuleSourceDrift is reported for a loaded module whose source is no
+	// longer its dev source.
+	RuleSourceDrift = "source-drift"
+	// RuleDuplicateState is reported for a module with several state
+	// annotations.
+	RuleDuplicateState = "duplicate-state"
+	// RuleOrphanState is reported for a state annotation without a dev
+	// annotation.
+	RuleOrphanState = "orphan-state"
+	// RuleUnlinkedLocalSource is reported for a local source without a state
+	// annotation.
+	RuleUnlinkedLocalSource = "unlinked-local-source"
+	// RuleMalformedState is reported for a state annotation that cannot be
+	// parsed.
+	RuleMalformedState = "malformed-state"
+)
+
+// Finding is a single problem reported by a check.
+type Finding struct {
+	Rule      string   `json:"rule"`
+	Message   string   `json:"message"`
+	File      string   `json:"file"`
+	Line      int      `json:"line"`
+	Column    int      `json:"column"`
+	Module    string   `json:"module"`
+	LocalPath string   `json:"local_path,omitempty"`
+	Source    string   `json:"source,omitempty"`
+	Version   string   `json:"version,omitempty"`
+	Profiles  []string `json:"profiles,omitempty"`
+}
+
+// ParseFormat validates a format name.
+func ParseFormat(name string) (Format, error) {
+	for _, format := range Formats {
+		if string(format) == name {
+			return format, nil
+		}
+	}
+	names := make([]string, len(Formats))
+	for i, format := range Formats {
+		names[i] = string(format)
+	}
+	return "", fmt.Errorf("unknown format %q (expected one of %s)", name, strings.Join(names, ", "))
+}
+
+// Write renders the findings to w in the given format.
+func Write(w io.Writer, format Format, findings []Finding) error {
+	switch format {
+	case FormatText:
+		return writeText(w, findings)
+	case FormatJSON:
+		return writeJSON(w, findings)
+	case FormatSARIF:
+		return writeSARIF(w, findings)
+	case FormatJUnit:
+		return writeJUnit(w, findings)
+	case FormatGitHub:
+		return writeGitHub(w, findings)
+	case FormatGitLab:
+		return writeGitLab(w, findings)
+	}
+	return fmt.Errorf("unsupported format %q", format)
+}
+
+// location renders a finding's position as file:line:column.
+func (f Finding) location() string {
+	return fmt.Sprintf("%s:%d:%d", f.File, f.Line, f.Column)
+}
+
+func writeText(w io.Writer, findings []Finding) error {
+	for _, finding := range findings {
+		if _, err := fmt.Fprintf(w, "  - %s: %s\n", finding.location(), finding.Message); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func writeJSON(w io.Writer, findings []Finding) error {
+	if findings == nil {
+		findings = []Finding{}
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(findings)
+}
+
+// --- SARIF 2.1.0 ---
+
+type sarifLog struct {
+	Schema  string     `json:"$schema"`
+	Version string     `json:"version"`
+	Runs    []sarifRun `json:"runs"`
+}
+
+type sarifRun struct {
+	Tool    sarifTool     `json:"tool"`
+	Results []sarifResult `json:"results"`
+}
+
+type sarifTool struct {
+	Driver sarifDriver `json:"driver"`
+}
+
+type sarifDriver struct {
+	Name           string      `json:"name"`
+	InformationURI string      `json:"informationUri"`
+	Rules          []sarifRule `json:"rules"`
+}
+
+type sarifRule struct {
+	ID               string       `json:"id"`
+	ShortDescription sarifMessage `json:"shortDescription"`
+}
+
+type sarifMessage struct {
+	Text string `json:"text"`
+}
+
+type sarifResult struct {
+	RuleID     string            `json:"ruleId"`
+	Level      string            `json:"level"`
+	Message    sarifMessage      `json:"message"`
+	Locations  []sarifLocation   `json:"locations"`
+	Properties map[string]string `json:"properties,omitempty"`
+}
+
+type sarifLocation struct {
+	PhysicalLocation sarifPhysicalLocation `json:"physicalLocation"`
+}
+
+type sarifPhysicalLocation struct {
+	ArtifactLocation sarifArtifactLocation `json:"artifactLocation"`
+	Region           sarifRegion           `json:"region"`
+}
+
+type sarifArtifactLocation struct {
+	URI string `json:"uri"`
+}
+
+type sarifRegion struct {
+	StartLine   int `json:"startLine"`
+	StartColumn int `json:"startColumn"`
+}
+
+// ruleDescriptions holds the short description of every rule that can be reported.
+var ruleDescriptions = map[string]string{
+	RuleLoadedModule:        "Module is linked to a local path for development",
+	RuleMissingInput:        "Module does not set a required variable of its local module",
+	RuleUnknownArgument:     "Module sets an argument its local module does not declare",
+	RuleMissingOutput:       "Reference to an output its local module does not declare",
+	RuleSourceDrift:         "Loaded module's source does not match its dev annotation",
+	RuleDuplicateState:      "Module has several terralink-state annotations",
+	RuleOrphanState:         "Module has a terralink-state annotation but no dev annotation",
+	RuleUnlinkedLocalSource: "Module uses a local source without a terralink-state annotation",
+	RuleMalformedState:      "Module has a terralink-state annotation that cannot be parsed",
+}
+
+func writeSARIF(w io.Writer, findings []Finding) error {
+	results := []sarifResult{}
+	seenRules := map[string]bool{}
+	rules := []sarifRule{}
+	for _, finding := range findings {
+		if !seenRules[finding.Rule] {
+			seenRules[finding.Rule] = true
+			rules = append(rules, sarifRule{ID: finding.Rule, ShortDescription: sarifMessage{Text: ruleDescriptions[finding.Rule]}})
+		}
+		results = append(results, sarifResult{
+			RuleID:  finding.Rule,
+			Level:   "error",
+			Message: sarifMessage{Text: finding.Message},
+			Locations: []sarifLocation{{
+				PhysicalLocation: sarifPhysicalLocation{
+					ArtifactLocation: sarifArtifactLocation{URI: filepath.ToSlash(finding.File)},
+					Region:           sarifRegion{StartLine: finding.Line, StartColumn: finding.Column},
+				},
+			}},
+			Properties: finding.properties(),
+		})
+	}
+
+	sarif := sarifLog{
+		Schema:  "https://json.schemastore.org/sarif-2.1.0.json",
+		Version: "2.1.0",
+		Runs: []sarifRun{{
+			Tool: sarifTool{Driver: sarifDriver{
+				Name:           "terralink",
+				InformationURI: "https://github.com/segator/terralink",
+				Rules:          rules,
+			}},
+			Results: results,
+		}},
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(sarif)
+}
+
+// properties returns the module details of a finding as a string map.
+func (f Finding) properties() map[string]string {
+	properties := map[string]string{"module": f.Module}
+	if f.LocalPath != "" {
+		properties["localPath"] = f.LocalPath
+	}
+	if f.Source != "" {
+		properties["source"] = f.Source
+	}
+	if f.Version != "" {
+		properties["version"] = f.Version
+	}
+	if len(f.Profiles) > 0 {
+		properties["profiles"] = strings.Join(f.Profiles, ",")
+	}
+	return properties
+}
+
+// --- JUnit XML ---
+
+type junitTestSuites struct {
+	XMLName  xml.Name         `xml:"testsuites"`
+	Suites   []junitTestSuite `xml:"testsuite"`
+	Tests    int              `xml:"tests,attr"`
+	Failures int              `xml:"failures,attr"`
+}
+
+type junitTestSuite struct {
+	Name      string          `xml:"name,attr"`
+	Tests     int             `xml:"tests,attr"`
+	Failures  int             `xml:"failures,attr"`
+	TestCases []junitTestCase `xml:"testcase"`
+}
+
+type junitTestCase struct {
+	Name      string        `xml:"name,attr"`
+	ClassName string        `xml:"classname,attr"`
+	File      string        `xml:"file,attr,omitempty"`
+	Line      int           `xml:"line,attr,omitempty"`
+	Failure   *junitFailure `xml:"failure,omitempty"`
+}
+
+type junitFailure struct {
+	Message string `xml:"message,attr"`
+	Type    string `xml:"type,attr"`
+	Text    string `xml:",chardata"`
+}
+
+func writeJUnit(w io.Writer, findings []Finding) error {
+	suite := junitTestSuite{Name: "terralink check"}
+	for _, finding := range findings {
+		suite.TestCases = append(suite.TestCases, junitTestCase{
+			Name:      fmt.Sprintf("module.%s", finding.Module),
+			ClassName: filepath.ToSlash(finding.File),
+			File:      filepath.ToSlash(finding.File),
+			Line:      finding.Line,
+			Failure: &junitFailure{
+				Message: finding.Message,
+				Type:    finding.Rule,
+				Text:    finding.location(),
+			},
+		})
+	}
+	if len(suite.TestCases) == 0 {
+		suite.TestCases = append(suite.TestCases, junitTestCase{Name: "no loaded modules", ClassName: "terralink"})
+	}
+	suite.Tests = len(suite.TestCases)
+	suite.Failures = len(findings)
+
+	if _, err := io.WriteString(w, xml.Header); err != nil {
+		return err
+	}
+	encoder := xml.NewEncoder(w)
+	encoder.Indent("", "  ")
+	if err := encoder.Encode(junitTestSuites{Suites: []junitTestSuite{suite}, Tests: suite.Tests, Failures: suite.Failures}); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, "\n")
+	return err
+}
+
+// --- GitHub Actions workflow commands ---
+
+// githubEscaper escapes workflow command property values.
+var githubEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A", ":", "%3A", ",", "%2C")
+
+// githubMessageEscaper escapes workflow command messages.
+var githubMessageEscaper = strings.NewReplacer("%", "%25", "\r", "%0D", "\n", "%0A")
+
+func writeGitHub(w io.Writer, findings []Finding) error {
+	for _, finding := range findings {
+		_, err := fmt.Fprintf(w, "::error file=%s,line=%d,col=%d,title=%s::%s\n",
+			githubEscaper.Replace(filepath.ToSlash(finding.File)),
+			finding.Line,
+			finding.Column,
+			githubEscaper.Replace("terralink "+finding.Rule),
+			githubMessageEscaper.Replace(finding.Message))
+		if err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// --- GitLab Code Quality ---
+
+type gitlabIssue struct {
+	Description string         `json:"description"`
+	CheckName   string         `json:"check_name"`
+	Fingerprint string         `json:"fingerprint"`
+	Severity    string         `json:"severity"`
+	Location    gitlabLocation `json:"location"`
+}
+
+type gitlabLocation struct {
+	Path  string      `json:"path"`
+	Lines gitlabLines `json:"lines"`
+}
+
+type gitlabLines struct {
+	Begin int `json:"begin"`
+}
+
+func writeGitLab(w io.Writer, findings []Finding) error {
+	issues := []gitlabIssue{}
+	for _, finding := range findings {
+		sum := sha256.Sum256([]byte(finding.Rule + "\x00" + filepath.ToSlash(finding.File) + "\x00" + finding.Module))
+		issues = append(issues, gitlabIssue{
+			Description: finding.Message,
+			CheckName:   "terralink/" + finding.Rule,
+			Fingerprint: hex.EncodeToString(sum[:]),
+			Severity:    "major",
+			Location: gitlabLocation{
+				Path:  filepath.ToSlash(finding.File),
+				Lines: gitlabLines{Begin: finding.Line},
+			},
+		})
+	}
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(issues)
+}
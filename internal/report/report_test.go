@@ -0,0 +1,110 @@
+package report
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+var testFindings = []Finding{
+	{
+		Rule:      RuleLoadedModule,
+		Message:   "Module 'vpc' is loaded.",
+		File:      "envs/dev/main.tf",
+		Line:      4,
+		Column:    3,
+		Module:    "vpc",
+		LocalPath: "../modules/vpc",
+		Source:    "app.terraform.io/org/vpc/aws",
+		Version:   "1.0.0",
+	},
+}
+
+func TestReport_ParseFormat(t *testing.T) {
+	for _, format := range Formats {
+		parsed, err := ParseFormat(string(format))
+		require.NoError(t, err)
+		assert.Equal(t, format, parsed)
+	}
+
+	_, err := ParseFormat("yaml")
+	assert.Error(t, err)
+}
+
+func TestReport_JSON(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, FormatJSON, testFindings))
+
+	var decoded []Finding
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, testFindings, decoded)
+
+	buf.Reset()
+	require.NoError(t, Write(buf, FormatJSON, nil))
+	assert.Equal(t, "[]\n", buf.String())
+}
+
+func TestReport_SARIF(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, FormatSARIF, testFindings))
+
+	var decoded sarifLog
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, "2.1.0", decoded.Version)
+	require.Len(t, decoded.Runs, 1)
+	require.Len(t, decoded.Runs[0].Results, 1)
+	result := decoded.Runs[0].Results[0]
+	assert.Equal(t, RuleLoadedModule, result.RuleID)
+	assert.Equal(t, "envs/dev/main.tf", result.Locations[0].PhysicalLocation.ArtifactLocation.URI)
+	assert.Equal(t, 4, result.Locations[0].PhysicalLocation.Region.StartLine)
+	assert.Equal(t, 3, result.Locations[0].PhysicalLocation.Region.StartColumn)
+	assert.Equal(t, "../modules/vpc", result.Properties["localPath"])
+}
+
+func TestReport_JUnit(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, FormatJUnit, testFindings))
+
+	var decoded junitTestSuites
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, 1, decoded.Failures)
+	require.Len(t, decoded.Suites, 1)
+	require.Len(t, decoded.Suites[0].TestCases, 1)
+	assert.Equal(t, "module.vpc", decoded.Suites[0].TestCases[0].Name)
+	require.NotNil(t, decoded.Suites[0].TestCases[0].Failure)
+
+	buf.Reset()
+	require.NoError(t, Write(buf, FormatJUnit, nil))
+	require.NoError(t, xml.Unmarshal(buf.Bytes(), &decoded))
+	assert.Equal(t, 0, decoded.Failures)
+	assert.Equal(t, 1, decoded.Tests)
+}
+
+func TestReport_GitHub(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, FormatGitHub, testFindings))
+	assert.Equal(t, "::error file=envs/dev/main.tf,line=4,col=3,title=terralink loaded-module::Module 'vpc' is loaded.\n", buf.String())
+}
+
+func TestReport_GitLab(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, FormatGitLab, testFindings))
+
+	var decoded []gitlabIssue
+	require.NoError(t, json.Unmarshal(buf.Bytes(), &decoded))
+	require.Len(t, decoded, 1)
+	assert.Equal(t, "terralink/loaded-module", decoded[0].CheckName)
+	assert.Equal(t, "envs/dev/main.tf", decoded[0].Location.Path)
+	assert.Equal(t, 4, decoded[0].Location.Lines.Begin)
+	assert.Len(t, decoded[0].Fingerprint, 64)
+}
+
+func TestReport_Text(t *testing.T) {
+	buf := &bytes.Buffer{}
+	require.NoError(t, Write(buf, FormatText, testFindings))
+	assert.Equal(t, "  - envs/dev/main.tf:4:3: Module 'vpc' is loaded.\n", buf.String())
+}